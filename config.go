@@ -27,17 +27,78 @@ func getConfig() (*viper.Viper, error) {
 	config.SetDefault("record.workers", 4)
 	config.SetDefault("record.input_args", map[string]interface{}{})
 	config.SetDefault("record.output_args", map[string]interface{}{"c:a": "aac", "c:v": "copy"})
+	config.SetDefault("record.masks", false)
+	config.SetDefault("record.container", "mp4")
+	config.SetDefault("record.finalize", false)
+	config.SetDefault("record.stall_timeout", 10)
+	config.SetDefault("record.burst_mode", "overlap")
+	config.SetDefault("record.failover_timeout", 5)
+	config.SetDefault("record.ingest.enabled", false)
+	config.SetDefault("record.ingest.dir", "/tmp/recorder_ingest")
+	config.SetDefault("record.ingest.idle_timeout", 30)
+	config.SetDefault("record.ingest.ready_timeout", 10)
+	config.SetDefault("record.ingest.segment_time", 1)
+	config.SetDefault("record.ingest.list_size", 10)
+	config.SetDefault("record.reconnect.enabled", false)
+	config.SetDefault("record.reconnect.attempts", 3)
+	config.SetDefault("record.reconnect.delay", 1)
+	config.SetDefault("record.validate.enabled", false)
+	config.SetDefault("record.validate.tolerance", 2)
+	config.SetDefault("record.validate.codecs", []interface{}{})
+	config.SetDefault("record.validate.min_bytes", 1024)
+	config.SetDefault("record.validate.retries", 0)
+
+	config.SetDefault("probe.timeout", 10)
+	config.SetDefault("monitor.enabled", false)
+	config.SetDefault("monitor.interval", 60)
+	config.SetDefault("monitor.readiness", true)
+	config.SetDefault("snapshot.cache", 5)
+	config.SetDefault("snapshot.concurrency", 1)
+	config.SetDefault("snapshot.timeout", 10)
+	config.SetDefault("snapshot.width", 0)
+	config.SetDefault("snapshot.prefix", "snapshot")
 
 	config.SetDefault("ssh.user", "recorder")
 	config.SetDefault("ssh.key", "/config/id_rsa")
 	config.SetDefault("upload.workers", 4)
 	config.SetDefault("upload.timeout", 60)
 	config.SetDefault("upload.max_errors", 30)
+	config.SetDefault("upload.artifacts", []interface{}{"bursts"})
+	config.SetDefault("upload.require_masks", false)
 
 	config.SetDefault("convert.dir", "/data")
 	config.SetDefault("convert.workers", 0)
 	config.SetDefault("convert.input_args", map[string]interface{}{"f": "concat", "safe": "0"})
 	config.SetDefault("convert.output_args", map[string]interface{}{"c:a": "copy", "c:v": "h264", "preset": "veryfast"})
+	config.SetDefault("convert.stall_timeout", 30)
+
+	config.SetDefault("thumbnail.workers", 0)
+	config.SetDefault("thumbnail.offset", 1)
+	config.SetDefault("thumbnail.frames", 0)
+	config.SetDefault("thumbnail.width", 320)
+	config.SetDefault("preview.workers", 0)
+	config.SetDefault("preview.format", "gif")
+	config.SetDefault("preview.mode", "first")
+	config.SetDefault("preview.length", 3)
+	config.SetDefault("preview.width", 320)
+	config.SetDefault("preview.fps", 10)
+	config.SetDefault("preview.max_bytes", 1048576)
+	config.SetDefault("analyze.workers", 0)
+	config.SetDefault("analyze.black", 3)
+	config.SetDefault("analyze.freeze", 3)
+	config.SetDefault("analyze.freeze_noise", "-60dB")
+	config.SetDefault("analyze.silence", 0)
+	config.SetDefault("analyze.silence_noise", "-50dB")
+	config.SetDefault("analyze.bad_recordings", 3)
+	config.SetDefault("webhook.workers", 0)
+	config.SetDefault("webhook.urls", []interface{}{})
+	config.SetDefault("webhook.timeout", 10)
+
+	config.SetDefault("pipeline", map[string]interface{}{
+		"record":  map[string]interface{}{"next": []interface{}{"upload", "convert"}},
+		"upload":  map[string]interface{}{"next": []interface{}{"upload"}},
+		"convert": map[string]interface{}{"next": []interface{}{"upload"}},
+	})
 
 	if err := config.ReadInConfig(); err != nil {
 		log.Printf("unable to read config file, starting with defaults: %s", err)
@@ -30,6 +30,41 @@ func TestGetConfig(t *testing.T) {
                   output_args:
                     "c:a": "aac"
                     "c:v": "copy"
+                  masks: false
+                  container: mp4
+                  finalize: false
+                  stall_timeout: 10
+                  burst_mode: overlap
+                  failover_timeout: 5
+                  ingest:
+                    enabled: false
+                    dir: /tmp/recorder_ingest
+                    idle_timeout: 30
+                    ready_timeout: 10
+                    segment_time: 1
+                    list_size: 10
+                  reconnect:
+                    enabled: false
+                    attempts: 3
+                    delay: 1
+                  validate:
+                    enabled: false
+                    tolerance: 2
+                    codecs: []
+                    min_bytes: 1024
+                    retries: 0
+                probe:
+                  timeout: 10
+                monitor:
+                  enabled: false
+                  interval: 60
+                  readiness: true
+                snapshot:
+                  cache: 5
+                  concurrency: 1
+                  timeout: 10
+                  width: 0
+                  prefix: snapshot
                 ssh:
                   user: recorder
                   key: /config/id_rsa
@@ -37,6 +72,8 @@ func TestGetConfig(t *testing.T) {
                   workers: 4
                   timeout: 60
                   max_errors: 30
+                  require_masks: false
+                  artifacts: ["bursts"]
                 convert:
                   dir: /data
                   workers: 0
@@ -47,6 +84,39 @@ func TestGetConfig(t *testing.T) {
                     "c:a": "copy"
                     "c:v": "h264"
                     "preset": "veryfast"
+                  stall_timeout: 30
+                thumbnail:
+                  workers: 0
+                  offset: 1
+                  frames: 0
+                  width: 320
+                preview:
+                  workers: 0
+                  format: gif
+                  mode: first
+                  length: 3
+                  width: 320
+                  fps: 10
+                  max_bytes: 1048576
+                analyze:
+                  workers: 0
+                  black: 3
+                  freeze: 3
+                  freeze_noise: -60dB
+                  silence: 0
+                  silence_noise: -50dB
+                  bad_recordings: 3
+                webhook:
+                  workers: 0
+                  urls: []
+                  timeout: 10
+                pipeline:
+                  record:
+                    next: ["upload", "convert"]
+                  upload:
+                    next: ["upload"]
+                  convert:
+                    next: ["upload"]
                 `)
 				c.SetConfigType("yaml")
 				c.ReadConfig(bytes.NewBuffer(d))
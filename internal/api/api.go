@@ -1,13 +1,26 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"log"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"recorder/internal/job"
+	"recorder/internal/pipeline"
 	"recorder/internal/pool"
 	"recorder/internal/task"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/google/uuid"
 )
 
 // errResponse describes error response for any API call.
@@ -47,9 +60,19 @@ func unableToPerformError(err error) render.Renderer {
 	}
 }
 
+// notFoundError returns 404 http error in case requested resource doesn't exist.
+func notFoundError(err error) render.Renderer {
+	return &errResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusNotFound,
+		StatusText:     "Not found.",
+		ErrorText:      err.Error(),
+	}
+}
+
 // healthHandler returns /healthz and /ready endpoint handler.
 // It just check if every work pool have running workers.
-func healthHandler(workingPools map[string]*pool.Pool) func(http.ResponseWriter, *http.Request) {
+func healthHandler(workingPools map[string]pool.Stats) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		for _, pool := range workingPools {
 			if !pool.Running() {
@@ -61,19 +84,74 @@ func healthHandler(workingPools map[string]*pool.Pool) func(http.ResponseWriter,
 	}
 }
 
+// apiReady describes /ready response, when camera monitor is enabled.
+type apiReady struct {
+	Cameras map[string]task.CameraHealth `json:"cameras"`
+}
+
+// readyHandler returns /ready endpoint handler.
+// It checks working pools like healthHandler, and lists health of cameras when monitor is enabled.
+// Camera which is down makes recorder not ready, unless cameras are excluded from readiness.
+func readyHandler(workingPools map[string]pool.Stats, monitor *task.Monitor) func(http.ResponseWriter, *http.Request) {
+	health := healthHandler(workingPools)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if monitor == nil {
+			health(w, r)
+			return
+		}
+		status := http.StatusOK
+		for _, pool := range workingPools {
+			if !pool.Running() {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		if !camerasReady(monitor) {
+			status = http.StatusServiceUnavailable
+		}
+		render.Status(r, status)
+		render.JSON(w, r, &apiReady{Cameras: cameraHealth(monitor)})
+	}
+}
+
 // apiRecordRequest describes API request used to start recording.
 type apiRecordRequest struct {
-	Stream  string `json:"stream"`
-	CamName string `json:"cam_name"`
-	Prefix  string `json:"prefix"`
-	Length  int64  `json:"length"`
-	Burst   int64  `json:"burst"`
+	Stream    string            `json:"stream"`
+	CamName   string            `json:"cam_name"`
+	Prefix    string            `json:"prefix"`
+	Length    int64             `json:"length"`
+	Burst     int64             `json:"burst"`
+	Tags      map[string]string `json:"tags"`
+	Container string            `json:"container"`
+	Streams   []string          `json:"streams"`
+	EventID   string            `json:"event_id"`
+	// NamedStreams are recorded in sync, by stream name.
+	NamedStreams map[string]string `json:"named_streams"`
+
+	// configured describes streams configured for cameras, nil skips the check.
+	configured *task.ProbeConfig
 }
 
 // Bind validates request.
 func (req *apiRecordRequest) Bind(r *http.Request) error {
-	if req.Stream == "" {
-		return fmt.Errorf("stream url is required")
+	// Streams can be configured for camera.
+	if req.Stream == "" && len(req.Streams) == 0 && len(req.NamedStreams) == 0 {
+		if req.CamName == "" {
+			return fmt.Errorf("stream url is required")
+		}
+		if req.configured != nil && !req.configured.HasStreams(req.CamName) {
+			return fmt.Errorf("stream url is required, camera %s has no configured streams", req.CamName)
+		}
+	}
+	if slices.Contains(req.Streams, "") {
+		return fmt.Errorf("streams can't contain empty url")
+	}
+	for name, stream := range req.NamedStreams {
+		if !streamNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid stream name %q, only lowercase letters, digits and _ are allowed", name)
+		}
+		if stream == "" {
+			return fmt.Errorf("named stream %s has no url", name)
+		}
 	}
 	if req.CamName == "" {
 		req.CamName = "unknown"
@@ -87,30 +165,252 @@ func (req *apiRecordRequest) Bind(r *http.Request) error {
 	if req.Burst < 1 {
 		req.Burst = 1
 	}
+	if _, ok := task.LookupContainer(req.Container); req.Container != "" && !ok {
+		return fmt.Errorf("unknown container %s", req.Container)
+	}
+	for key := range req.Tags {
+		if !tagKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid tag %q, only letters, digits and _ are allowed", key)
+		}
+	}
 	return nil
 }
 
 // recorderHandler will start recording.
-// apiRecordRequest should be passed.
-func recordHandler(recordPool *pool.Pool) func(http.ResponseWriter, *http.Request) {
+// apiRecordRequest should be passed. Job is created for every accepted recording.
+// Job ID is used as event ID, when it is not passed.
+func recordHandler(recordStage pipeline.Stage, jobs *job.Registry, configured *task.ProbeConfig) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		request := &apiRecordRequest{}
+		request := &apiRecordRequest{configured: configured}
 		if err := render.Bind(r, request); err != nil {
 			render.Render(w, r, invalidRequestError(err))
 			return
 		}
 		tRecord := &task.Record{
-			Stream:  request.Stream,
-			Prefix:  request.Prefix,
-			CamName: request.CamName,
-			Length:  request.Length,
-			Burst:   request.Burst,
+			JobID:     uuid.New().String(),
+			Stream:    request.Stream,
+			Prefix:    request.Prefix,
+			CamName:   request.CamName,
+			Length:    request.Length,
+			Burst:     request.Burst,
+			Tags:      request.Tags,
+			Container: request.Container,
+			Streams:   request.Streams,
+			EventID:   request.EventID,
+
+			NamedStreams: request.NamedStreams,
+		}
+		if tRecord.EventID == "" {
+			tRecord.EventID = tRecord.JobID
 		}
 
-		if err := recordPool.Execute(tRecord.Do); err != nil {
+		// Job is created before task runs, so none of its artifacts are lost.
+		jobs.Create(tRecord.JobID)
+		if err := recordStage.Accept(tRecord); err != nil {
+			jobs.Remove(tRecord.JobID)
 			render.Render(w, r, unableToPerformError(err))
 			return
 		}
 		render.JSON(w, r, tRecord)
 	}
 }
+
+// apiProbeRequest describes API request used to probe stream without recording.
+type apiProbeRequest struct {
+	Stream  string `json:"stream"`
+	CamName string `json:"cam_name"`
+}
+
+// Bind validates request.
+func (req *apiProbeRequest) Bind(r *http.Request) error {
+	if req.Stream == "" && req.CamName == "" {
+		return fmt.Errorf("stream url or cam_name is required")
+	}
+	return nil
+}
+
+// probeHandler probes stream, or every stream configured for camera, without recording.
+// apiProbeRequest should be passed. Failed probes are reported in results, with class of error.
+func probeHandler(probeConfig *task.ProbeConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &apiProbeRequest{}
+		if err := render.Bind(r, request); err != nil {
+			render.Render(w, r, invalidRequestError(err))
+			return
+		}
+		results, err := probeStreams(probeConfig, request.Stream, request.CamName)
+		if err != nil {
+			render.Render(w, r, notFoundError(err))
+			return
+		}
+		render.JSON(w, r, results)
+	}
+}
+
+// snapshotHandler returns current JPEG frame of camera.
+// With save=true query parameter, snapshot is also saved into recordings, its URL is returned in X-Snapshot-URL header.
+func snapshotHandler(snapshots *task.Snapshots, recordingPath string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		snapshot, err := getSnapshot(snapshots, r.Context(), name)
+		if errors.Is(err, task.ErrUnknownCamera) {
+			render.Render(w, r, notFoundError(err))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, unableToPerformError(err))
+			return
+		}
+		if r.URL.Query().Get("save") == "true" {
+			filePath, err := saveSnapshot(snapshots, snapshot)
+			if err != nil {
+				render.Render(w, r, unableToPerformError(err))
+				return
+			}
+			w.Header().Set("X-Snapshot-URL", recordingURL(recordingPath, filePath))
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Last-Modified", snapshot.Time.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(snapshot.Image)
+	}
+}
+
+// apiRecording describes single recording returned by recordings API.
+type apiRecording struct {
+	Path       string            `json:"path"`
+	Size       int64             `json:"size"`
+	ModTime    time.Time         `json:"mod_time"`
+	Thumbnail  string            `json:"thumbnail,omitempty"`
+	Thumbnails []string          `json:"thumbnails,omitempty"`
+	Preview    string            `json:"preview,omitempty"`
+	MIMEType   string            `json:"mime_type"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// recordingsHandler lists recordings with their thumbnails.
+// Recordings can be filtered with prefix and date query parameters.
+// Container metadata is read only when metadata=true is passed, as every file has to be probed.
+// All paths are relative to /recordings/ endpoint.
+func recordingsHandler(recordingPath string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// filepath.Join cleans path, leading / prevents escaping recordingPath.
+		dirPath := filepath.Join(recordingPath, filepath.Join("/", r.URL.Query().Get("prefix"), r.URL.Query().Get("date")))
+		withMetadata := r.URL.Query().Get("metadata") == "true"
+
+		recordings := []*apiRecording{}
+		err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !slices.Contains(videoExtensions, filepath.Ext(path)) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			recording := &apiRecording{
+				Path:     recordingURL(recordingPath, path),
+				Size:     info.Size(),
+				ModTime:  info.ModTime(),
+				MIMEType: mime.TypeByExtension(filepath.Ext(path)),
+			}
+			basePath := strings.TrimSuffix(path, filepath.Ext(path))
+			if _, err := os.Stat(basePath + ".jpg"); err == nil {
+				recording.Thumbnail = recordingURL(recordingPath, basePath+".jpg")
+			}
+			for _, ext := range []string{".gif", ".webp"} {
+				if _, err := os.Stat(basePath + ext); err == nil {
+					recording.Preview = recordingURL(recordingPath, basePath+ext)
+				}
+			}
+			frames, _ := filepath.Glob(basePath + "-[0-9][0-9].jpg")
+			for _, frame := range frames {
+				recording.Thumbnails = append(recording.Thumbnails, recordingURL(recordingPath, frame))
+			}
+			if withMetadata {
+				if recording.Metadata, err = readMetadata(path); err != nil {
+					log.Printf("unable to read metadata of %s: %v", path, err)
+				}
+			}
+			recordings = append(recordings, recording)
+			return nil
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			render.Render(w, r, notFoundError(err))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, unableToPerformError(err))
+			return
+		}
+		render.JSON(w, r, recordings)
+	}
+}
+
+// apiJob describes job returned by jobs API.
+// Progress files are URLs under /recordings/ endpoint.
+type apiJob struct {
+	ID        string          `json:"id"`
+	Created   time.Time       `json:"created"`
+	Artifacts []*apiArtifact  `json:"artifacts"`
+	Progress  []*job.Progress `json:"progress"`
+}
+
+// apiArtifact describes single job artifact.
+// Failed, unrecoverable and invalid recordings are removed, so they have no URL.
+type apiArtifact struct {
+	Type       string   `json:"type"`
+	URL        string   `json:"url,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	ErrorClass string   `json:"error_class,omitempty"`
+	Stream     string   `json:"stream,omitempty"`
+	Findings   []string `json:"findings,omitempty"`
+}
+
+// jobHandler returns job with its artifacts.
+// Artifacts paths are relative to /recordings/ endpoint.
+func jobHandler(jobs *job.Registry, recordingPath string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		j, ok := jobs.Get(id)
+		if !ok {
+			render.Render(w, r, notFoundError(fmt.Errorf("job %s not found", id)))
+			return
+		}
+
+		resp := &apiJob{
+			ID:        j.ID,
+			Created:   j.Created,
+			Artifacts: []*apiArtifact{},
+		}
+		for _, artifact := range j.Artifacts {
+			apiArtifact := &apiArtifact{
+				Type:       artifact.Type,
+				Status:     artifact.Status,
+				Error:      artifact.Error,
+				ErrorClass: artifact.ErrorClass,
+				Stream:     artifact.Stream,
+				Findings:   artifact.Findings,
+			}
+			if !slices.Contains(removedStatuses, artifact.Status) {
+				apiArtifact.URL = recordingURL(recordingPath, artifact.FilePath)
+			}
+			resp.Artifacts = append(resp.Artifacts, apiArtifact)
+		}
+		for _, progress := range j.Progress {
+			progress.File = recordingURL(recordingPath, progress.File)
+		}
+		resp.Progress = j.Progress
+		render.JSON(w, r, resp)
+	}
+}
+
+// recordingURL returns URL of file under /recordings/ endpoint.
+func recordingURL(recordingPath, path string) string {
+	rel, _ := filepath.Rel(recordingPath, path)
+	return "/recordings/" + filepath.ToSlash(rel)
+}
@@ -8,11 +8,17 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"recorder/internal/job"
+	"recorder/internal/pipeline"
 	"recorder/internal/pool"
+	"recorder/internal/task"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/require"
 )
 
@@ -53,9 +59,9 @@ func TestHealthHandler(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		workingPools := make(map[string]*pool.Pool)
+		workingPools := make(map[string]pool.Stats)
 		for idx, opts := range test.inputPoolsOpts {
-			workingPools[fmt.Sprint(idx)] = pool.New(opts)
+			workingPools[fmt.Sprint(idx)] = pool.New[int](opts)
 		}
 		time.Sleep(10 * time.Millisecond)
 		handler := healthHandler(workingPools)
@@ -69,11 +75,87 @@ func TestHealthHandler(t *testing.T) {
 	}
 }
 
+func TestReadyHandler(t *testing.T) {
+	defer func() {
+		cameraHealth = (*task.Monitor).Health
+		camerasReady = (*task.Monitor).Ready
+	}()
+	lastCheck := time.Date(2023, time.January, 20, 1, 2, 3, 0, time.UTC)
+	cameraHealth = func(*task.Monitor) map[string]task.CameraHealth {
+		return map[string]task.CameraHealth{
+			"cam1": {Up: true, Latency: 120, LastCheck: lastCheck, LastSuccess: lastCheck},
+			"cam2": {LastCheck: lastCheck, ErrorClass: task.ErrorClassAuth, Error: "401 Unauthorized"},
+		}
+	}
+
+	tests := []struct {
+		inputPoolsOpts []*pool.Options
+		inputMonitor   *task.Monitor
+		inputReady     bool
+		expectedCode   int
+	}{
+		{
+			inputPoolsOpts: []*pool.Options{{NoWorkers: 1}},
+			expectedCode:   http.StatusOK,
+		},
+		{
+			inputPoolsOpts: []*pool.Options{{}},
+			expectedCode:   http.StatusServiceUnavailable,
+		},
+		{
+			inputPoolsOpts: []*pool.Options{{NoWorkers: 1}},
+			inputMonitor:   &task.Monitor{},
+			inputReady:     true,
+			expectedCode:   http.StatusOK,
+		},
+		{
+			inputPoolsOpts: []*pool.Options{{NoWorkers: 1}},
+			inputMonitor:   &task.Monitor{},
+			expectedCode:   http.StatusServiceUnavailable,
+		},
+		{
+			inputPoolsOpts: []*pool.Options{{}},
+			inputMonitor:   &task.Monitor{},
+			inputReady:     true,
+			expectedCode:   http.StatusServiceUnavailable,
+		},
+	}
+	for _, test := range tests {
+		workingPools := make(map[string]pool.Stats)
+		for idx, opts := range test.inputPoolsOpts {
+			workingPools[fmt.Sprint(idx)] = pool.New[int](opts)
+		}
+		time.Sleep(10 * time.Millisecond)
+		camerasReady = func(*task.Monitor) bool { return test.inputReady }
+		handler := readyHandler(workingPools, test.inputMonitor)
+
+		req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		require.Equal(t, test.expectedCode, w.Code)
+		if test.inputMonitor == nil {
+			require.Empty(t, w.Body.String())
+			continue
+		}
+		resp := make(map[string]interface{})
+		unmarshalBody(w.Result().Body, &resp)
+		require.Equal(t, map[string]interface{}{
+			"cameras": map[string]interface{}{
+				"cam1": map[string]interface{}{"up": true, "latency_ms": float64(120), "last_check": "2023-01-20T01:02:03Z", "last_success": "2023-01-20T01:02:03Z"},
+				"cam2": map[string]interface{}{"up": false, "latency_ms": float64(0), "last_check": "2023-01-20T01:02:03Z", "error_class": "auth_failed", "error": "401 Unauthorized"},
+			},
+		}, resp)
+	}
+}
+
 func TestRecordHandler(t *testing.T) {
-	ctx := context.Background()
-	ctx = context.WithValue(ctx, "outputDir", "/data")
-	ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]interface{}{})
-	ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]interface{}{})
+	ctx := task.WithConfig(context.Background(), &task.RecordConfig{
+		OutputDir:  "/data",
+		InputArgs:  map[string]string{},
+		OutputArgs: map[string]string{},
+	})
 
 	tests := []struct {
 		inputRequest  map[string]interface{}
@@ -108,7 +190,7 @@ func TestRecordHandler(t *testing.T) {
 				Ctx:        ctx,
 			},
 			expectedCode: http.StatusOK,
-			expectedResp: map[string]interface{}{"Stream": "TestRecordHandler", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "unknown"},
+			expectedResp: map[string]interface{}{"Stream": "TestRecordHandler", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "unknown", "Tags": nil, "Container": "", "NamedStreams": nil, "StreamName": "", "Streams": nil},
 		},
 		{
 			inputRequest: map[string]interface{}{"stream": "TestRecordHandler", "cam_name": "test_cam_name", "prefix": "random_prefix", "length": 15, "burst": 3},
@@ -119,13 +201,111 @@ func TestRecordHandler(t *testing.T) {
 				Ctx:        ctx,
 			},
 			expectedCode: http.StatusOK,
-			expectedResp: map[string]interface{}{"Stream": "TestRecordHandler", "CamName": "test_cam_name", "Prefix": "random_prefix", "Length": float64(15), "Burst": float64(3)},
+			expectedResp: map[string]interface{}{"Stream": "TestRecordHandler", "CamName": "test_cam_name", "Prefix": "random_prefix", "Length": float64(15), "Burst": float64(3), "Tags": nil, "Container": "", "NamedStreams": nil, "StreamName": "", "Streams": nil},
+		},
+		{
+			inputRequest: map[string]interface{}{"stream": "TestRecordHandler", "tags": map[string]string{"event_id": "42"}},
+			inputPoolOpts: &pool.Options{
+				NoWorkers:  0,
+				PoolSize:   3,
+				ResultSize: 3,
+				Ctx:        ctx,
+			},
+			expectedCode: http.StatusOK,
+			expectedResp: map[string]interface{}{"Stream": "TestRecordHandler", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "unknown", "Tags": map[string]interface{}{"event_id": "42"}, "Container": "", "NamedStreams": nil, "StreamName": "", "Streams": nil},
+		},
+		{
+			inputRequest: map[string]interface{}{"stream": "TestRecordHandler", "container": "mkv"},
+			inputPoolOpts: &pool.Options{
+				NoWorkers:  0,
+				PoolSize:   3,
+				ResultSize: 3,
+				Ctx:        ctx,
+			},
+			expectedCode: http.StatusOK,
+			expectedResp: map[string]interface{}{"Stream": "TestRecordHandler", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "unknown", "Tags": nil, "Container": "mkv", "NamedStreams": nil, "StreamName": "", "Streams": nil},
+		},
+		{
+			inputRequest: map[string]interface{}{"cam_name": "cam1", "streams": []string{"rtsp://cam1/sub", "rtsp://nvr/cam1"}},
+			inputPoolOpts: &pool.Options{
+				NoWorkers:  0,
+				PoolSize:   3,
+				ResultSize: 3,
+				Ctx:        ctx,
+			},
+			expectedCode: http.StatusOK,
+			expectedResp: map[string]interface{}{"Stream": "", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "cam1", "Tags": nil, "Container": "", "NamedStreams": nil, "StreamName": "", "Streams": []interface{}{"rtsp://cam1/sub", "rtsp://nvr/cam1"}},
+		},
+		{
+			inputRequest: map[string]interface{}{"cam_name": "cam1", "event_id": "event1", "named_streams": map[string]string{"main": "rtsp://cam1/101", "sub": "rtsp://cam1/102"}},
+			inputPoolOpts: &pool.Options{
+				NoWorkers:  0,
+				PoolSize:   3,
+				ResultSize: 3,
+				Ctx:        ctx,
+			},
+			expectedCode: http.StatusOK,
+			expectedResp: map[string]interface{}{"Stream": "", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "cam1", "Tags": nil, "Container": "", "EventID": "event1", "NamedStreams": map[string]interface{}{"main": "rtsp://cam1/101", "sub": "rtsp://cam1/102"}, "StreamName": "", "Streams": nil},
+		},
+		{
+			inputRequest: map[string]interface{}{"cam_name": "cam1"},
+			inputPoolOpts: &pool.Options{
+				NoWorkers:  0,
+				PoolSize:   3,
+				ResultSize: 3,
+				Ctx:        ctx,
+			},
+			expectedCode: http.StatusOK,
+			expectedResp: map[string]interface{}{"Stream": "", "Length": float64(5), "Burst": float64(1), "Prefix": "unknown", "CamName": "cam1", "Tags": nil, "Container": "", "NamedStreams": nil, "StreamName": "", "Streams": nil},
+		},
+		{
+			inputRequest:  map[string]interface{}{"cam_name": "cam2"},
+			inputPoolOpts: &pool.Options{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: "stream url is required, camera cam2 has no configured streams",
+		},
+		{
+			inputRequest:  map[string]interface{}{"named_streams": map[string]string{"Main": "rtsp://cam1/101"}},
+			inputPoolOpts: &pool.Options{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: `invalid stream name "Main", only lowercase letters, digits and _ are allowed`,
+		},
+		{
+			inputRequest:  map[string]interface{}{"named_streams": map[string]string{"sub": ""}},
+			inputPoolOpts: &pool.Options{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: "named stream sub has no url",
+		},
+		{
+			inputRequest:  map[string]interface{}{"stream": "TestRecordHandler", "streams": []string{""}},
+			inputPoolOpts: &pool.Options{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: "streams can't contain empty url",
+		},
+		{
+			inputRequest:  map[string]interface{}{"stream": "TestRecordHandler", "container": "avi"},
+			inputPoolOpts: &pool.Options{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: "unknown container avi",
+		},
+		{
+			inputRequest:  map[string]interface{}{"stream": "TestRecordHandler", "tags": map[string]string{"event id": "42"}},
+			inputPoolOpts: &pool.Options{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: `invalid tag "event id", only letters, digits and _ are allowed`,
 		},
 	}
 
+	configured := &task.ProbeConfig{Streams: map[string][]string{"cam1": {"rtsp://cam1/101"}}}
+
 	for _, test := range tests {
-		p := pool.New(test.inputPoolOpts)
-		handler := recordHandler(p)
+		var jobID string
+		s := pipeline.NewStage(test.inputPoolOpts, func(r *task.Record) pool.Task[task.RecordResult] {
+			jobID = r.JobID
+			return r.Do
+		})
+		jobs := job.NewRegistry(10)
+		handler := recordHandler(s, jobs, configured)
 
 		body, _ := json.Marshal(test.inputRequest)
 		req := httptest.NewRequest(http.MethodPost, "/api/record", bytes.NewReader(body))
@@ -141,10 +321,20 @@ func TestRecordHandler(t *testing.T) {
 		resp := make(map[string]interface{})
 		unmarshalBody(res.Body, &resp)
 		if test.expectedResp != nil {
+			_, ok := jobs.Get(resp["JobID"].(string))
+			require.True(t, ok)
+			if _, ok := test.expectedResp["EventID"]; !ok {
+				require.Equal(t, resp["JobID"], resp["EventID"])
+				delete(resp, "EventID")
+			}
+			delete(resp, "JobID")
 			require.Equal(t, test.expectedResp, resp)
 		}
 
 		if w.Code != http.StatusOK {
+			// Job of rejected recording is removed.
+			_, ok := jobs.Get(jobID)
+			require.False(t, ok)
 			if test.expectedError != "" {
 				require.Equal(t, test.expectedError, resp["error"])
 			}
@@ -152,6 +342,371 @@ func TestRecordHandler(t *testing.T) {
 	}
 }
 
+func TestProbeHandler(t *testing.T) {
+	defer func() {
+		probeStreams = (*task.ProbeConfig).Probe
+	}()
+	probeConfig := &task.ProbeConfig{Streams: map[string][]string{"cam1": {"rtsp://cam1/101"}}}
+	probeStreams = func(config *task.ProbeConfig, stream, camName string) ([]*task.StreamProbe, error) {
+		require.Equal(t, probeConfig, config)
+		if stream == "" && camName != "cam1" {
+			return nil, fmt.Errorf("camera %s has no configured streams", camName)
+		}
+		if stream == "" {
+			stream = config.Streams[camName][0]
+		}
+		return []*task.StreamProbe{{Source: stream, OK: true, VideoCodec: "h264", Width: 1280, Height: 720, FPS: 25}}, nil
+	}
+
+	tests := []struct {
+		inputRequest  map[string]interface{}
+		expectedCode  int
+		expectedError string
+		expectedResp  []interface{}
+	}{
+		{
+			inputRequest:  map[string]interface{}{},
+			expectedCode:  http.StatusBadRequest,
+			expectedError: "stream url or cam_name is required",
+		},
+		{
+			inputRequest:  map[string]interface{}{"cam_name": "cam2"},
+			expectedCode:  http.StatusNotFound,
+			expectedError: "camera cam2 has no configured streams",
+		},
+		{
+			inputRequest: map[string]interface{}{"cam_name": "cam1"},
+			expectedCode: http.StatusOK,
+			expectedResp: []interface{}{
+				map[string]interface{}{"source": "rtsp://cam1/101", "ok": true, "video_codec": "h264", "width": float64(1280), "height": float64(720), "fps": float64(25), "audio": false, "latency_ms": float64(0)},
+			},
+		},
+		{
+			inputRequest: map[string]interface{}{"stream": "rtsp://cam2/101"},
+			expectedCode: http.StatusOK,
+			expectedResp: []interface{}{
+				map[string]interface{}{"source": "rtsp://cam2/101", "ok": true, "video_codec": "h264", "width": float64(1280), "height": float64(720), "fps": float64(25), "audio": false, "latency_ms": float64(0)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		handler := probeHandler(probeConfig)
+
+		body, _ := json.Marshal(test.inputRequest)
+		req := httptest.NewRequest(http.MethodPost, "/api/probe", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		require.Equal(t, test.expectedCode, w.Code)
+
+		res := w.Result()
+		defer res.Body.Close()
+		if w.Code != http.StatusOK {
+			resp := make(map[string]interface{})
+			unmarshalBody(res.Body, &resp)
+			require.Equal(t, test.expectedError, resp["error"])
+			continue
+		}
+		var resp []interface{}
+		unmarshalBody(res.Body, &resp)
+		require.Equal(t, test.expectedResp, resp)
+	}
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	defer func() {
+		getSnapshot = (*task.Snapshots).Get
+		saveSnapshot = (*task.Snapshots).Save
+	}()
+	snapshotTime := time.Date(2023, time.January, 20, 1, 2, 3, 0, time.UTC)
+	getSnapshot = func(_ *task.Snapshots, _ context.Context, camName string) (*task.Snapshot, error) {
+		switch camName {
+		case "cam1":
+			return &task.Snapshot{CamName: camName, Image: []byte("image"), Time: snapshotTime}, nil
+		case "cam2":
+			return nil, fmt.Errorf("mock error")
+		}
+		return nil, fmt.Errorf("%w %s", task.ErrUnknownCamera, camName)
+	}
+	saveSnapshot = func(_ *task.Snapshots, snapshot *task.Snapshot) (string, error) {
+		return "/data/snapshot/20-01-2023/01:02:03.000-" + snapshot.CamName + ".jpg", nil
+	}
+
+	tests := []struct {
+		inputPath       string
+		expectedCode    int
+		expectedError   string
+		expectedBody    string
+		expectedHeaders map[string]string
+	}{
+		{
+			inputPath:     "/api/cameras/cam3/snapshot.jpg",
+			expectedCode:  http.StatusNotFound,
+			expectedError: "unknown camera cam3",
+		},
+		{
+			inputPath:     "/api/cameras/cam2/snapshot.jpg",
+			expectedCode:  http.StatusInternalServerError,
+			expectedError: "mock error",
+		},
+		{
+			inputPath:    "/api/cameras/cam1/snapshot.jpg",
+			expectedCode: http.StatusOK,
+			expectedBody: "image",
+			expectedHeaders: map[string]string{
+				"Content-Type":   "image/jpeg",
+				"Last-Modified":  "Fri, 20 Jan 2023 01:02:03 GMT",
+				"X-Snapshot-Url": "",
+			},
+		},
+		{
+			inputPath:    "/api/cameras/cam1/snapshot.jpg?save=true",
+			expectedCode: http.StatusOK,
+			expectedBody: "image",
+			expectedHeaders: map[string]string{
+				"Content-Type":   "image/jpeg",
+				"X-Snapshot-Url": "/recordings/snapshot/20-01-2023/01:02:03.000-cam1.jpg",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		router := chi.NewRouter()
+		router.Get("/api/cameras/{name}/snapshot.jpg", snapshotHandler(&task.Snapshots{}, "/data"))
+
+		req := httptest.NewRequest(http.MethodGet, test.inputPath, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, test.expectedCode, w.Code)
+		if w.Code != http.StatusOK {
+			resp := make(map[string]interface{})
+			unmarshalBody(w.Result().Body, &resp)
+			require.Equal(t, test.expectedError, resp["error"])
+			continue
+		}
+		require.Equal(t, test.expectedBody, w.Body.String())
+		for header, value := range test.expectedHeaders {
+			require.Equal(t, value, w.Header().Get(header))
+		}
+	}
+}
+
+func TestRecordingsHandler(t *testing.T) {
+	recordingPath := t.TempDir()
+	for _, fileName := range []string{
+		"door/28-01-2023/23:40:27.876-cam1-001-002.mp4",
+		"door/28-01-2023/23:40:27.876-cam1-001-002.jpg",
+		"door/28-01-2023/23:40:27.876-cam1-001-002.gif",
+		"door/28-01-2023/23:40:27.876-cam1-002-002.mp4",
+		"door/28-01-2023/23:40:27.876-cam1-convert.mkv",
+		"door/28-01-2023/23:40:27.876-cam1-convert.jpg",
+		"door/28-01-2023/23:40:27.876-cam1-convert-01.jpg",
+		"door/28-01-2023/23:40:27.876-cam1-convert-02.jpg",
+		"garage/29-01-2023/10:00:00.000-cam2-001-001.mp4",
+		"garage/29-01-2023/notes.txt",
+	} {
+		require.Nil(t, os.MkdirAll(filepath.Join(recordingPath, filepath.Dir(fileName)), os.ModePerm))
+		require.Nil(t, os.WriteFile(filepath.Join(recordingPath, fileName), []byte("data"), 0644))
+	}
+
+	readMetadata = func(path string) (map[string]string, error) {
+		if filepath.Ext(path) == ".mkv" {
+			return nil, fmt.Errorf("mock error")
+		}
+		return map[string]string{"camera": "cam2"}, nil
+	}
+	defer func() {
+		readMetadata = task.ReadMetadata
+	}()
+
+	tests := []struct {
+		inputQuery         string
+		expectedCode       int
+		expectedRecordings []map[string]interface{}
+	}{
+		{
+			inputQuery:   "?prefix=missing",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			inputQuery:   "?prefix=garage",
+			expectedCode: http.StatusOK,
+			expectedRecordings: []map[string]interface{}{
+				{"path": "/recordings/garage/29-01-2023/10:00:00.000-cam2-001-001.mp4", "mime_type": "video/mp4"},
+			},
+		},
+		{
+			inputQuery:   "?prefix=garage&metadata=true",
+			expectedCode: http.StatusOK,
+			expectedRecordings: []map[string]interface{}{
+				{
+					"path":     "/recordings/garage/29-01-2023/10:00:00.000-cam2-001-001.mp4",
+					"metadata": map[string]interface{}{"camera": "cam2"},
+				},
+			},
+		},
+		{
+			inputQuery:   "?prefix=../../garage",
+			expectedCode: http.StatusOK,
+			expectedRecordings: []map[string]interface{}{
+				{"path": "/recordings/garage/29-01-2023/10:00:00.000-cam2-001-001.mp4"},
+			},
+		},
+		{
+			inputQuery:   "?prefix=door&date=28-01-2023",
+			expectedCode: http.StatusOK,
+			expectedRecordings: []map[string]interface{}{
+				{
+					"path":      "/recordings/door/28-01-2023/23:40:27.876-cam1-001-002.mp4",
+					"thumbnail": "/recordings/door/28-01-2023/23:40:27.876-cam1-001-002.jpg",
+					"preview":   "/recordings/door/28-01-2023/23:40:27.876-cam1-001-002.gif",
+				},
+				{
+					"path": "/recordings/door/28-01-2023/23:40:27.876-cam1-002-002.mp4",
+				},
+				{
+					"path":       "/recordings/door/28-01-2023/23:40:27.876-cam1-convert.mkv",
+					"mime_type":  "video/x-matroska",
+					"thumbnail":  "/recordings/door/28-01-2023/23:40:27.876-cam1-convert.jpg",
+					"thumbnails": []interface{}{"/recordings/door/28-01-2023/23:40:27.876-cam1-convert-01.jpg", "/recordings/door/28-01-2023/23:40:27.876-cam1-convert-02.jpg"},
+				},
+			},
+		},
+		{
+			expectedCode: http.StatusOK,
+			expectedRecordings: []map[string]interface{}{
+				{"path": "/recordings/door/28-01-2023/23:40:27.876-cam1-001-002.mp4"},
+				{"path": "/recordings/door/28-01-2023/23:40:27.876-cam1-002-002.mp4"},
+				{"path": "/recordings/door/28-01-2023/23:40:27.876-cam1-convert.mkv"},
+				{"path": "/recordings/garage/29-01-2023/10:00:00.000-cam2-001-001.mp4"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		handler := recordingsHandler(recordingPath)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/recordings"+test.inputQuery, nil)
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		require.Equal(t, test.expectedCode, w.Code)
+		if test.expectedCode != http.StatusOK {
+			continue
+		}
+
+		var resp []map[string]interface{}
+		unmarshalBody(w.Result().Body, &resp)
+		require.Equal(t, len(test.expectedRecordings), len(resp))
+		for idx, expectedRecording := range test.expectedRecordings {
+			for k, v := range expectedRecording {
+				require.Equal(t, v, resp[idx][k])
+			}
+			require.Equal(t, float64(4), resp[idx]["size"])
+		}
+	}
+}
+
+func TestJobHandler(t *testing.T) {
+	jobs := job.NewRegistry(10)
+	jobs.Create("a")
+	jobs.AddArtifact("a", &job.Artifact{Type: "burst", FilePath: "/data/door/28-01-2023/23:40:27.876-cam1-001-001.mp4"})
+	jobs.AddArtifact("a", &job.Artifact{Type: "preview", FilePath: "/data/door/28-01-2023/23:40:27.876-cam1-001-001.gif"})
+	jobs.SetProgress("a", &job.Progress{Task: "convert", File: "/data/door/28-01-2023/23:40:27.876-cam1.mp4", Frame: 250, FPS: 50, Speed: 2, Bitrate: 1024.5, OutTime: 10})
+	jobs.Create("b")
+	jobs.AddArtifact("b", &job.Artifact{Type: "burst", FilePath: "/data/door/28-01-2023/23:40:30.000-cam1-001-002.mp4", Status: "repaired"})
+	jobs.AddArtifact("b", &job.Artifact{Type: "burst", FilePath: "/data/door/28-01-2023/23:40:30.000-cam1-002-002.mp4", Status: "unrecoverable", Error: "recording is unrecoverable"})
+	jobs.AddArtifact("b", &job.Artifact{Type: "burst", FilePath: "/data/door/28-01-2023/23:40:30.000-cam1-002-002.mp4", Status: "invalid", Error: "invalid recording: no video stream"})
+	jobs.AddArtifact("b", &job.Artifact{Type: "converted", FilePath: "/data/door/28-01-2023/23:40:30.000-cam1.mp4", Status: "failed", Error: "ffmpeg failed (codec_unsupported): exit status 1: Unknown encoder 'h264_vaapi'", ErrorClass: "codec_unsupported"})
+	jobs.Create("c")
+	jobs.AddArtifact("c", &job.Artifact{Type: "burst", FilePath: "/data/door/28-01-2023/23:40:27.876-cam1-sub-001-001.mp4", Stream: "sub", Findings: []string{"black", "frozen"}})
+	jobs.Create("d")
+
+	tests := []struct {
+		inputID           string
+		expectedCode      int
+		expectedArtifacts []interface{}
+		expectedProgress  []interface{}
+	}{
+		{
+			inputID:      "missing",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			inputID:           "d",
+			expectedCode:      http.StatusOK,
+			expectedArtifacts: []interface{}{},
+			expectedProgress:  []interface{}{},
+		},
+		{
+			inputID:      "c",
+			expectedCode: http.StatusOK,
+			expectedArtifacts: []interface{}{
+				map[string]interface{}{"type": "burst", "url": "/recordings/door/28-01-2023/23:40:27.876-cam1-sub-001-001.mp4", "stream": "sub", "findings": []interface{}{"black", "frozen"}},
+			},
+			expectedProgress: []interface{}{},
+		},
+		{
+			inputID:      "b",
+			expectedCode: http.StatusOK,
+			expectedArtifacts: []interface{}{
+				map[string]interface{}{"type": "burst", "url": "/recordings/door/28-01-2023/23:40:30.000-cam1-001-002.mp4", "status": "repaired"},
+				map[string]interface{}{"type": "burst", "status": "unrecoverable", "error": "recording is unrecoverable"},
+				map[string]interface{}{"type": "burst", "status": "invalid", "error": "invalid recording: no video stream"},
+				map[string]interface{}{"type": "converted", "status": "failed", "error": "ffmpeg failed (codec_unsupported): exit status 1: Unknown encoder 'h264_vaapi'", "error_class": "codec_unsupported"},
+			},
+			expectedProgress: []interface{}{},
+		},
+		{
+			inputID:      "a",
+			expectedCode: http.StatusOK,
+			expectedArtifacts: []interface{}{
+				map[string]interface{}{"type": "burst", "url": "/recordings/door/28-01-2023/23:40:27.876-cam1-001-001.mp4"},
+				map[string]interface{}{"type": "preview", "url": "/recordings/door/28-01-2023/23:40:27.876-cam1-001-001.gif"},
+			},
+			expectedProgress: []interface{}{
+				map[string]interface{}{
+					"task":           "convert",
+					"file":           "/recordings/door/28-01-2023/23:40:27.876-cam1.mp4",
+					"frame":          float64(250),
+					"fps":            float64(50),
+					"speed":          float64(2),
+					"bitrate_kbps":   1024.5,
+					"out_time":       float64(10),
+					"dropped_frames": float64(0),
+					"done":           false,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		router := chi.NewRouter()
+		router.Get("/api/jobs/{id}", jobHandler(jobs, "/data"))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+test.inputID, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, test.expectedCode, w.Code)
+		if test.expectedCode != http.StatusOK {
+			continue
+		}
+
+		resp := make(map[string]interface{})
+		unmarshalBody(w.Result().Body, &resp)
+		require.Equal(t, test.inputID, resp["id"])
+		require.Equal(t, test.expectedArtifacts, resp["artifacts"])
+		require.Equal(t, test.expectedProgress, resp["progress"])
+	}
+}
+
 func unmarshalBody(body io.Reader, destination interface{}) interface{} {
 	b, err := io.ReadAll(body)
 	if err != nil {
@@ -1,15 +1,41 @@
 package api
 
 import (
+	"regexp"
+
+	"recorder/internal/job"
+	"recorder/internal/pipeline"
 	"recorder/internal/pool"
+	"recorder/internal/task"
 )
 
 var (
 	HTTPPort = 8080
+	// videoExtensions describes files listed by recordings API.
+	videoExtensions = []string{".mp4", ".mkv", ".ts"}
+	// tagKeyRegexp describes allowed keys of request tags.
+	tagKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	// streamNameRegexp describes allowed names of named streams, config keys are lowercase.
+	streamNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+	// removedStatuses describes artifacts which were removed.
+	removedStatuses = []string{task.StatusFailed, task.StatusInvalid, task.FinalizeUnrecoverable}
+
+	// mocks for tests.
+	readMetadata = task.ReadMetadata
+	probeStreams = (*task.ProbeConfig).Probe
+	getSnapshot  = (*task.Snapshots).Get
+	saveSnapshot = (*task.Snapshots).Save
+	cameraHealth = (*task.Monitor).Health
+	camerasReady = (*task.Monitor).Ready
 )
 
 type Options struct {
 	RecordingPath string
-	WorkingPools  map[string]*pool.Pool
+	WorkingPools  map[string]pool.Stats
+	RecordStage   pipeline.Stage
 	AuthUsers     map[string]string
+	Jobs          *job.Registry
+	Probe         *task.ProbeConfig // Streams of cameras, record requests with cam_name only are checked against it.
+	Snapshots     *task.Snapshots
+	Monitor       *task.Monitor // Health of cameras in /ready, disabled when nil.
 }
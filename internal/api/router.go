@@ -2,13 +2,23 @@ package api
 
 import (
 	"log"
+	"mime"
 	"net/http"
 
+	"recorder/internal/task"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// System MIME database may miss (or misinterpret, e.g. .ts) container extensions.
+func init() {
+	for ext, mimeType := range task.ContainerMIMETypes() {
+		mime.AddExtensionType(ext, mimeType)
+	}
+}
+
 // NewRouter creates http router.
 func NewRouter(opts *Options) *chi.Mux {
 	httpRouter := chi.NewRouter()
@@ -16,7 +26,7 @@ func NewRouter(opts *Options) *chi.Mux {
 	httpRouter.Group(func(r chi.Router) {
 		r.Use(middleware.CleanPath)
 		r.Use(middleware.Recoverer)
-		r.Get("/ready", healthHandler(opts.WorkingPools))
+		r.Get("/ready", readyHandler(opts.WorkingPools, opts.Monitor))
 		r.Get("/healthz", healthHandler(opts.WorkingPools))
 		r.Method("GET", "/metrics", promhttp.Handler())
 	})
@@ -35,7 +45,11 @@ func NewRouter(opts *Options) *chi.Mux {
 		r.Handle("/", http.RedirectHandler("/recordings/", http.StatusMovedPermanently))
 		r.Handle("/recordings/*", http.StripPrefix("/recordings/", recordings))
 
-		r.Post("/api/record", recordHandler(opts.WorkingPools["record"]))
+		r.Post("/api/record", recordHandler(opts.RecordStage, opts.Jobs, opts.Probe))
+		r.Post("/api/probe", probeHandler(opts.Probe))
+		r.Get("/api/cameras/{name}/snapshot.jpg", snapshotHandler(opts.Snapshots, opts.RecordingPath))
+		r.Get("/api/jobs/{id}", jobHandler(opts.Jobs, opts.RecordingPath))
+		r.Get("/api/recordings", recordingsHandler(opts.RecordingPath))
 	})
 
 	return httpRouter
@@ -8,8 +8,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"recorder/internal/pipeline"
 	"recorder/internal/pool"
+	"recorder/internal/task"
 
 	"github.com/stretchr/testify/require"
 )
@@ -108,11 +111,16 @@ func TestNewRouter(t *testing.T) {
 		},
 	}
 
-	workingPools := map[string]*pool.Pool{
-		"record": pool.New(&pool.Options{
-			NoWorkers: 3,
-		}),
+	recordStage := pipeline.NewStage(&pool.Options{
+		NoWorkers: 3,
+	}, func(r *task.Record) pool.Task[task.RecordResult] {
+		return r.Do
+	})
+	workingPools := map[string]pool.Stats{
+		"record": recordStage,
 	}
+	// lets wait for spawning workers.
+	time.Sleep(10 * time.Millisecond)
 
 	for _, test := range tests {
 		body, _ := json.Marshal(map[string]interface{}{})
@@ -129,6 +137,7 @@ func TestNewRouter(t *testing.T) {
 		router := NewRouter(&Options{
 			AuthUsers:    test.auth,
 			WorkingPools: workingPools,
+			RecordStage:  recordStage,
 		})
 
 		httpServer := &http.Server{Addr: fmt.Sprintf(":%d", HTTPPort), Handler: router}
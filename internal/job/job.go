@@ -0,0 +1,203 @@
+package job
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Job describes single recording request and everything produced for it.
+type Job struct {
+	ID        string      `json:"id"`
+	Created   time.Time   `json:"created"`
+	Artifacts []*Artifact `json:"artifacts"`
+	Progress  []*Progress `json:"progress"`
+}
+
+// Artifact describes file produced for job.
+// Status is set by steps which check produced file, e.g. finalize of bursts.
+// Error describes why file was rejected, ErrorClass is set for ffmpeg failures.
+// Source describes stream which was recorded, Stream is name of recorded named stream.
+// Findings are set by quality analysis, e.g. black or frozen video.
+type Artifact struct {
+	Type       string   `json:"type"`
+	FilePath   string   `json:"file_path"`
+	Status     string   `json:"status,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	ErrorClass string   `json:"error_class,omitempty"`
+	Source     string   `json:"source,omitempty"`
+	Stream     string   `json:"stream,omitempty"`
+	Findings   []string `json:"findings,omitempty"`
+}
+
+// Progress describes progress of single ffmpeg process, reported by ffmpeg -progress.
+// Done is set when process exits, Stalled when it was killed by stall detector.
+type Progress struct {
+	Task          string  `json:"task"`
+	File          string  `json:"file"`
+	Frame         int64   `json:"frame"`
+	FPS           float64 `json:"fps"`
+	Speed         float64 `json:"speed"`
+	Bitrate       float64 `json:"bitrate_kbps"`
+	OutTime       float64 `json:"out_time"`
+	DroppedFrames int64   `json:"dropped_frames"`
+	Done          bool    `json:"done"`
+	Stalled       bool    `json:"stalled,omitempty"`
+}
+
+// Registry keeps last jobs in memory.
+// All methods are safe to call on nil Registry, which makes reporting optional for tasks.
+type Registry struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string
+	maxJobs int
+}
+
+// registryKey is used to store Registry in context.
+type registryKey struct{}
+
+// NewRegistry creates Registry which keeps up to maxJobs jobs.
+func NewRegistry(maxJobs int) *Registry {
+	return &Registry{
+		jobs:    make(map[string]*Job),
+		maxJobs: maxJobs,
+	}
+}
+
+// WithRegistry returns copy of ctx which carries Registry.
+func WithRegistry(ctx context.Context, registry *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, registry)
+}
+
+// FromContext returns Registry stored in ctx, or nil.
+func FromContext(ctx context.Context) *Registry {
+	registry, _ := ctx.Value(registryKey{}).(*Registry)
+	return registry
+}
+
+// Create adds new job. Oldest job is removed when registry is full.
+func (r *Registry) Create(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.order) >= r.maxJobs && len(r.order) > 0 {
+		delete(r.jobs, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.jobs[id] = &Job{
+		ID:        id,
+		Created:   time.Now(),
+		Artifacts: []*Artifact{},
+		Progress:  []*Progress{},
+	}
+	r.order = append(r.order, id)
+}
+
+// Remove removes job, e.g. when its task wasn't accepted.
+func (r *Registry) Remove(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.jobs[id]; !ok {
+		return
+	}
+	delete(r.jobs, id)
+	r.order = slices.DeleteFunc(r.order, func(orderID string) bool { return orderID == id })
+}
+
+// Get returns copy of job.
+func (r *Registry) Get(id string) (*Job, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	jobCopy := *j
+	jobCopy.Artifacts = append([]*Artifact{}, j.Artifacts...)
+	jobCopy.Progress = []*Progress{}
+	for _, progress := range j.Progress {
+		progressCopy := *progress
+		jobCopy.Progress = append(jobCopy.Progress, &progressCopy)
+	}
+	return &jobCopy, true
+}
+
+// AddArtifact adds artifact to job. Unknown jobs are ignored.
+func (r *Registry) AddArtifact(id string, artifact *Artifact) {
+	r.update(id, func(j *Job) {
+		j.Artifacts = append(j.Artifacts, artifact)
+	})
+}
+
+// SetFindings sets findings of artifacts with filePath. Unknown jobs are ignored.
+func (r *Registry) SetFindings(id, filePath string, findings []string) {
+	r.update(id, func(j *Job) {
+		for i, artifact := range j.Artifacts {
+			if artifact.FilePath == filePath {
+				// Artifacts are shared with copies returned by Get.
+				tagged := *artifact
+				tagged.Findings = findings
+				j.Artifacts[i] = &tagged
+			}
+		}
+	})
+}
+
+// SetProgress replaces progress of the same task and file, or adds new one. Unknown jobs are ignored.
+func (r *Registry) SetProgress(id string, progress *Progress) {
+	r.update(id, func(j *Job) {
+		for i, p := range j.Progress {
+			if p.Task == progress.Task && p.File == progress.File {
+				j.Progress[i] = progress
+				return
+			}
+		}
+		j.Progress = append(j.Progress, progress)
+	})
+}
+
+// Running returns copy of progress of every ffmpeg process which is still running.
+func (r *Registry) Running() []*Progress {
+	running := []*Progress{}
+	if r == nil {
+		return running
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range r.order {
+		for _, progress := range r.jobs[id].Progress {
+			if !progress.Done {
+				progressCopy := *progress
+				running = append(running, &progressCopy)
+			}
+		}
+	}
+	return running
+}
+
+// update calls fn for job with registry lock held. Unknown jobs are ignored.
+func (r *Registry) update(id string, fn func(*Job)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if j, ok := r.jobs[id]; ok {
+		fn(j)
+	}
+}
@@ -0,0 +1,109 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(2)
+
+	r.Create("a")
+	r.Create("b")
+	r.AddArtifact("a", &Artifact{Type: "burst", FilePath: "/data/a.mp4"})
+	r.AddArtifact("missing", &Artifact{Type: "burst", FilePath: "/data/missing.mp4"})
+
+	j, ok := r.Get("a")
+	require.True(t, ok)
+	require.Equal(t, "a", j.ID)
+	require.Equal(t, []*Artifact{{Type: "burst", FilePath: "/data/a.mp4"}}, j.Artifacts)
+
+	// Returned job is a copy.
+	j.Artifacts = append(j.Artifacts, &Artifact{Type: "preview"})
+	j, _ = r.Get("a")
+	require.Equal(t, 1, len(j.Artifacts))
+
+	// Oldest job is removed.
+	r.Create("c")
+	_, ok = r.Get("a")
+	require.False(t, ok)
+	_, ok = r.Get("b")
+	require.True(t, ok)
+	_, ok = r.Get("c")
+	require.True(t, ok)
+
+	// Removed job doesn't take place of other jobs.
+	r.Remove("c")
+	_, ok = r.Get("c")
+	require.False(t, ok)
+	r.Create("d")
+	_, ok = r.Get("b")
+	require.True(t, ok)
+}
+
+func TestRegistryFindings(t *testing.T) {
+	r := NewRegistry(2)
+	r.Create("a")
+	r.AddArtifact("a", &Artifact{Type: "burst", FilePath: "/data/a-001.mp4"})
+	r.AddArtifact("a", &Artifact{Type: "thumbnail", FilePath: "/data/a-001.jpg"})
+	before, _ := r.Get("a")
+
+	r.SetFindings("a", "/data/a-001.mp4", []string{"black"})
+	r.SetFindings("missing", "/data/a-001.mp4", []string{"black"})
+
+	j, _ := r.Get("a")
+	require.Equal(t, []*Artifact{
+		{Type: "burst", FilePath: "/data/a-001.mp4", Findings: []string{"black"}},
+		{Type: "thumbnail", FilePath: "/data/a-001.jpg"},
+	}, j.Artifacts)
+	// Copies returned before are not changed.
+	require.Nil(t, before.Artifacts[0].Findings)
+}
+
+func TestRegistryProgress(t *testing.T) {
+	r := NewRegistry(2)
+	r.Create("a")
+	r.Create("b")
+
+	r.SetProgress("a", &Progress{Task: "record", File: "/data/a-001.mp4", OutTime: 1})
+	r.SetProgress("a", &Progress{Task: "record", File: "/data/a-002.mp4", OutTime: 1})
+	r.SetProgress("a", &Progress{Task: "record", File: "/data/a-001.mp4", OutTime: 5})
+	r.SetProgress("b", &Progress{Task: "convert", File: "/data/b.mp4", OutTime: 10, Done: true})
+	r.SetProgress("missing", &Progress{Task: "record", File: "/data/missing.mp4"})
+
+	j, _ := r.Get("a")
+	require.Equal(t, []*Progress{
+		{Task: "record", File: "/data/a-001.mp4", OutTime: 5},
+		{Task: "record", File: "/data/a-002.mp4", OutTime: 1},
+	}, j.Progress)
+
+	// Returned progress is a copy.
+	j.Progress[0].OutTime = 0
+	j, _ = r.Get("a")
+	require.Equal(t, float64(5), j.Progress[0].OutTime)
+
+	require.Equal(t, []*Progress{
+		{Task: "record", File: "/data/a-001.mp4", OutTime: 5},
+		{Task: "record", File: "/data/a-002.mp4", OutTime: 1},
+	}, r.Running())
+}
+
+func TestNilRegistry(t *testing.T) {
+	r := FromContext(context.Background())
+	require.Nil(t, r)
+
+	r.Create("a")
+	r.AddArtifact("a", &Artifact{Type: "burst"})
+	r.Remove("a")
+	r.SetProgress("a", &Progress{Task: "record"})
+	_, ok := r.Get("a")
+	require.False(t, ok)
+	require.Equal(t, []*Progress{}, r.Running())
+}
+
+func TestFromContext(t *testing.T) {
+	r := NewRegistry(1)
+	require.Equal(t, r, FromContext(WithRegistry(context.Background(), r)))
+}
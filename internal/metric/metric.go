@@ -4,7 +4,9 @@ import (
 	"log"
 	"time"
 
+	"recorder/internal/job"
 	"recorder/internal/pool"
+	"recorder/internal/task"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -22,17 +24,107 @@ var (
 		Name: "working_pool_work_backlog",
 		Help: "Number of tasks waiting in working pool",
 	}, []string{"pool"})
+	ffmpegOutTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ffmpeg_out_time_seconds",
+		Help: "Output time written by running ffmpeg process",
+	}, []string{"task", "file"})
+	ffmpegFPS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ffmpeg_fps",
+		Help: "Frames per second processed by running ffmpeg process",
+	}, []string{"task", "file"})
+	ffmpegSpeed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ffmpeg_speed",
+		Help: "Processing speed of running ffmpeg process, relative to realtime",
+	}, []string{"task", "file"})
+	ffmpegBitrate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ffmpeg_bitrate_kbps",
+		Help: "Output bitrate of running ffmpeg process",
+	}, []string{"task", "file"})
+	ffmpegDroppedFrames = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ffmpeg_dropped_frames",
+		Help: "Frames dropped by running ffmpeg process",
+	}, []string{"task", "file"})
+	ffmpegErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ffmpeg_errors_total",
+		Help: "Total number of ffmpeg failures by error class",
+	}, []string{"task", "class"})
+	recordGaps = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "record_gaps_total",
+		Help: "Total number of gaps in stitched recordings",
+	}, []string{"cam_name"})
+	recordGapSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "record_gap_seconds_total",
+		Help: "Total length of gaps in stitched recordings",
+	}, []string{"cam_name"})
+	recordSourceFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "record_source_failures_total",
+		Help: "Total number of failed stream sources",
+	}, []string{"cam_name", "source"})
+	ingestConsumers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ingest_consumers",
+		Help: "Recordings reading shared upstream connection",
+	}, []string{"source"})
+	ingestConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ingest_connections_total",
+		Help: "Total number of opened shared upstream connections",
+	}, []string{"source"})
+	analysisRecordings = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "analysis_recordings_total",
+		Help: "Total number of analyzed recordings",
+	}, []string{"cam_name"})
+	analysisBadRecordings = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "analysis_bad_recordings_total",
+		Help: "Total number of recordings with black, frozen or silent content",
+	}, []string{"cam_name"})
+	analysisBadStreak = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "analysis_bad_recordings_streak",
+		Help: "Number of bad recordings in a row",
+	}, []string{"cam_name"})
+	analysisFindings = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "analysis_findings_total",
+		Help: "Total number of recordings with finding",
+	}, []string{"cam_name", "finding"})
+	cameraUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "recorder_camera_up",
+		Help: "Whether camera stream could be probed by last health check",
+	}, []string{"cam_name"})
+	cameraLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "recorder_camera_latency_seconds",
+		Help: "Time to open camera stream during last successful health check",
+	}, []string{"cam_name"})
+	cameraLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "recorder_camera_last_success_timestamp_seconds",
+		Help: "Unix time of last successful health check of camera",
+	}, []string{"cam_name"})
 )
 
 func Initialize(opts *Options) {
 	prometheus.MustRegister(workingPoolErrors)
 	prometheus.MustRegister(workingPoolTaskInProgress)
 	prometheus.MustRegister(workingPoolWorkBacklog)
+	prometheus.MustRegister(ffmpegOutTime)
+	prometheus.MustRegister(ffmpegFPS)
+	prometheus.MustRegister(ffmpegSpeed)
+	prometheus.MustRegister(ffmpegBitrate)
+	prometheus.MustRegister(ffmpegDroppedFrames)
+	prometheus.MustRegister(ffmpegErrors)
+	prometheus.MustRegister(recordGaps)
+	prometheus.MustRegister(recordGapSeconds)
+	prometheus.MustRegister(recordSourceFailures)
+	prometheus.MustRegister(ingestConsumers)
+	prometheus.MustRegister(ingestConnections)
+	prometheus.MustRegister(analysisRecordings)
+	prometheus.MustRegister(analysisBadRecordings)
+	prometheus.MustRegister(analysisBadStreak)
+	prometheus.MustRegister(analysisFindings)
+	prometheus.MustRegister(cameraUp)
+	prometheus.MustRegister(cameraLatency)
+	prometheus.MustRegister(cameraLastSuccess)
 
-	go collect(opts.WorkingPools)
+	go collect(opts.WorkingPools, opts.Jobs, opts.Monitor)
 }
 
-func collect(workingPools map[string]*pool.Pool) {
+func collect(workingPools map[string]pool.Stats, jobs *job.Registry, monitor *task.Monitor) {
 	log.Printf("starting prometheus worker")
 	for {
 		for poolName, pool := range workingPools {
@@ -40,7 +132,64 @@ func collect(workingPools map[string]*pool.Pool) {
 			workingPoolTaskInProgress.WithLabelValues(poolName).Set(float64(pool.InProgress()))
 			workingPoolWorkBacklog.WithLabelValues(poolName).Set(float64(pool.WorkBacklog()))
 		}
+		collectProgress(jobs.Running())
+		for taskName, classes := range task.FFmpegErrors() {
+			for class, count := range classes {
+				ffmpegErrors.WithLabelValues(taskName, class).Set(float64(count))
+			}
+		}
+		for camName, gaps := range task.RecordGaps() {
+			recordGaps.WithLabelValues(camName).Set(float64(gaps.Gaps))
+			recordGapSeconds.WithLabelValues(camName).Set(gaps.Seconds)
+		}
+		for camName, sources := range task.SourceFailures() {
+			for source, count := range sources {
+				recordSourceFailures.WithLabelValues(camName, source).Set(float64(count))
+			}
+		}
+		for source, stats := range task.Ingests() {
+			ingestConsumers.WithLabelValues(source).Set(float64(stats.Consumers))
+			ingestConnections.WithLabelValues(source).Set(float64(stats.Connections))
+		}
+		for camName, stats := range task.Analyses() {
+			analysisRecordings.WithLabelValues(camName).Set(float64(stats.Recordings))
+			analysisBadRecordings.WithLabelValues(camName).Set(float64(stats.Bad))
+			analysisBadStreak.WithLabelValues(camName).Set(float64(stats.Streak))
+			for finding, count := range stats.Findings {
+				analysisFindings.WithLabelValues(camName, finding).Set(float64(count))
+			}
+		}
+		if monitor != nil {
+			collectCameraHealth(monitor.Health())
+		}
 
 		time.Sleep(5 * time.Second)
 	}
 }
+
+// collectProgress sets ffmpeg gauges of running processes, finished processes are removed.
+func collectProgress(running []*job.Progress) {
+	for _, gauge := range []*prometheus.GaugeVec{ffmpegOutTime, ffmpegFPS, ffmpegSpeed, ffmpegBitrate, ffmpegDroppedFrames} {
+		gauge.Reset()
+	}
+	for _, progress := range running {
+		ffmpegOutTime.WithLabelValues(progress.Task, progress.File).Set(progress.OutTime)
+		ffmpegFPS.WithLabelValues(progress.Task, progress.File).Set(progress.FPS)
+		ffmpegSpeed.WithLabelValues(progress.Task, progress.File).Set(progress.Speed)
+		ffmpegBitrate.WithLabelValues(progress.Task, progress.File).Set(progress.Bitrate)
+		ffmpegDroppedFrames.WithLabelValues(progress.Task, progress.File).Set(float64(progress.DroppedFrames))
+	}
+}
+
+// collectCameraHealth sets camera gauges, latency is kept from last successful check.
+func collectCameraHealth(health map[string]task.CameraHealth) {
+	for camName, h := range health {
+		if !h.Up {
+			cameraUp.WithLabelValues(camName).Set(0)
+			continue
+		}
+		cameraUp.WithLabelValues(camName).Set(1)
+		cameraLatency.WithLabelValues(camName).Set(float64(h.Latency) / 1000)
+		cameraLastSuccess.WithLabelValues(camName).Set(float64(h.LastSuccess.Unix()))
+	}
+}
@@ -1,9 +1,13 @@
 package metric
 
 import (
+	"recorder/internal/job"
 	"recorder/internal/pool"
+	"recorder/internal/task"
 )
 
 type Options struct {
-	WorkingPools map[string]*pool.Pool
+	WorkingPools map[string]pool.Stats
+	Jobs         *job.Registry
+	Monitor      *task.Monitor // Health of cameras, disabled when nil.
 }
@@ -0,0 +1,14 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+)
+
+// Options contains configurable options for the Pipeline.
+type Options struct {
+	Config     *viper.Viper    // Config with "pipeline" definition and stages options.
+	ResultSize int             // Number of stage results which will be queued for routing.
+	Ctx        context.Context // Base context for all stages, background by default.
+}
@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"recorder/internal/pool"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	factories = make(map[string]Factory)
+)
+
+// Factory builds stage named name. Stage options should be read from config.
+// Stage tasks should run with ctx, which carries values shared by whole pipeline.
+type Factory func(ctx context.Context, name string, config *viper.Viper) (Stage, error)
+
+// Register makes stage type available for pipeline definition.
+func Register(stageType string, factory Factory) {
+	factories[stageType] = factory
+}
+
+// Pipeline routes results between stages.
+type Pipeline struct {
+	stages   map[string]Stage
+	routes   map[string][]string
+	chResult chan *result
+}
+
+// New creates pipeline from "pipeline" config key.
+// Every stage is defined by its name, type (stage name by default) and list of next stages.
+func New(opts *Options) (*Pipeline, error) {
+	p := &Pipeline{
+		stages:   make(map[string]Stage),
+		routes:   make(map[string][]string),
+		chResult: make(chan *result, opts.ResultSize),
+	}
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for name := range opts.Config.GetStringMap("pipeline") {
+		stageType := opts.Config.GetString(fmt.Sprintf("pipeline.%s.type", name))
+		if stageType == "" {
+			stageType = name
+		}
+		factory, ok := factories[stageType]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s for stage %s", stageType, name)
+		}
+		stage, err := factory(ctx, name, opts.Config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create stage %s: %v", name, err)
+		}
+		p.stages[name] = stage
+		p.routes[name] = opts.Config.GetStringSlice(fmt.Sprintf("pipeline.%s.next", name))
+	}
+
+	for name, nextStages := range p.routes {
+		for _, nextStage := range nextStages {
+			if _, ok := p.stages[nextStage]; !ok {
+				return nil, fmt.Errorf("stage %s routes to unknown stage %s", name, nextStage)
+			}
+		}
+	}
+
+	for name, stage := range p.stages {
+		go stage.forward(name, p.chResult)
+	}
+
+	return p, nil
+}
+
+// Stage returns stage by its name.
+func (p *Pipeline) Stage(name string) (Stage, bool) {
+	stage, ok := p.stages[name]
+	return stage, ok
+}
+
+// Stats returns working pool stats for every stage.
+func (p *Pipeline) Stats() map[string]pool.Stats {
+	stats := make(map[string]pool.Stats)
+	for name, stage := range p.stages {
+		stats[name] = stage
+	}
+	return stats
+}
+
+// Route handles results from all stages.
+// Every result is passed to each next stage which is running and accepts result type.
+func (p *Pipeline) Route() {
+	for result := range p.chResult {
+		p.route(result)
+	}
+}
+
+// route passes single result to next stages.
+func (p *Pipeline) route(result *result) {
+	for _, name := range p.routes[result.stage] {
+		stage := p.stages[name]
+		if !stage.Running() {
+			continue
+		}
+		err := stage.Accept(result.value)
+		if errors.Is(err, ErrNotAccepted) {
+			continue
+		}
+		if err != nil {
+			log.Printf("unable to pass %T from %s to %s: %v", result.value, result.stage, name, err)
+		}
+	}
+}
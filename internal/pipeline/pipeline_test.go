@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"recorder/internal/pool"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		expectedStages []string
+		expectedErr    error
+	}{
+		{
+			inputConfig: `
+            pipeline:
+              record:
+                next: ["missing"]
+            `,
+			expectedErr: errors.New("stage record routes to unknown stage missing"),
+		},
+		{
+			inputConfig: `
+            pipeline:
+              unknown:
+                next: []
+            `,
+			expectedErr: errors.New("unknown type unknown for stage unknown"),
+		},
+		{
+			inputConfig: `
+            pipeline:
+              broken:
+                type: failing
+            `,
+			expectedErr: errors.New("unable to create stage broken: factory error"),
+		},
+		{
+			inputConfig: `
+            pipeline:
+              record:
+                next: ["upload", "upload_converted", "convert"]
+              upload:
+                next: ["upload"]
+              upload_converted:
+                type: upload
+                next: ["upload_converted"]
+              convert:
+                next: ["upload_converted"]
+            `,
+			expectedStages: []string{"convert", "record", "upload", "upload_converted"},
+		},
+	}
+
+	Register("failing", func(context.Context, string, *viper.Viper) (Stage, error) {
+		return nil, fmt.Errorf("factory error")
+	})
+	defer delete(factories, "failing")
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		p, err := New(&Options{Config: config})
+		require.Equal(t, test.expectedErr, err)
+		if test.expectedErr != nil {
+			continue
+		}
+
+		var stages []string
+		for name := range p.Stats() {
+			_, ok := p.Stage(name)
+			require.True(t, ok)
+			stages = append(stages, name)
+		}
+		require.ElementsMatch(t, test.expectedStages, stages)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	var chDone = make(chan string, 10)
+
+	Register("number", func(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+		return NewStage(&pool.Options{
+			NoWorkers:  config.GetInt(name + ".workers"),
+			PoolSize:   10,
+			ResultSize: 10,
+		}, func(in int) pool.Task[string] {
+			return func(ctx context.Context, chResult chan string) error {
+				chDone <- fmt.Sprintf("%s:%d", name, in)
+				chResult <- fmt.Sprint(in)
+				return nil
+			}
+		}), nil
+	})
+	Register("text", func(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+		return NewStage(&pool.Options{
+			NoWorkers:  config.GetInt(name + ".workers"),
+			PoolSize:   10,
+			ResultSize: 10,
+		}, func(in string) pool.Task[int] {
+			return func(ctx context.Context, chResult chan int) error {
+				chDone <- fmt.Sprintf("%s:%s", name, in)
+				return nil
+			}
+		}), nil
+	})
+	defer delete(factories, "number")
+	defer delete(factories, "text")
+
+	config := viper.New()
+	config.SetConfigType("yaml")
+	err := config.ReadConfig(bytes.NewBufferString(`
+    pipeline:
+      source:
+        type: number
+        next: ["number", "text", "disabled"]
+      number:
+        next: ["text"]
+      text:
+        next: []
+      disabled:
+        type: text
+    source:
+      workers: 1
+    number:
+      workers: 1
+    text:
+      workers: 1
+    `))
+	require.Nil(t, err)
+
+	p, err := New(&Options{Config: config, ResultSize: 10})
+	require.Nil(t, err)
+	go p.Route()
+	time.Sleep(10 * time.Millisecond)
+
+	source, _ := p.Stage("source")
+	require.Nil(t, source.Accept(1))
+	number, _ := p.Stage("number")
+	require.Nil(t, number.Accept(2))
+
+	var done []string
+	for range 4 {
+		select {
+		case d := <-chDone:
+			done = append(done, d)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for routed tasks")
+		}
+	}
+	// number stage doesn't accept string results, disabled stage has no workers.
+	time.Sleep(10 * time.Millisecond)
+	require.ElementsMatch(t, []string{"source:1", "text:1", "number:2", "text:2"}, done)
+	require.Equal(t, 0, len(chDone))
+}
@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"errors"
+
+	"recorder/internal/pool"
+)
+
+var (
+	// ErrNotAccepted is returned when stage is not able to handle given input.
+	ErrNotAccepted = errors.New("input not accepted by stage")
+)
+
+// Stage is single pipeline step backed by working pool.
+type Stage interface {
+	pool.Stats
+	// Accept builds task from input and adds it to stage working pool.
+	Accept(input any) error
+	// forward publishes all stage results to chResult.
+	forward(name string, chResult chan<- *result)
+}
+
+// result describes output of stage which should be routed to next stages.
+type result struct {
+	stage string
+	value any
+}
+
+// stage is Stage which handles inputs of type In and publishes results of type Out.
+type stage[In, Out any] struct {
+	*pool.Pool[Out]
+	build func(In) pool.Task[Out]
+}
+
+// NewStage creates Stage with new working pool.
+// build is used to create task for every accepted input, it can return nil
+// when input should be skipped by stage.
+func NewStage[In, Out any](opts *pool.Options, build func(In) pool.Task[Out]) Stage {
+	return &stage[In, Out]{
+		Pool:  pool.New[Out](opts),
+		build: build,
+	}
+}
+
+// Accept adds task to working pool when input type is supported by stage.
+func (s *stage[In, Out]) Accept(input any) error {
+	in, ok := input.(In)
+	if !ok {
+		return ErrNotAccepted
+	}
+	t := s.build(in)
+	if t == nil {
+		return ErrNotAccepted
+	}
+	return s.Execute(t)
+}
+
+// forward publishes results from working pool to pipeline router.
+func (s *stage[In, Out]) forward(name string, chResult chan<- *result) {
+	for value := range s.ResultChan() {
+		chResult <- &result{stage: name, value: value}
+	}
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"recorder/internal/pool"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageAccept(t *testing.T) {
+	tests := []struct {
+		inputOptions    *pool.Options
+		inputValues     []any
+		expectedErrors  []error
+		expectedResults []string
+	}{
+		{
+			inputOptions:   &pool.Options{NoWorkers: 1, PoolSize: 3, ResultSize: 3},
+			inputValues:    []any{1, "text", 3.0},
+			expectedErrors: []error{ErrNotAccepted, nil, ErrNotAccepted},
+			expectedResults: []string{
+				"text",
+			},
+		},
+		{
+			inputOptions:   &pool.Options{NoWorkers: 0, PoolSize: 1, ResultSize: 3},
+			inputValues:    []any{"a", "b"},
+			expectedErrors: []error{nil, fmt.Errorf("pool is full, unable to add new task")},
+		},
+	}
+
+	for _, test := range tests {
+		s := NewStage(test.inputOptions, func(in string) pool.Task[string] {
+			return func(ctx context.Context, chResult chan string) error {
+				chResult <- in
+				return nil
+			}
+		})
+		time.Sleep(10 * time.Millisecond)
+
+		for idx, value := range test.inputValues {
+			require.Equal(t, test.expectedErrors[idx], s.Accept(value))
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		chResult := make(chan *result, 3)
+		go s.forward("test", chResult)
+		for _, expectedResult := range test.expectedResults {
+			require.Equal(t, &result{stage: "test", value: expectedResult}, <-chResult)
+		}
+	}
+}
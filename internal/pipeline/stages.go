@@ -0,0 +1,587 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"recorder/internal/pool"
+	"recorder/internal/task"
+
+	"github.com/spf13/viper"
+)
+
+// stageIngests keeps shared connections of record stages by stage name, snapshots of the stage grab from them.
+var stageIngests sync.Map
+
+// Built-in stage types.
+func init() {
+	Register("record", newRecordStage)
+	Register("upload", newUploadStage)
+	Register("convert", newConvertStage)
+	Register("thumbnail", newThumbnailStage)
+	Register("preview", newPreviewStage)
+	Register("analyze", newAnalyzeStage)
+	Register("webhook", newWebhookStage)
+}
+
+// newRecordStage creates stage which records requested stream.
+// It accepts *task.Record.
+func newRecordStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	masks, err := cameraMasks(config)
+	if err != nil {
+		return nil, err
+	}
+	naming, err := fileNaming(config)
+	if err != nil {
+		return nil, err
+	}
+	container := config.GetString(name + ".container")
+	containers := config.GetStringMapString(name + ".containers")
+	for _, containerName := range append(slices.Collect(maps.Values(containers)), container) {
+		if _, ok := task.LookupContainer(containerName); containerName != "" && !ok {
+			return nil, fmt.Errorf("unknown container %s, supported: %s", containerName, strings.Join(task.ContainerNames(), ", "))
+		}
+	}
+	validation, err := recordValidation(name, config)
+	if err != nil {
+		return nil, err
+	}
+	reconnect, err := recordReconnect(name, config)
+	if err != nil {
+		return nil, err
+	}
+	namedStreams, err := recordNamedStreams(name, config)
+	if err != nil {
+		return nil, err
+	}
+	ingest, err := recordIngest(name, config)
+	if err != nil {
+		return nil, err
+	}
+	if ingest != nil {
+		stageIngests.Store(name, ingest)
+		go func() {
+			<-ctx.Done()
+			ingest.Close()
+		}()
+	}
+	burstMode := config.GetString(name + ".burst_mode")
+	if burstMode != "" && burstMode != task.BurstModeOverlap && burstMode != task.BurstModeSegment {
+		return nil, fmt.Errorf("unknown burst mode %s, supported: %s, %s", burstMode, task.BurstModeOverlap, task.BurstModeSegment)
+	}
+	// Segmenter records all bursts with single ffmpeg, single burst can't be recorded again.
+	if burstMode == task.BurstModeSegment && (reconnect != nil || (validation != nil && validation.Retries > 0)) {
+		return nil, fmt.Errorf("burst mode %s doesn't support reconnect and validate retries", task.BurstModeSegment)
+	}
+	applyMasks := config.GetBool(name + ".masks")
+	outputArgs := config.GetStringMapString(name + ".output_args")
+	if codec := outputArgs["c:v"]; applyMasks && (codec == "" || codec == "copy") {
+		return nil, fmt.Errorf("applying masks requires re-encoding, c:v is %q", codec)
+	}
+
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   100,
+		ResultSize: 100,
+		Ctx: task.WithConfig(ctx, &task.RecordConfig{
+			OutputDir:       config.GetString(name + ".dir"),
+			InputArgs:       config.GetStringMapString(name + ".input_args"),
+			OutputArgs:      outputArgs,
+			Naming:          naming,
+			Container:       container,
+			Containers:      containers,
+			Masks:           masks,
+			ApplyMasks:      applyMasks,
+			Finalize:        config.GetBool(name + ".finalize"),
+			Validation:      validation,
+			StallTimeout:    config.GetInt(name + ".stall_timeout"),
+			Reconnect:       reconnect,
+			Streams:         config.GetStringMapStringSlice(name + ".streams"),
+			FailoverTimeout: config.GetInt(name + ".failover_timeout"),
+			NamedStreams:    namedStreams,
+			Ingest:          ingest,
+			BurstMode:       burstMode,
+		}),
+	}, func(r *task.Record) pool.Task[task.RecordResult] {
+		return r.Do
+	}), nil
+}
+
+// newUploadStage creates stage which uploads files to remote sftp server.
+// It accepts task.Uploadable, but only artifacts listed in upload policy are uploaded.
+// Named streams can have their own policy, other streams use the default one.
+// When require_masks is set, files missing privacy masks are not uploaded.
+func newUploadStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	artifacts := config.GetStringSlice(name + ".artifacts")
+	streamArtifacts := config.GetStringMapStringSlice(name + ".streams")
+	for _, artifact := range slices.Concat(append(slices.Collect(maps.Values(streamArtifacts)), artifacts)...) {
+		if artifact != task.ArtifactBursts && artifact != task.ArtifactConverted {
+			return nil, fmt.Errorf("unknown upload artifact %s", artifact)
+		}
+	}
+
+	requireMasks := config.GetBool(name + ".require_masks")
+	naming, err := fileNaming(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   150,
+		ResultSize: 150,
+		Ctx: task.WithConfig(ctx, &task.UploadConfig{
+			SSHUser:   config.GetString("ssh.user"),
+			SSHKey:    config.GetString("ssh.key"),
+			SSHServer: config.GetString("ssh.server"),
+			Timeout:   config.GetInt(name + ".timeout"),
+			MaxError:  config.GetInt(name + ".max_errors"),
+			Naming:    naming,
+		}),
+	}, func(r task.Uploadable) pool.Task[*task.UploadResult] {
+		tUpload := r.UploadTask()
+		if tUpload == nil || (requireMasks && tUpload.Unmasked) {
+			return nil
+		}
+		policy, ok := streamArtifacts[tUpload.StreamName]
+		if !ok || tUpload.StreamName == "" {
+			policy = artifacts
+		}
+		if !slices.Contains(policy, tUpload.Artifact) {
+			return nil
+		}
+		return tUpload.Do
+	}), nil
+}
+
+// newConvertStage creates stage which converts all bursts from recording.
+// It accepts *task.MultipleRecordResult.
+func newConvertStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	profiles, err := convertProfiles(name, config)
+	if err != nil {
+		return nil, err
+	}
+	masks, err := cameraMasks(config)
+	if err != nil {
+		return nil, err
+	}
+	// Masks are applied to every profile.
+	if len(masks) > 0 {
+		for _, profile := range profiles {
+			codec := profile.OutputArgs["c:v"]
+			if codec == "" {
+				codec = profile.OutputArgs["c"]
+			}
+			if codec == "copy" {
+				return nil, fmt.Errorf("convert profile %s: applying masks requires re-encoding, c:v is %q", profile.Name, codec)
+			}
+		}
+	}
+	naming, err := fileNaming(config)
+	if err != nil {
+		return nil, err
+	}
+	// Profiles can't share file name.
+	if len(profiles) > 1 {
+		if err := task.ValidateTemplate(naming.Convert, "suffix"); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   30,
+		ResultSize: 30,
+		Ctx: task.WithConfig(ctx, &task.ConvertConfig{
+			OutputDir:    config.GetString(name + ".dir"),
+			Naming:       naming,
+			Profiles:     profiles,
+			Masks:        masks,
+			StallTimeout: config.GetInt(name + ".stall_timeout"),
+		}),
+	}, func(r *task.MultipleRecordResult) pool.Task[task.ConvertOutput] {
+		return r.ConvertTask().Do
+	}), nil
+}
+
+// convertProfiles reads convert profiles from config.
+// When profiles are not defined, single profile is created from input_args and output_args.
+// Profiles without input_args use stage input_args.
+// Overlay defaults to bottom-left corner, 24px font and local timezone.
+func convertProfiles(name string, config *viper.Viper) ([]task.ConvertProfile, error) {
+	var profiles []task.ConvertProfile
+	if err := config.UnmarshalKey(name+".profiles", &profiles); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		profiles = append(profiles, task.ConvertProfile{
+			Name:       "convert",
+			InputArgs:  config.GetStringMapString(name + ".input_args"),
+			OutputArgs: config.GetStringMapString(name + ".output_args"),
+		})
+	}
+
+	names := make(map[string]bool)
+	fileNames := make(map[string]bool)
+	for i := range profiles {
+		profile := &profiles[i]
+		if profile.Name == "" {
+			return nil, fmt.Errorf("convert profile %d is missing name", i)
+		}
+		if profile.InputArgs == nil {
+			profile.InputArgs = config.GetStringMapString(name + ".input_args")
+		}
+		if profile.Suffix == "" {
+			profile.Suffix = profile.Name
+		}
+		if profile.Container == "" {
+			profile.Container = "mp4"
+		}
+		if overlay := profile.Overlay; overlay != nil {
+			if overlay.FontSize == 0 {
+				overlay.FontSize = 24
+			}
+			if overlay.Position == "" {
+				overlay.Position = "bottom-left"
+			}
+			if overlay.Timezone == "" {
+				overlay.Timezone = "Local"
+			}
+			if err := overlay.Validate(); err != nil {
+				return nil, fmt.Errorf("convert profile %s: %v", profile.Name, err)
+			}
+		}
+		fileName := profile.Suffix + "." + profile.FileExt()
+		if names[profile.Name] || fileNames[fileName] {
+			return nil, fmt.Errorf("convert profile %s is not unique", profile.Name)
+		}
+		names[profile.Name] = true
+		fileNames[fileName] = true
+	}
+	return profiles, nil
+}
+
+// fileNaming reads naming templates from "naming" config key.
+// Templates which are not defined keep default layout.
+func fileNaming(config *viper.Viper) (*task.Naming, error) {
+	naming := &task.Naming{
+		Record:   config.GetString("naming.record"),
+		Convert:  config.GetString("naming.convert"),
+		Remote:   config.GetString("naming.remote"),
+		Snapshot: config.GetString("naming.snapshot"),
+	}
+	if naming.Record == "" {
+		naming.Record = task.DefaultRecordTemplate
+	}
+	if naming.Convert == "" {
+		naming.Convert = task.DefaultConvertTemplate
+	}
+	if naming.Remote == "" {
+		naming.Remote = task.DefaultRemoteTemplate
+	}
+	if naming.Snapshot == "" {
+		naming.Snapshot = task.DefaultSnapshotTemplate
+	}
+
+	// Every burst needs its own file.
+	if err := task.ValidateTemplate(naming.Record, "burst"); err != nil {
+		return nil, err
+	}
+	if err := task.ValidateTemplate(naming.Convert); err != nil {
+		return nil, err
+	}
+	// Bursts, converted files, thumbnails and previews share the rest of placeholders.
+	if err := task.ValidateTemplate(naming.Remote, "file"); err != nil {
+		return nil, err
+	}
+	if err := task.ValidateTemplate(naming.Snapshot); err != nil {
+		return nil, err
+	}
+
+	timezone := config.GetString("naming.timezone")
+	if timezone == "" {
+		timezone = "Local"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown naming timezone %s", timezone)
+	}
+	naming.Location = location
+	return naming, nil
+}
+
+// recordValidation reads validation of bursts from "<name>.validate" config key.
+// It returns nil when validation is disabled.
+func recordValidation(name string, config *viper.Viper) (*task.Validation, error) {
+	if !config.GetBool(name + ".validate.enabled") {
+		return nil, nil
+	}
+	validation := &task.Validation{
+		Tolerance: config.GetFloat64(name + ".validate.tolerance"),
+		Codecs:    config.GetStringSlice(name + ".validate.codecs"),
+		MinBytes:  config.GetInt64(name + ".validate.min_bytes"),
+		Retries:   config.GetInt(name + ".validate.retries"),
+	}
+	if validation.Tolerance < 0 || validation.MinBytes < 0 || validation.Retries < 0 {
+		return nil, fmt.Errorf("validate tolerance, min_bytes and retries can't be negative")
+	}
+	return validation, nil
+}
+
+// recordReconnect reads reconnects of dropped streams from "<name>.reconnect" config key.
+// It returns nil when reconnect is disabled.
+func recordReconnect(name string, config *viper.Viper) (*task.Reconnect, error) {
+	if !config.GetBool(name + ".reconnect.enabled") {
+		return nil, nil
+	}
+	reconnect := &task.Reconnect{
+		Attempts: config.GetInt(name + ".reconnect.attempts"),
+		Delay:    config.GetInt(name + ".reconnect.delay"),
+	}
+	if reconnect.Attempts < 1 || reconnect.Delay < 0 {
+		return nil, fmt.Errorf("reconnect attempts should be bigger than 0 and delay can't be negative")
+	}
+	return reconnect, nil
+}
+
+// recordIngest reads shared upstream connections from "<name>.ingest" config key.
+func recordIngest(name string, config *viper.Viper) (*task.Ingest, error) {
+	if !config.GetBool(name + ".ingest.enabled") {
+		return nil, nil
+	}
+	ingest := &task.Ingest{
+		Dir:          config.GetString(name + ".ingest.dir"),
+		IdleTimeout:  config.GetInt(name + ".ingest.idle_timeout"),
+		ReadyTimeout: config.GetInt(name + ".ingest.ready_timeout"),
+		SegmentTime:  config.GetInt(name + ".ingest.segment_time"),
+		ListSize:     config.GetInt(name + ".ingest.list_size"),
+		StallTimeout: config.GetInt(name + ".stall_timeout"),
+	}
+	if ingest.Dir == "" {
+		return nil, fmt.Errorf("ingest dir is required")
+	}
+	if ingest.IdleTimeout < 0 || ingest.ReadyTimeout < 1 || ingest.SegmentTime < 1 || ingest.ListSize < 1 {
+		return nil, fmt.Errorf("ingest idle_timeout can't be negative, ready_timeout, segment_time and list_size should be bigger than 0")
+	}
+	return ingest, nil
+}
+
+// recordNamedStreams reads streams recorded in sync for each event from "<name>.named_streams" config key.
+func recordNamedStreams(name string, config *viper.Viper) (map[string]map[string]string, error) {
+	namedStreams := make(map[string]map[string]string)
+	if err := config.UnmarshalKey(name+".named_streams", &namedStreams); err != nil {
+		return nil, err
+	}
+	for camName, streams := range namedStreams {
+		for streamName, stream := range streams {
+			if stream == "" {
+				return nil, fmt.Errorf("named stream %s of camera %s has no url", streamName, camName)
+			}
+		}
+	}
+	return namedStreams, nil
+}
+
+// NewProbeConfig reads probe of streams recorded by stage name, streams are probed with input args of the stage.
+func NewProbeConfig(name string, config *viper.Viper) (*task.ProbeConfig, error) {
+	namedStreams, err := recordNamedStreams(name, config)
+	if err != nil {
+		return nil, err
+	}
+	timeout := config.GetInt("probe.timeout")
+	if timeout < 1 {
+		return nil, fmt.Errorf("probe timeout should be bigger than 0")
+	}
+	return &task.ProbeConfig{
+		InputArgs:    config.GetStringMapString(name + ".input_args"),
+		Timeout:      timeout,
+		Streams:      config.GetStringMapStringSlice(name + ".streams"),
+		NamedStreams: namedStreams,
+	}, nil
+}
+
+// NewMonitor reads health monitor of cameras recorded by stage name from "monitor" config key.
+// It returns nil when monitor is disabled.
+func NewMonitor(name string, config *viper.Viper) (*task.Monitor, error) {
+	if !config.GetBool("monitor.enabled") {
+		return nil, nil
+	}
+	probeConfig, err := NewProbeConfig(name, config)
+	if err != nil {
+		return nil, err
+	}
+	monitor := &task.Monitor{
+		Probe:     probeConfig,
+		Interval:  config.GetInt("monitor.interval"),
+		Readiness: config.GetBool("monitor.readiness"),
+	}
+	if monitor.Interval < 1 {
+		return nil, fmt.Errorf("monitor interval should be bigger than 0")
+	}
+	return monitor, nil
+}
+
+// NewSnapshots reads snapshots of cameras recorded by stage name from "snapshot" config key.
+// Frames are grabbed with input args of the stage and saved into its dir.
+// Ingest of the stage is shared, so snapshots should be created after pipeline.
+func NewSnapshots(name string, config *viper.Viper) (*task.Snapshots, error) {
+	namedStreams, err := recordNamedStreams(name, config)
+	if err != nil {
+		return nil, err
+	}
+	naming, err := fileNaming(config)
+	if err != nil {
+		return nil, err
+	}
+	masks, err := cameraMasks(config)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := &task.Snapshots{
+		InputArgs:       config.GetStringMapString(name + ".input_args"),
+		Streams:         config.GetStringMapStringSlice(name + ".streams"),
+		NamedStreams:    namedStreams,
+		FailoverTimeout: config.GetInt(name + ".failover_timeout"),
+		Cache:           config.GetInt("snapshot.cache"),
+		Concurrency:     config.GetInt("snapshot.concurrency"),
+		Timeout:         config.GetInt("snapshot.timeout"),
+		Width:           config.GetInt("snapshot.width"),
+		Masks:           masks,
+		OutputDir:       config.GetString(name + ".dir"),
+		Prefix:          config.GetString("snapshot.prefix"),
+		Naming:          naming,
+	}
+	if ingest, ok := stageIngests.Load(name); ok {
+		snapshots.Ingest = ingest.(*task.Ingest)
+	}
+	if snapshots.Cache < 0 || snapshots.Width < 0 || snapshots.Concurrency < 1 || snapshots.Timeout < 1 {
+		return nil, fmt.Errorf("snapshot cache and width can't be negative, concurrency and timeout should be bigger than 0")
+	}
+	if snapshots.Prefix == "" {
+		return nil, fmt.Errorf("snapshot prefix is required")
+	}
+	return snapshots, nil
+}
+
+// cameraMasks reads privacy masks of every camera from "masks" config key.
+func cameraMasks(config *viper.Viper) (map[string][]task.Mask, error) {
+	masks := make(map[string][]task.Mask)
+	if err := config.UnmarshalKey("masks", &masks); err != nil {
+		return nil, err
+	}
+	for camName, cameraMasks := range masks {
+		for i := range cameraMasks {
+			if err := cameraMasks[i].Validate(); err != nil {
+				return nil, fmt.Errorf("mask %d of camera %s: %v", i, camName, err)
+			}
+		}
+	}
+	return masks, nil
+}
+
+// newThumbnailStage creates stage which creates images for recorded and converted videos.
+// It accepts task.Thumbnailable.
+func newThumbnailStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   100,
+		ResultSize: 100,
+		Ctx: task.WithConfig(ctx, &task.ThumbnailConfig{
+			Offset: config.GetFloat64(name + ".offset"),
+			Frames: config.GetInt(name + ".frames"),
+			Width:  config.GetInt(name + ".width"),
+		}),
+	}, func(r task.Thumbnailable) pool.Task[*task.ThumbnailResult] {
+		return r.ThumbnailTask().Do
+	}), nil
+}
+
+// newPreviewStage creates stage which creates animated previews for recorded and converted videos.
+// It accepts task.Previewable.
+func newPreviewStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	format := config.GetString(name + ".format")
+	if format != task.PreviewFormatGIF && format != task.PreviewFormatWebP {
+		return nil, fmt.Errorf("unknown preview format %s", format)
+	}
+	mode := config.GetString(name + ".mode")
+	if mode != task.PreviewModeFirst && mode != task.PreviewModeSpeedup {
+		return nil, fmt.Errorf("unknown preview mode %s", mode)
+	}
+	masks, err := cameraMasks(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   100,
+		ResultSize: 100,
+		Ctx: task.WithConfig(ctx, &task.PreviewConfig{
+			Format:   format,
+			Mode:     mode,
+			Length:   config.GetInt(name + ".length"),
+			Width:    config.GetInt(name + ".width"),
+			FPS:      config.GetInt(name + ".fps"),
+			MaxBytes: config.GetInt64(name + ".max_bytes"),
+			Masks:    masks,
+		}),
+	}, func(r task.Previewable) pool.Task[*task.PreviewResult] {
+		return r.PreviewTask().Do
+	}), nil
+}
+
+// newAnalyzeStage creates stage which checks recorded and converted videos for black, frozen and silent content.
+// It accepts task.Analyzable.
+func newAnalyzeStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	analyzeConfig := &task.AnalyzeConfig{
+		Black:         config.GetFloat64(name + ".black"),
+		Freeze:        config.GetFloat64(name + ".freeze"),
+		FreezeNoise:   config.GetString(name + ".freeze_noise"),
+		Silence:       config.GetFloat64(name + ".silence"),
+		SilenceNoise:  config.GetString(name + ".silence_noise"),
+		BadRecordings: config.GetInt(name + ".bad_recordings"),
+	}
+	if analyzeConfig.Black < 0 || analyzeConfig.Freeze < 0 || analyzeConfig.Silence < 0 || analyzeConfig.BadRecordings < 0 {
+		return nil, fmt.Errorf("analyze black, freeze, silence and bad_recordings can't be negative")
+	}
+	if analyzeConfig.Black == 0 && analyzeConfig.Freeze == 0 && analyzeConfig.Silence == 0 {
+		return nil, fmt.Errorf("analyze requires at least one of black, freeze and silence")
+	}
+	if (analyzeConfig.Freeze > 0 && analyzeConfig.FreezeNoise == "") || (analyzeConfig.Silence > 0 && analyzeConfig.SilenceNoise == "") {
+		return nil, fmt.Errorf("analyze freeze_noise and silence_noise are required")
+	}
+
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   100,
+		ResultSize: 100,
+		Ctx:        task.WithConfig(ctx, analyzeConfig),
+	}, func(r task.Analyzable) pool.Task[task.AnalyzeOutput] {
+		return r.AnalyzeTask().Do
+	}), nil
+}
+
+// newWebhookStage creates stage which delivers events to webhook URLs.
+// It accepts task.Notifiable.
+func newWebhookStage(ctx context.Context, name string, config *viper.Viper) (Stage, error) {
+	return NewStage(&pool.Options{
+		NoWorkers:  config.GetInt(name + ".workers"),
+		PoolSize:   100,
+		ResultSize: 1,
+		Ctx: task.WithConfig(ctx, &task.WebhookConfig{
+			URLs:    config.GetStringSlice(name + ".urls"),
+			Timeout: config.GetInt(name + ".timeout"),
+		}),
+	}, func(r task.Notifiable) pool.Task[struct{}] {
+		tWebhook := r.WebhookTask()
+		if tWebhook == nil {
+			return nil
+		}
+		return tWebhook.Do
+	}), nil
+}
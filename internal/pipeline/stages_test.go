@@ -0,0 +1,1106 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"recorder/internal/task"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUploadStage(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		inputValues    []any
+		expectedErr    error
+		expectedErrors []error
+	}{
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["bursts", "thumbnails"]
+            `,
+			expectedErr: errors.New("unknown upload artifact thumbnails"),
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["bursts"]
+            `,
+			inputValues: []any{
+				&task.SingleRecordResult{FileName: "a.mp4"},
+				&task.ConvertResult{FileName: "a-convert.mp4"},
+				&task.UploadResult{FileName: "b.mp4", Artifact: task.ArtifactBursts},
+				&task.MultipleRecordResult{},
+			},
+			expectedErrors: []error{nil, ErrNotAccepted, nil, ErrNotAccepted},
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["converted"]
+            `,
+			inputValues: []any{
+				&task.SingleRecordResult{FileName: "a.mp4"},
+				&task.ConvertResult{FileName: "a-convert.mp4"},
+				&task.UploadResult{FileName: "a-convert.mp4", Artifact: task.ArtifactConverted},
+			},
+			expectedErrors: []error{ErrNotAccepted, nil, nil},
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["bursts", "converted"]
+            `,
+			inputValues: []any{
+				&task.SingleRecordResult{FileName: "a.mp4"},
+				&task.ConvertResult{FileName: "a-convert.mp4"},
+				&task.ConvertResult{FileName: "a-preview.mp4", SkipUpload: true},
+			},
+			expectedErrors: []error{nil, nil, ErrNotAccepted},
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["bursts"]
+              require_masks: true
+            `,
+			inputValues: []any{
+				&task.SingleRecordResult{FileName: "a.mp4"},
+				&task.SingleRecordResult{FileName: "b.mp4", Unmasked: true},
+				&task.ThumbnailResult{FileName: "b.jpg", Artifact: task.ArtifactBursts, Unmasked: true},
+			},
+			expectedErrors: []error{nil, ErrNotAccepted, ErrNotAccepted},
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["bursts"]
+            `,
+			inputValues: []any{
+				&task.SingleRecordResult{FileName: "b.mp4", Unmasked: true},
+			},
+			expectedErrors: []error{nil},
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["converted"]
+              streams:
+                sub: ["bursts", "converted"]
+                main: []
+            `,
+			inputValues: []any{
+				&task.SingleRecordResult{FileName: "a.mp4"},
+				&task.SingleRecordResult{FileName: "a-sub.mp4", StreamName: "sub"},
+				&task.SingleRecordResult{FileName: "a-main.mp4", StreamName: "main"},
+				&task.ConvertResult{FileName: "a-main-convert.mp4", StreamName: "main"},
+				&task.ConvertResult{FileName: "a-other-convert.mp4", StreamName: "other"},
+				&task.UploadResult{FileName: "a-sub.mp4", Artifact: task.ArtifactBursts, StreamName: "sub"},
+			},
+			expectedErrors: []error{ErrNotAccepted, nil, ErrNotAccepted, ErrNotAccepted, nil, nil},
+		},
+		{
+			inputConfig: `
+            upload:
+              artifacts: ["bursts"]
+              streams:
+                sub: ["previews"]
+            `,
+			expectedErr: errors.New("unknown upload artifact previews"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		s, err := newUploadStage(context.Background(), "upload", config)
+		require.Equal(t, test.expectedErr, err)
+		if test.expectedErr != nil {
+			continue
+		}
+
+		for idx, value := range test.inputValues {
+			require.Equal(t, test.expectedErrors[idx], s.Accept(value))
+		}
+	}
+}
+
+func TestNewRecordStage(t *testing.T) {
+	tests := []struct {
+		inputConfig string
+		expectedErr error
+	}{
+		{
+			inputConfig: `
+            record:
+              output_args:
+                "c:v": copy
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              masks: true
+              output_args:
+                "c:v": copy
+            `,
+			expectedErr: errors.New(`applying masks requires re-encoding, c:v is "copy"`),
+		},
+		{
+			inputConfig: `
+            record:
+              masks: true
+              output_args:
+                "c:v": h264
+            masks:
+              cam1:
+                - type: blur
+                  rect: [0, 0, 100, 100]
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              output_args:
+                "c:v": copy
+            masks:
+              cam1:
+                - type: blur
+            `,
+			expectedErr: errors.New("mask 0 of camera cam1: mask requires either rect or polygon"),
+		},
+		{
+			inputConfig: `
+            record:
+              container: mkv
+              containers:
+                cam1: fmp4
+                cam2: ts
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              burst_mode: segment
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              burst_mode: segment
+              validate:
+                enabled: true
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              burst_mode: segment
+              validate:
+                enabled: true
+                retries: 1
+            `,
+			expectedErr: errors.New("burst mode segment doesn't support reconnect and validate retries"),
+		},
+		{
+			inputConfig: `
+            record:
+              burst_mode: segment
+              reconnect:
+                enabled: true
+                attempts: 3
+            `,
+			expectedErr: errors.New("burst mode segment doesn't support reconnect and validate retries"),
+		},
+		{
+			inputConfig: `
+            record:
+              burst_mode: gop
+            `,
+			expectedErr: errors.New("unknown burst mode gop, supported: overlap, segment"),
+		},
+		{
+			inputConfig: `
+            record:
+              container: avi
+            `,
+			expectedErr: errors.New("unknown container avi, supported: fmp4, mkv, mp4, ts"),
+		},
+		{
+			inputConfig: `
+            record:
+              containers:
+                cam1: webm
+            `,
+			expectedErr: errors.New("unknown container webm, supported: fmp4, mkv, mp4, ts"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		_, err := newRecordStage(context.Background(), "record", config)
+		require.Equal(t, test.expectedErr, err)
+	}
+}
+
+func TestFileNaming(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		expectedNaming *task.Naming
+		expectedErr    error
+	}{
+		{
+			inputConfig: `
+            record: {}
+            `,
+			expectedNaming: &task.Naming{
+				Record:   task.DefaultRecordTemplate,
+				Convert:  task.DefaultConvertTemplate,
+				Remote:   task.DefaultRemoteTemplate,
+				Snapshot: task.DefaultSnapshotTemplate,
+				Location: time.Local,
+			},
+		},
+		{
+			inputConfig: `
+            naming:
+              record: "{prefix}/{yyyy}/{mm}/{dd}/{hh}-{min}-{ss}-{cam}-{burst}.{ext}"
+              remote: "{cam}/{yyyy}-{mm}-{dd}/{file}"
+              timezone: UTC
+            `,
+			expectedNaming: &task.Naming{
+				Record:   "{prefix}/{yyyy}/{mm}/{dd}/{hh}-{min}-{ss}-{cam}-{burst}.{ext}",
+				Convert:  task.DefaultConvertTemplate,
+				Remote:   "{cam}/{yyyy}-{mm}-{dd}/{file}",
+				Snapshot: task.DefaultSnapshotTemplate,
+				Location: time.UTC,
+			},
+		},
+		{
+			inputConfig: `
+            naming:
+              record: "{prefix}/{yyyy}/{cam}.{ext}"
+            `,
+			expectedErr: errors.New(`template "{prefix}/{yyyy}/{cam}.{ext}" requires {burst} placeholder`),
+		},
+		{
+			inputConfig: `
+            naming:
+              remote: "{prefix}/{week}/{file}"
+            `,
+			expectedErr: errors.New(`unknown placeholder {week} in template "{prefix}/{week}/{file}"`),
+		},
+		{
+			inputConfig: `
+            naming:
+              remote: "{prefix}/{date}/{time}-{cam}-{burst}.{ext}"
+            `,
+			expectedErr: errors.New(`template "{prefix}/{date}/{time}-{cam}-{burst}.{ext}" requires {file} placeholder`),
+		},
+		{
+			inputConfig: `
+            naming:
+              timezone: Mars/Olympus
+            `,
+			expectedErr: errors.New("unknown naming timezone Mars/Olympus"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		naming, err := fileNaming(config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedNaming, naming)
+	}
+}
+
+func TestRecordValidation(t *testing.T) {
+	tests := []struct {
+		inputConfig        string
+		expectedValidation *task.Validation
+		expectedErr        error
+	}{
+		{
+			inputConfig: `
+            record:
+              validate:
+                tolerance: 2
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              validate:
+                enabled: true
+                tolerance: 1.5
+                codecs: ["h264", "hevc"]
+                min_bytes: 1024
+                retries: 2
+            `,
+			expectedValidation: &task.Validation{
+				Tolerance: 1.5,
+				Codecs:    []string{"h264", "hevc"},
+				MinBytes:  1024,
+				Retries:   2,
+			},
+		},
+		{
+			inputConfig: `
+            record:
+              validate:
+                enabled: true
+                retries: -1
+            `,
+			expectedErr: errors.New("validate tolerance, min_bytes and retries can't be negative"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		validation, err := recordValidation("record", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedValidation, validation)
+	}
+}
+
+func TestRecordReconnect(t *testing.T) {
+	tests := []struct {
+		inputConfig       string
+		expectedReconnect *task.Reconnect
+		expectedErr       error
+	}{
+		{
+			inputConfig: `
+            record:
+              reconnect:
+                attempts: 3
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              reconnect:
+                enabled: true
+                attempts: 3
+                delay: 1
+            `,
+			expectedReconnect: &task.Reconnect{Attempts: 3, Delay: 1},
+		},
+		{
+			inputConfig: `
+            record:
+              reconnect:
+                enabled: true
+                attempts: 0
+            `,
+			expectedErr: errors.New("reconnect attempts should be bigger than 0 and delay can't be negative"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		reconnect, err := recordReconnect("record", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedReconnect, reconnect)
+	}
+}
+
+func TestRecordIngest(t *testing.T) {
+	tests := []struct {
+		inputConfig    string
+		expectedIngest *task.Ingest
+		expectedErr    error
+	}{
+		{
+			inputConfig: `
+            record:
+              ingest:
+                dir: /tmp/ingest
+            `,
+		},
+		{
+			inputConfig: `
+            record:
+              stall_timeout: 10
+              ingest:
+                enabled: true
+                dir: /tmp/ingest
+                idle_timeout: 30
+                ready_timeout: 10
+                segment_time: 1
+                list_size: 10
+            `,
+			expectedIngest: &task.Ingest{Dir: "/tmp/ingest", IdleTimeout: 30, ReadyTimeout: 10, SegmentTime: 1, ListSize: 10, StallTimeout: 10},
+		},
+		{
+			inputConfig: `
+            record:
+              ingest:
+                enabled: true
+                idle_timeout: 30
+            `,
+			expectedErr: errors.New("ingest dir is required"),
+		},
+		{
+			inputConfig: `
+            record:
+              ingest:
+                enabled: true
+                dir: /tmp/ingest
+                ready_timeout: 10
+                segment_time: 0
+                list_size: 10
+            `,
+			expectedErr: errors.New("ingest idle_timeout can't be negative, ready_timeout, segment_time and list_size should be bigger than 0"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		ingest, err := recordIngest("record", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedIngest, ingest)
+	}
+}
+
+func TestRecordNamedStreams(t *testing.T) {
+	tests := []struct {
+		inputConfig          string
+		expectedNamedStreams map[string]map[string]string
+		expectedErr          error
+	}{
+		{
+			inputConfig: `
+            record:
+              dir: /tmp
+            `,
+			expectedNamedStreams: map[string]map[string]string{},
+		},
+		{
+			inputConfig: `
+            record:
+              named_streams:
+                cam1:
+                  main: rtsp://cam1/101
+                  sub: rtsp://cam1/102
+            `,
+			expectedNamedStreams: map[string]map[string]string{
+				"cam1": {"main": "rtsp://cam1/101", "sub": "rtsp://cam1/102"},
+			},
+		},
+		{
+			inputConfig: `
+            record:
+              named_streams:
+                cam1:
+                  main: ""
+            `,
+			expectedErr: errors.New("named stream main of camera cam1 has no url"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		namedStreams, err := recordNamedStreams("record", config)
+		require.Equal(t, test.expectedErr, err)
+		if test.expectedErr == nil {
+			require.Equal(t, test.expectedNamedStreams, namedStreams)
+		}
+	}
+}
+
+func TestNewProbeConfig(t *testing.T) {
+	tests := []struct {
+		inputConfig         string
+		expectedProbeConfig *task.ProbeConfig
+		expectedErr         error
+	}{
+		{
+			inputConfig: `
+            probe:
+              timeout: 0
+            `,
+			expectedErr: errors.New("probe timeout should be bigger than 0"),
+		},
+		{
+			inputConfig: `
+            probe:
+              timeout: 5
+            record:
+              input_args:
+                rtsp_transport: tcp
+              streams:
+                cam1: [rtsp://cam1/101, rtsp://cam1/102]
+              named_streams:
+                cam2:
+                  wide: rtsp://cam2/101
+            `,
+			expectedProbeConfig: &task.ProbeConfig{
+				InputArgs:    map[string]string{"rtsp_transport": "tcp"},
+				Timeout:      5,
+				Streams:      map[string][]string{"cam1": {"rtsp://cam1/101", "rtsp://cam1/102"}},
+				NamedStreams: map[string]map[string]string{"cam2": {"wide": "rtsp://cam2/101"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		probeConfig, err := NewProbeConfig("record", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedProbeConfig, probeConfig)
+	}
+}
+
+func TestNewMonitor(t *testing.T) {
+	tests := []struct {
+		inputConfig     string
+		expectedMonitor *task.Monitor
+		expectedErr     error
+	}{
+		{
+			inputConfig: `
+            monitor:
+              enabled: false
+            `,
+		},
+		{
+			inputConfig: `
+            monitor:
+              enabled: true
+              interval: 0
+            probe:
+              timeout: 10
+            `,
+			expectedErr: errors.New("monitor interval should be bigger than 0"),
+		},
+		{
+			inputConfig: `
+            monitor:
+              enabled: true
+              interval: 60
+              readiness: true
+            probe:
+              timeout: 10
+            record:
+              streams:
+                cam1: [rtsp://cam1/101]
+            `,
+			expectedMonitor: &task.Monitor{
+				Probe: &task.ProbeConfig{
+					InputArgs:    map[string]string{},
+					Timeout:      10,
+					Streams:      map[string][]string{"cam1": {"rtsp://cam1/101"}},
+					NamedStreams: map[string]map[string]string{},
+				},
+				Interval:  60,
+				Readiness: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		monitor, err := NewMonitor("record", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedMonitor, monitor)
+	}
+}
+
+func TestNewSnapshots(t *testing.T) {
+	tests := []struct {
+		inputConfig       string
+		expectedSnapshots *task.Snapshots
+		expectedErr       error
+	}{
+		{
+			inputConfig: `
+            snapshot:
+              cache: 5
+              concurrency: 0
+              timeout: 10
+              prefix: snapshot
+            `,
+			expectedErr: errors.New("snapshot cache and width can't be negative, concurrency and timeout should be bigger than 0"),
+		},
+		{
+			inputConfig: `
+            snapshot:
+              cache: 5
+              concurrency: 1
+              timeout: 10
+            `,
+			expectedErr: errors.New("snapshot prefix is required"),
+		},
+		{
+			inputConfig: `
+            naming:
+              snapshot: "{prefix}/{week}.{ext}"
+            snapshot:
+              cache: 5
+              concurrency: 1
+              timeout: 10
+              prefix: snapshot
+            `,
+			expectedErr: errors.New(`unknown placeholder {week} in template "{prefix}/{week}.{ext}"`),
+		},
+		{
+			inputConfig: `
+            naming:
+              timezone: UTC
+            snapshot:
+              cache: 5
+              concurrency: 2
+              timeout: 10
+              width: 640
+              prefix: snapshot
+            record:
+              dir: /data
+              input_args:
+                rtsp_transport: tcp
+              failover_timeout: 5
+              streams:
+                cam1: [rtsp://cam1/101]
+            masks:
+              cam1:
+                - type: black
+                  rect: [0, 0, 10, 10]
+            `,
+			expectedSnapshots: &task.Snapshots{
+				InputArgs:       map[string]string{"rtsp_transport": "tcp"},
+				Streams:         map[string][]string{"cam1": {"rtsp://cam1/101"}},
+				NamedStreams:    map[string]map[string]string{},
+				FailoverTimeout: 5,
+				Cache:           5,
+				Concurrency:     2,
+				Timeout:         10,
+				Width:           640,
+				Masks:           map[string][]task.Mask{"cam1": {{Type: task.MaskBlack, Rect: []int{0, 0, 10, 10}}}},
+				OutputDir:       "/data",
+				Prefix:          "snapshot",
+				Naming: &task.Naming{
+					Record:   task.DefaultRecordTemplate,
+					Convert:  task.DefaultConvertTemplate,
+					Remote:   task.DefaultRemoteTemplate,
+					Snapshot: task.DefaultSnapshotTemplate,
+					Location: time.UTC,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		snapshots, err := NewSnapshots("record", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedSnapshots, snapshots)
+	}
+}
+
+func TestNewSnapshotsIngest(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.Nil(t, config.ReadConfig(bytes.NewBufferString(`
+    snapshot:
+      concurrency: 1
+      timeout: 10
+      prefix: snapshot
+    live:
+      ingest:
+        enabled: true
+        dir: /tmp/ingest
+        ready_timeout: 10
+        segment_time: 1
+        list_size: 10
+    `)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := newRecordStage(ctx, "live", config)
+	require.Nil(t, err)
+
+	snapshots, err := NewSnapshots("live", config)
+	require.Nil(t, err)
+	require.Equal(t, &task.Ingest{Dir: "/tmp/ingest", ReadyTimeout: 10, SegmentTime: 1, ListSize: 10}, snapshots.Ingest)
+}
+
+func TestNewConvertStage(t *testing.T) {
+	tests := []struct {
+		inputConfig string
+		expectedErr error
+	}{
+		{
+			inputConfig: `
+            naming:
+              convert: "{prefix}/{date}/{time}-{cam}.{ext}"
+            convert:
+              profiles:
+                - name: archive
+                - name: preview
+                  container: mkv
+            `,
+			expectedErr: errors.New(`template "{prefix}/{date}/{time}-{cam}.{ext}" requires {suffix} placeholder`),
+		},
+		{
+			inputConfig: `
+            masks:
+              cam1:
+                - type: black
+                  rect: [0, 0, 10, 10]
+            convert:
+              profiles:
+                - name: archive
+                  output_args:
+                    "c:v": h264
+                - name: remux
+                  output_args:
+                    "c": copy
+            `,
+			expectedErr: errors.New(`convert profile remux: applying masks requires re-encoding, c:v is "copy"`),
+		},
+		{
+			inputConfig: `
+            masks:
+              cam1:
+                - type: black
+                  rect: [0, 0, 10, 10]
+            convert:
+              profiles:
+                - name: archive
+                  output_args:
+                    "c:v": h264
+            `,
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - name: remux
+                  output_args:
+                    "c:v": copy
+            `,
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		_, err := newConvertStage(context.Background(), "convert", config)
+		require.Equal(t, test.expectedErr, err)
+	}
+}
+
+func TestCameraMasks(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	require.Nil(t, config.ReadConfig(bytes.NewBufferString(`
+    masks:
+      cam1:
+        - type: blur
+          rect: [0, 0, 100, 50]
+        - type: black
+          polygon: [[0, 0], [10, 0], [5, 5]]
+      cam2:
+        - type: black
+          rect: [10, 10, 20, 20]
+    `)))
+
+	masks, err := cameraMasks(config)
+	require.Nil(t, err)
+	require.Equal(t, map[string][]task.Mask{
+		"cam1": {
+			{Type: task.MaskBlur, Rect: []int{0, 0, 100, 50}},
+			{Type: task.MaskBlack, Polygon: [][]int{{0, 0}, {10, 0}, {5, 5}}},
+		},
+		"cam2": {
+			{Type: task.MaskBlack, Rect: []int{10, 10, 20, 20}},
+		},
+	}, masks)
+}
+
+func TestConvertProfiles(t *testing.T) {
+	tests := []struct {
+		inputConfig      string
+		expectedProfiles []task.ConvertProfile
+		expectedErr      error
+	}{
+		{
+			inputConfig: `
+            convert:
+              input_args:
+                f: concat
+              output_args:
+                "c:v": h264
+            `,
+			expectedProfiles: []task.ConvertProfile{
+				{
+					Name:       "convert",
+					InputArgs:  map[string]string{"f": "concat"},
+					OutputArgs: map[string]string{"c:v": "h264"},
+					Suffix:     "convert",
+					Container:  "mp4",
+				},
+			},
+		},
+		{
+			inputConfig: `
+            convert:
+              input_args:
+                f: concat
+              profiles:
+                - name: archive
+                  output_args:
+                    "c:v": h264
+                - name: preview
+                  suffix: 480p
+                  container: mkv
+                  skip_upload: true
+                  input_args:
+                    f: concat
+                    safe: "0"
+                  output_args:
+                    vf: "scale=-2:480"
+            `,
+			expectedProfiles: []task.ConvertProfile{
+				{
+					Name:       "archive",
+					InputArgs:  map[string]string{"f": "concat"},
+					OutputArgs: map[string]string{"c:v": "h264"},
+					Suffix:     "archive",
+					Container:  "mp4",
+				},
+				{
+					Name:       "preview",
+					InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+					OutputArgs: map[string]string{"vf": "scale=-2:480"},
+					Suffix:     "480p",
+					Container:  "mkv",
+					SkipUpload: true,
+				},
+			},
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - output_args:
+                    "c:v": h264
+            `,
+			expectedErr: errors.New("convert profile 0 is missing name"),
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - name: archive
+                - name: convert
+                  suffix: archive
+            `,
+			expectedErr: errors.New("convert profile convert is not unique"),
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - name: archive
+                  suffix: video
+                - name: fragmented
+                  suffix: video
+                  container: fmp4
+            `,
+			expectedErr: errors.New("convert profile fragmented is not unique"),
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - name: evidence
+                  overlay: {}
+                - name: evidence-utc
+                  overlay:
+                    font_file: /usr/share/fonts/DejaVuSans.ttf
+                    font_size: 32
+                    position: top-right
+                    timezone: UTC
+            `,
+			expectedProfiles: []task.ConvertProfile{
+				{
+					Name:      "evidence",
+					InputArgs: map[string]string{},
+					Suffix:    "evidence",
+					Container: "mp4",
+					Overlay:   &task.ConvertOverlay{FontSize: 24, Position: "bottom-left", Timezone: "Local"},
+				},
+				{
+					Name:      "evidence-utc",
+					InputArgs: map[string]string{},
+					Suffix:    "evidence-utc",
+					Container: "mp4",
+					Overlay: &task.ConvertOverlay{
+						FontFile: "/usr/share/fonts/DejaVuSans.ttf",
+						FontSize: 32,
+						Position: "top-right",
+						Timezone: "UTC",
+					},
+				},
+			},
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - name: evidence
+                  overlay:
+                    position: middle
+            `,
+			expectedErr: errors.New("convert profile evidence: unknown overlay position middle"),
+		},
+		{
+			inputConfig: `
+            convert:
+              profiles:
+                - name: evidence
+                  overlay:
+                    timezone: Mars/Olympus
+            `,
+			expectedErr: errors.New("convert profile evidence: unknown overlay timezone Mars/Olympus"),
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		profiles, err := convertProfiles("convert", config)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedProfiles, profiles)
+	}
+}
+
+func TestNewPreviewStage(t *testing.T) {
+	tests := []struct {
+		inputConfig string
+		expectedErr error
+	}{
+		{
+			inputConfig: `
+            preview:
+              format: png
+              mode: first
+            `,
+			expectedErr: errors.New("unknown preview format png"),
+		},
+		{
+			inputConfig: `
+            preview:
+              format: gif
+              mode: slowdown
+            `,
+			expectedErr: errors.New("unknown preview mode slowdown"),
+		},
+		{
+			inputConfig: `
+            preview:
+              format: webp
+              mode: speedup
+            `,
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		_, err := newPreviewStage(context.Background(), "preview", config)
+		require.Equal(t, test.expectedErr, err)
+	}
+}
+
+func TestNewAnalyzeStage(t *testing.T) {
+	tests := []struct {
+		inputConfig string
+		expectedErr error
+	}{
+		{
+			inputConfig: `
+            analyze:
+              black: -1
+            `,
+			expectedErr: errors.New("analyze black, freeze, silence and bad_recordings can't be negative"),
+		},
+		{
+			inputConfig: `
+            analyze:
+              black: 0
+              freeze: 0
+              silence: 0
+            `,
+			expectedErr: errors.New("analyze requires at least one of black, freeze and silence"),
+		},
+		{
+			inputConfig: `
+            analyze:
+              freeze: 3
+            `,
+			expectedErr: errors.New("analyze freeze_noise and silence_noise are required"),
+		},
+		{
+			inputConfig: `
+            analyze:
+              black: 2
+              freeze: 3
+              freeze_noise: -60dB
+              silence: 0
+              bad_recordings: 3
+            `,
+		},
+	}
+
+	for _, test := range tests {
+		config := viper.New()
+		config.SetConfigType("yaml")
+		require.Nil(t, config.ReadConfig(bytes.NewBufferString(test.inputConfig)))
+
+		_, err := newAnalyzeStage(context.Background(), "analyze", config)
+		require.Equal(t, test.expectedErr, err)
+	}
+}
@@ -6,13 +6,26 @@ import (
 	"sync"
 )
 
+// Stats describes working pool state, regardless of task result type.
+type Stats interface {
+	Running() bool
+	Errors() int64
+	InProgress() int
+	WorkBacklog() int
+}
+
+// Task is single unit of work executed by Pool.
+// Results should be published to chResult.
+type Task[T any] func(ctx context.Context, chResult chan T) error
+
 // Pool is simple workpool.
-type Pool struct {
+// T describes type of results published by tasks.
+type Pool[T any] struct {
 	noWorkers  int
 	running    bool
 	chDone     chan bool
-	chResult   chan interface{}
-	chWork     chan func(context.Context, chan interface{}) error
+	chResult   chan T
+	chWork     chan Task[T]
 	mu         sync.Mutex
 	errors     int64
 	inProgress int
@@ -20,13 +33,13 @@ type Pool struct {
 }
 
 // New creates new Pool.
-func New(opts *Options) *Pool {
-	p := &Pool{
+func New[T any](opts *Options) *Pool[T] {
+	p := &Pool[T]{
 		noWorkers:  opts.NoWorkers,
 		running:    false,
 		chDone:     make(chan bool, 1),
-		chResult:   make(chan interface{}, opts.ResultSize),
-		chWork:     make(chan func(context.Context, chan interface{}) error, opts.PoolSize),
+		chResult:   make(chan T, opts.ResultSize),
+		chWork:     make(chan Task[T], opts.PoolSize),
 		errors:     0,
 		inProgress: 0,
 		ctx:        opts.Ctx,
@@ -38,7 +51,7 @@ func New(opts *Options) *Pool {
 }
 
 // spawnWorkers starts goroutines responsible for executing tasks from workpool.
-func (p *Pool) spawnWorkers() {
+func (p *Pool[T]) spawnWorkers() {
 	p.running = true
 	var wg sync.WaitGroup
 
@@ -78,32 +91,32 @@ func (p *Pool) spawnWorkers() {
 }
 
 // stop all workers in pool.
-func (p *Pool) stop() {
+func (p *Pool[T]) stop() {
 	close(p.chDone)
 }
 
 // Running returns if pool is running (have any working worker)
-func (p *Pool) Running() bool {
+func (p *Pool[T]) Running() bool {
 	return p.running
 }
 
 // Errors returns total number of errors generated by tasks in workingpool.
-func (p *Pool) Errors() int64 {
+func (p *Pool[T]) Errors() int64 {
 	return p.errors
 }
 
 // InProgress returns how many tasks are currently running.
-func (p *Pool) InProgress() int {
+func (p *Pool[T]) InProgress() int {
 	return p.inProgress
 }
 
 // WorkBacklog returns number of queued tasks.
-func (p *Pool) WorkBacklog() int {
+func (p *Pool[T]) WorkBacklog() int {
 	return len(p.chWork)
 }
 
 // Execute add task to working pool queue.
-func (p *Pool) Execute(task func(context.Context, chan interface{}) error) error {
+func (p *Pool[T]) Execute(task Task[T]) error {
 	if len(p.chWork) == cap(p.chWork) {
 		return fmt.Errorf("pool is full, unable to add new task")
 	}
@@ -112,6 +125,6 @@ func (p *Pool) Execute(task func(context.Context, chan interface{}) error) error
 }
 
 // ResultChan returns channel where all results are published.
-func (p *Pool) ResultChan() chan interface{} {
+func (p *Pool[T]) ResultChan() chan T {
 	return p.chResult
 }
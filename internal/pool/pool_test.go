@@ -13,16 +13,16 @@ import (
 func TestNew(t *testing.T) {
 	tests := []struct {
 		inputOptions *Options
-		expectedPool *Pool
+		expectedPool *Pool[int]
 	}{
 		{
 			inputOptions: &Options{},
-			expectedPool: &Pool{
+			expectedPool: &Pool[int]{
 				noWorkers:  0,
 				running:    false,
 				chDone:     make(chan bool, 1),
-				chResult:   make(chan interface{}),
-				chWork:     make(chan func(context.Context, chan interface{}) error),
+				chResult:   make(chan int),
+				chWork:     make(chan Task[int]),
 				errors:     0,
 				inProgress: 0,
 			},
@@ -33,12 +33,12 @@ func TestNew(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			expectedPool: &Pool{
+			expectedPool: &Pool[int]{
 				noWorkers:  5,
 				running:    true,
 				chDone:     make(chan bool, 1),
-				chResult:   make(chan interface{}, 15),
-				chWork:     make(chan func(context.Context, chan interface{}) error, 10),
+				chResult:   make(chan int, 15),
+				chWork:     make(chan Task[int], 10),
 				errors:     0,
 				inProgress: 0,
 			},
@@ -46,7 +46,7 @@ func TestNew(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		// lets wait for spawning workers.
 		time.Sleep(10 * time.Millisecond)
@@ -64,7 +64,7 @@ func TestSpawnWorkers(t *testing.T) {
 	testCtx := context.Background()
 	task := &testTask{sleepDuration: time.Duration(50 * time.Millisecond), shouldGiveResult: true, shouldFail: 3}
 
-	p := New(&Options{
+	p := New[int](&Options{
 		NoWorkers:  3,
 		PoolSize:   10,
 		ResultSize: 15,
@@ -87,7 +87,7 @@ func TestSpawnWorkers(t *testing.T) {
 	expectedResp[2] = struct{}{}
 	for range []int{1, 2} {
 		res := <-p.ResultChan()
-		resps[res.(int)] = struct{}{}
+		resps[res] = struct{}{}
 	}
 	require.Equal(t, expectedResp, resps)
 
@@ -111,7 +111,7 @@ func TestStop(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		time.Sleep(10 * time.Millisecond)
 		p.stop()
 		time.Sleep(10 * time.Millisecond)
@@ -142,7 +142,7 @@ func TestRunning(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		time.Sleep(10 * time.Millisecond)
 		require.Equal(t, test.expectedRunning, p.Running())
@@ -152,7 +152,7 @@ func TestRunning(t *testing.T) {
 func TestErrors(t *testing.T) {
 	tests := []struct {
 		inputOptions     *Options
-		inputExecuteTask func(p *Pool)
+		inputExecuteTask func(p *Pool[int])
 		expectedErrors   int64
 	}{
 		{
@@ -161,7 +161,7 @@ func TestErrors(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(5 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 			},
@@ -173,7 +173,7 @@ func TestErrors(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(5 * time.Millisecond), shouldGiveResult: false, shouldFail: 1}
 				p.Execute(task.Do)
 			},
@@ -181,7 +181,7 @@ func TestErrors(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		if test.inputExecuteTask != nil {
 			test.inputExecuteTask(p)
@@ -194,7 +194,7 @@ func TestErrors(t *testing.T) {
 func TestInProgress(t *testing.T) {
 	tests := []struct {
 		inputOptions       *Options
-		inputExecuteTask   func(p *Pool)
+		inputExecuteTask   func(p *Pool[int])
 		expectedInProgress int
 	}{
 		{
@@ -211,7 +211,7 @@ func TestInProgress(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 			},
@@ -223,7 +223,7 @@ func TestInProgress(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -232,7 +232,7 @@ func TestInProgress(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		if test.inputExecuteTask != nil {
 			test.inputExecuteTask(p)
@@ -245,7 +245,7 @@ func TestInProgress(t *testing.T) {
 func TestWorkBacklog(t *testing.T) {
 	tests := []struct {
 		inputOptions        *Options
-		inputExecuteTask    func(p *Pool)
+		inputExecuteTask    func(p *Pool[int])
 		expectedBacklogSize int
 	}{
 		{
@@ -262,7 +262,7 @@ func TestWorkBacklog(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -276,7 +276,7 @@ func TestWorkBacklog(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -288,7 +288,7 @@ func TestWorkBacklog(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		if test.inputExecuteTask != nil {
 			test.inputExecuteTask(p)
@@ -301,7 +301,7 @@ func TestWorkBacklog(t *testing.T) {
 func TestExecute(t *testing.T) {
 	tests := []struct {
 		inputOptions            *Options
-		inputExecuteTask        func(p *Pool) error
+		inputExecuteTask        func(p *Pool[int]) error
 		expectedError           error
 		expectedWorkBacklogSize int
 	}{
@@ -311,7 +311,7 @@ func TestExecute(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) error {
+			inputExecuteTask: func(p *Pool[int]) error {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				return nil
@@ -324,7 +324,7 @@ func TestExecute(t *testing.T) {
 				PoolSize:   3,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) error {
+			inputExecuteTask: func(p *Pool[int]) error {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -339,7 +339,7 @@ func TestExecute(t *testing.T) {
 				PoolSize:   3,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) error {
+			inputExecuteTask: func(p *Pool[int]) error {
 				task := &testTask{sleepDuration: time.Duration(10 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -351,7 +351,7 @@ func TestExecute(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		if test.inputExecuteTask != nil {
 			err := test.inputExecuteTask(p)
@@ -365,7 +365,7 @@ func TestExecute(t *testing.T) {
 func TestResultChan(t *testing.T) {
 	tests := []struct {
 		inputOptions       *Options
-		inputExecuteTask   func(p *Pool)
+		inputExecuteTask   func(p *Pool[int])
 		expectedResultSize int
 	}{
 		{
@@ -374,7 +374,7 @@ func TestResultChan(t *testing.T) {
 				PoolSize:   10,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(1 * time.Millisecond), shouldGiveResult: true, shouldFail: 0}
 				p.Execute(task.Do)
 			},
@@ -386,7 +386,7 @@ func TestResultChan(t *testing.T) {
 				PoolSize:   3,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(1 * time.Millisecond), shouldGiveResult: true, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -399,7 +399,7 @@ func TestResultChan(t *testing.T) {
 				PoolSize:   3,
 				ResultSize: 15,
 			},
-			inputExecuteTask: func(p *Pool) {
+			inputExecuteTask: func(p *Pool[int]) {
 				task := &testTask{sleepDuration: time.Duration(1 * time.Millisecond), shouldGiveResult: false, shouldFail: 0}
 				p.Execute(task.Do)
 				p.Execute(task.Do)
@@ -408,7 +408,7 @@ func TestResultChan(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		p := New(test.inputOptions)
+		p := New[int](test.inputOptions)
 		defer p.stop()
 		if test.inputExecuteTask != nil {
 			test.inputExecuteTask(p)
@@ -427,7 +427,7 @@ type testTask struct {
 	shouldGiveResult bool
 }
 
-func (t *testTask) Do(ctx context.Context, chResult chan interface{}) error {
+func (t *testTask) Do(ctx context.Context, chResult chan int) error {
 	defer func() {
 		t.mu.Lock()
 		t.noOfExecutions++
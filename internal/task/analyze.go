@@ -0,0 +1,364 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"recorder/internal/job"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Findings of quality analysis.
+const (
+	FindingBlack  = "black"
+	FindingFrozen = "frozen"
+	FindingSilent = "silent"
+)
+
+var (
+	ffmpegAnalyzeTimeout = 5 * time.Minute
+	// analysisEvents is number of recent events of camera kept, videos of older event are counted as new recording.
+	analysisEvents = 16
+
+	// findingPatterns are matched against ffmpeg stderr, detect filters log every detected interval.
+	findingPatterns = []struct {
+		finding string
+		pattern string
+	}{
+		{FindingBlack, "black_start:"},
+		{FindingFrozen, "freeze_start:"},
+		{FindingSilent, "silence_start:"},
+	}
+
+	analysisStats = struct {
+		mu      sync.Mutex
+		cameras map[string]*cameraAnalysis
+	}{cameras: make(map[string]*cameraAnalysis)}
+
+	// mocks for tests.
+	analyzeVideo = ffmpegAnalyze
+)
+
+// Analyzable is implemented by results with video which should be checked for black, frozen or silent content.
+type Analyzable interface {
+	AnalyzeTask() *Analyze
+}
+
+// Analyze runs ffmpeg detect filters over video, detected problems are set as findings of job artifact.
+type Analyze struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	Artifact      string
+	EventID       string
+	StreamName    string
+}
+
+// AnalyzeOutput is published by Analyze task.
+// It is implemented by AnalyzeResult and FailureResult, which is published when video can't be analyzed.
+type AnalyzeOutput interface {
+	analyzeOutput()
+}
+
+// AnalyzeResult is published for every analyzed video.
+// Bad is number of bad recordings of camera in a row, Alert is set when recording of the video reached configured limit.
+type AnalyzeResult struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	Artifact      string
+	EventID       string
+	StreamName    string
+	Findings      []string
+	Bad           int64
+	Alert         bool
+}
+
+func (*AnalyzeResult) analyzeOutput() {}
+
+// AnalysisStats describes analyzed recordings of single camera.
+// Recording is single event, bursts, converted files and named streams of event are counted once.
+type AnalysisStats struct {
+	Recordings int64
+	Bad        int64            // Recordings with any finding.
+	Streak     int64            // Bad recordings in a row.
+	Findings   map[string]int64 // Recordings with finding, by finding.
+}
+
+// cameraAnalysis keeps stats of camera with findings of its recent recordings.
+// Videos of several events can be analyzed interleaved, e.g. when events overlap.
+type cameraAnalysis struct {
+	AnalysisStats
+	events        []*eventAnalysis // Recent events, in order of their first video.
+	droppedStreak int64            // Bad recordings in a row before the oldest kept event.
+}
+
+// eventAnalysis describes findings of single recording.
+type eventAnalysis struct {
+	id       string
+	findings []string
+}
+
+// AnalyzeTask returns task which analyzes recorded burst.
+func (r *SingleRecordResult) AnalyzeTask() *Analyze {
+	return &Analyze{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactBursts,
+	}
+}
+
+// AnalyzeTask returns task which analyzes converted recording.
+func (r *ConvertResult) AnalyzeTask() *Analyze {
+	return &Analyze{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactConverted,
+	}
+}
+
+// WebhookTask returns bad_recordings event, when camera reached limit of bad recordings in a row.
+func (r *AnalyzeResult) WebhookTask() *Webhook {
+	if !r.Alert {
+		return nil
+	}
+	return &Webhook{
+		Event:   "bad_recordings",
+		JobID:   r.JobID,
+		EventID: r.EventID,
+		Stream:  r.StreamName,
+		Time:    timeNow(),
+		Data: map[string]any{
+			"prefix":    r.Prefix,
+			"cam_name":  r.CamName,
+			"file_name": r.FileName,
+			"findings":  r.Findings,
+			"bad":       r.Bad,
+		},
+	}
+}
+
+func (r *Analyze) Do(ctx context.Context, chResult chan AnalyzeOutput) error {
+	config, err := ConfigFromContext[AnalyzeConfig](ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	probeResult, err := probe(r.FilePath)
+	if err != nil {
+		log.Printf("unable to probe %s: %v", r.FilePath, err)
+		return err
+	}
+	videoFilters, audioFilters := analyzeFilters(config, probeResult)
+	if len(videoFilters) == 0 && len(audioFilters) == 0 {
+		return nil
+	}
+
+	stderr, err := analyzeVideo(r.FilePath, videoFilters, audioFilters, ffmpegAnalyzeTimeout)
+	if err != nil {
+		log.Printf("unable to analyze %s: %v", r.FilePath, err)
+		countFFmpegError("analyze", err)
+		chResult <- &FailureResult{
+			Task:       "analyze",
+			JobID:      r.JobID,
+			Prefix:     r.Prefix,
+			CamName:    r.CamName,
+			FilePath:   r.FilePath,
+			ErrorClass: errorClass(err),
+			Error:      err.Error(),
+			EventID:    r.EventID,
+			StreamName: r.StreamName,
+		}
+		return err
+	}
+	findings := parseFindings(stderr)
+	if len(findings) > 0 {
+		job.FromContext(ctx).SetFindings(r.JobID, r.FilePath, findings)
+	}
+	event := r.EventID
+	if event == "" {
+		event = r.JobID
+	}
+	badBefore, bad := countAnalysis(r.CamName, event, findings)
+
+	chResult <- &AnalyzeResult{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      r.Artifact,
+		Findings:      findings,
+		Bad:           bad,
+		Alert:         config.BadRecordings > 0 && badBefore < int64(config.BadRecordings) && bad >= int64(config.BadRecordings),
+	}
+	log.Printf("analyzed %s (findings:%v took:%.2fs)", r.FileName, findings, time.Since(now).Seconds())
+
+	return nil
+}
+
+// analyzeFilters returns enabled detect filters, silence is detected only in videos with audio.
+func analyzeFilters(config *AnalyzeConfig, probeResult *probeResult) ([]string, []string) {
+	var videoFilters, audioFilters []string
+	if config.Black > 0 {
+		videoFilters = append(videoFilters, fmt.Sprintf("blackdetect=d=%g", config.Black))
+	}
+	if config.Freeze > 0 {
+		videoFilters = append(videoFilters, fmt.Sprintf("freezedetect=n=%s:d=%g", config.FreezeNoise, config.Freeze))
+	}
+	if config.Silence > 0 {
+		for _, stream := range probeResult.Streams {
+			if stream.CodecType == "audio" {
+				audioFilters = append(audioFilters, fmt.Sprintf("silencedetect=n=%s:d=%g", config.SilenceNoise, config.Silence))
+				break
+			}
+		}
+	}
+	return videoFilters, audioFilters
+}
+
+// parseFindings returns findings logged by detect filters, in order of findingPatterns.
+func parseFindings(stderr string) []string {
+	var findings []string
+	for _, p := range findingPatterns {
+		if strings.Contains(stderr, p.pattern) {
+			findings = append(findings, p.finding)
+		}
+	}
+	return findings
+}
+
+// countAnalysis counts analyzed video of camera recorded in event.
+// Videos of the same event are single recording, which is bad when any of them has findings.
+// It returns number of bad recordings in a row before and after the video.
+func countAnalysis(camName, event string, findings []string) (int64, int64) {
+	analysisStats.mu.Lock()
+	defer analysisStats.mu.Unlock()
+
+	stats, ok := analysisStats.cameras[camName]
+	if !ok {
+		stats = &cameraAnalysis{AnalysisStats: AnalysisStats{Findings: make(map[string]int64)}}
+		analysisStats.cameras[camName] = stats
+	}
+	streakBefore := stats.Streak
+
+	i := slices.IndexFunc(stats.events, func(e *eventAnalysis) bool { return e.id == event })
+	if i < 0 {
+		stats.Recordings++
+		stats.events = append(stats.events, &eventAnalysis{id: event})
+		if len(stats.events) > analysisEvents {
+			if len(stats.events[0].findings) > 0 {
+				stats.droppedStreak++
+			} else {
+				stats.droppedStreak = 0
+			}
+			stats.events = stats.events[1:]
+		}
+		i = len(stats.events) - 1
+	}
+
+	e := stats.events[i]
+	wasBad := len(e.findings) > 0
+	for _, finding := range findings {
+		if !slices.Contains(e.findings, finding) {
+			e.findings = append(e.findings, finding)
+			stats.Findings[finding]++
+		}
+	}
+	if !wasBad && len(e.findings) > 0 {
+		stats.Bad++
+	}
+	stats.Streak = stats.streak()
+	return streakBefore, stats.Streak
+}
+
+// streak returns number of bad recordings in a row, up to the newest one.
+func (c *cameraAnalysis) streak() int64 {
+	var streak int64
+	for i := len(c.events) - 1; i >= 0; i-- {
+		if len(c.events[i].findings) == 0 {
+			return streak
+		}
+		streak++
+	}
+	return streak + c.droppedStreak
+}
+
+// Analyses returns analyzed recordings, by camera.
+func Analyses() map[string]AnalysisStats {
+	analysisStats.mu.Lock()
+	defer analysisStats.mu.Unlock()
+
+	stats := make(map[string]AnalysisStats)
+	for camName, s := range analysisStats.cameras {
+		stats[camName] = AnalysisStats{
+			Recordings: s.Recordings,
+			Bad:        s.Bad,
+			Streak:     s.Streak,
+			Findings:   maps.Clone(s.Findings),
+		}
+	}
+	return stats
+}
+
+// ffmpegAnalyze decodes video with detect filters, it returns ffmpeg stderr with detected intervals.
+func ffmpegAnalyze(filePath string, videoFilters, audioFilters []string, timeout time.Duration) (string, error) {
+	outputKwArgs := ffmpeg.KwArgs{"f": "null"}
+	if len(videoFilters) > 0 {
+		outputKwArgs["vf"] = strings.Join(videoFilters, ",")
+	} else {
+		outputKwArgs["vn"] = ""
+	}
+	if len(audioFilters) > 0 {
+		outputKwArgs["af"] = strings.Join(audioFilters, ",")
+	} else {
+		outputKwArgs["an"] = ""
+	}
+
+	stderr := &bytes.Buffer{}
+	stream := ffmpeg.Input(filePath).Output("-", outputKwArgs).GlobalArgs("-nostats")
+	if err := stream.WithErrorOutput(stderr).WithTimeout(timeout).Run(); err != nil {
+		return "", &FFmpegError{
+			Class:  classifyStderr(stderr.String(), false),
+			Stderr: stderr.String(),
+			Err:    fmt.Errorf("analyze of %s failed: %w", filepath.Base(filePath), err),
+		}
+	}
+	return stderr.String(), nil
+}
@@ -0,0 +1,250 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"recorder/internal/job"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestAnalyzeDo(t *testing.T) {
+	defer func() {
+		ffmpegProbe = ffmpeg.Probe
+		analyzeVideo = ffmpegAnalyze
+	}()
+	ffmpegProbe = func(fileName string, _ ...ffmpeg.KwArgs) (string, error) {
+		if fileName == "/data/missing.mp4" {
+			return "", errors.New("mock probe error")
+		}
+		return `{"format": {"duration": "5.000000"}, "streams": [{"codec_type": "video", "codec_name": "h264"}, {"codec_type": "audio", "codec_name": "aac"}]}`, nil
+	}
+
+	tests := []struct {
+		inputConfig      *AnalyzeConfig
+		inputFilePath    string
+		inputStderr      string
+		inputErr         error
+		expectedFilters  [2][]string
+		expectedErr      error
+		expectedFailure  *FailureResult
+		expectedFindings []string
+		expectedBad      int64
+		expectedAlert    bool
+	}{
+		{
+			inputConfig:   &AnalyzeConfig{Black: 2},
+			inputFilePath: "/data/missing.mp4",
+			expectedErr:   errors.New("mock probe error"),
+		},
+		{
+			inputConfig:     &AnalyzeConfig{Black: 2, Freeze: 3, FreezeNoise: "-60dB", BadRecordings: 2},
+			inputFilePath:   "/data/cam1-001.mp4",
+			inputErr:        &FFmpegError{Class: ErrorClassCodec, Err: errors.New("mock error")},
+			expectedFilters: [2][]string{{"blackdetect=d=2", "freezedetect=n=-60dB:d=3"}},
+			expectedErr:     &FFmpegError{Class: ErrorClassCodec, Err: errors.New("mock error")},
+			expectedFailure: &FailureResult{
+				Task:       "analyze",
+				JobID:      "job1",
+				CamName:    "analyze_cam",
+				FilePath:   "/data/cam1-001.mp4",
+				ErrorClass: ErrorClassCodec,
+				Error:      "ffmpeg failed (codec_unsupported): mock error: ",
+				EventID:    "/data/cam1-001.mp4",
+			},
+		},
+		{
+			inputConfig:      &AnalyzeConfig{Black: 2, Freeze: 3, FreezeNoise: "-60dB", BadRecordings: 2},
+			inputFilePath:    "/data/cam1-001.mp4",
+			inputStderr:      "[blackdetect @ 0x1] black_start:0 black_end:5 black_duration:5\n",
+			expectedFilters:  [2][]string{{"blackdetect=d=2", "freezedetect=n=-60dB:d=3"}},
+			expectedFindings: []string{FindingBlack},
+			expectedBad:      1,
+		},
+		{
+			inputConfig:      &AnalyzeConfig{Black: 2, Freeze: 3, FreezeNoise: "-60dB", Silence: 5, SilenceNoise: "-50dB", BadRecordings: 2},
+			inputFilePath:    "/data/cam1-002.mp4",
+			inputStderr:      "[freezedetect @ 0x1] lavfi.freezedetect.freeze_start: 0.5\n[silencedetect @ 0x2] silence_start: 0\n",
+			expectedFilters:  [2][]string{{"blackdetect=d=2", "freezedetect=n=-60dB:d=3"}, {"silencedetect=n=-50dB:d=5"}},
+			expectedFindings: []string{FindingFrozen, FindingSilent},
+			expectedBad:      2,
+			expectedAlert:    true,
+		},
+		{
+			inputConfig:      &AnalyzeConfig{Black: 2, Freeze: 3, FreezeNoise: "-60dB", BadRecordings: 2},
+			inputFilePath:    "/data/cam1-003.mp4",
+			inputStderr:      "[blackdetect @ 0x1] black_start:0 black_end:5 black_duration:5\n",
+			expectedFilters:  [2][]string{{"blackdetect=d=2", "freezedetect=n=-60dB:d=3"}},
+			expectedFindings: []string{FindingBlack},
+			expectedBad:      3,
+		},
+		{
+			inputConfig:     &AnalyzeConfig{Black: 2, BadRecordings: 2},
+			inputFilePath:   "/data/cam1-004.mp4",
+			expectedFilters: [2][]string{{"blackdetect=d=2"}},
+		},
+	}
+
+	jobs := job.NewRegistry(10)
+	jobs.Create("job1")
+	for _, test := range tests {
+		jobs.AddArtifact("job1", &job.Artifact{Type: "burst", FilePath: test.inputFilePath})
+		analyzeVideo = func(filePath string, videoFilters, audioFilters []string, timeout time.Duration) (string, error) {
+			require.Equal(t, test.inputFilePath, filePath)
+			require.Equal(t, test.expectedFilters, [2][]string{videoFilters, audioFilters})
+			return test.inputStderr, test.inputErr
+		}
+
+		ctx := job.WithRegistry(WithConfig(context.Background(), test.inputConfig), jobs)
+		chResult := make(chan AnalyzeOutput, 1)
+		// Every video is recorded in its own event.
+		err := (&Analyze{JobID: "job1", EventID: test.inputFilePath, CamName: "analyze_cam", FilePath: test.inputFilePath, FileName: "file.mp4"}).Do(ctx, chResult)
+		require.Equal(t, test.expectedErr, err)
+		close(chResult)
+		if test.expectedErr != nil {
+			if test.expectedFailure == nil {
+				require.Len(t, chResult, 0)
+			} else {
+				require.Equal(t, test.expectedFailure, <-chResult)
+			}
+			continue
+		}
+
+		result := (<-chResult).(*AnalyzeResult)
+		require.Equal(t, test.expectedFindings, result.Findings)
+		require.Equal(t, test.expectedBad, result.Bad)
+		require.Equal(t, test.expectedAlert, result.Alert)
+		require.Equal(t, test.expectedAlert, result.WebhookTask() != nil)
+
+		j, _ := jobs.Get("job1")
+		require.Equal(t, test.expectedFindings, j.Artifacts[len(j.Artifacts)-1].Findings)
+	}
+
+	require.Equal(t, AnalysisStats{
+		Recordings: 4,
+		Bad:        3,
+		Streak:     0,
+		Findings:   map[string]int64{FindingBlack: 2, FindingFrozen: 1, FindingSilent: 1},
+	}, Analyses()["analyze_cam"])
+}
+
+func TestAnalyzeDoEvent(t *testing.T) {
+	defer func() {
+		ffmpegProbe = ffmpeg.Probe
+		analyzeVideo = ffmpegAnalyze
+	}()
+	ffmpegProbe = func(string, ...ffmpeg.KwArgs) (string, error) {
+		return `{"format": {"duration": "5.000000"}, "streams": [{"codec_type": "video", "codec_name": "h264"}]}`, nil
+	}
+	analyzeVideo = func(filePath string, _, _ []string, _ time.Duration) (string, error) {
+		if strings.Contains(filePath, "good") {
+			return "", nil
+		}
+		return "[blackdetect @ 0x1] black_start:0 black_end:5 black_duration:5\n", nil
+	}
+
+	// Bursts, converted file and named streams of event are single recording.
+	tests := []struct {
+		inputJobID    string
+		inputEventID  string
+		inputFilePath string
+		expectedBad   int64
+		expectedAlert bool
+	}{
+		{inputJobID: "job1", inputFilePath: "/data/job1-001.mp4", expectedBad: 1},
+		{inputJobID: "job1", inputFilePath: "/data/job1-002.mp4", expectedBad: 1},
+		{inputJobID: "job1", inputFilePath: "/data/job1-003.mp4", expectedBad: 1},
+		{inputJobID: "job1", inputFilePath: "/data/job1-convert.mp4", expectedBad: 1},
+		{inputJobID: "job2", inputEventID: "event2", inputFilePath: "/data/job2-main-good.mp4"},
+		{inputJobID: "job2", inputEventID: "event2", inputFilePath: "/data/job2-sub-001.mp4", expectedBad: 2, expectedAlert: true},
+		{inputJobID: "job2", inputEventID: "event2", inputFilePath: "/data/job2-sub-002.mp4", expectedBad: 2},
+	}
+
+	for _, test := range tests {
+		ctx := job.WithRegistry(WithConfig(context.Background(), &AnalyzeConfig{Black: 2, BadRecordings: 2}), job.NewRegistry(10))
+		chResult := make(chan AnalyzeOutput, 1)
+		err := (&Analyze{JobID: test.inputJobID, EventID: test.inputEventID, CamName: "analyze_event_cam", FilePath: test.inputFilePath}).Do(ctx, chResult)
+		require.Nil(t, err)
+
+		result := (<-chResult).(*AnalyzeResult)
+		require.Equal(t, test.expectedBad, result.Bad)
+		require.Equal(t, test.expectedAlert, result.Alert)
+	}
+
+	require.Equal(t, AnalysisStats{
+		Recordings: 2,
+		Bad:        2,
+		Streak:     2,
+		Findings:   map[string]int64{FindingBlack: 2},
+	}, Analyses()["analyze_event_cam"])
+}
+
+func TestCountAnalysisInterleaved(t *testing.T) {
+	defer func() {
+		analysisEvents = 16
+	}()
+	analysisEvents = 3
+
+	// Videos of overlapping events come interleaved, event can turn bad after newer event.
+	tests := []struct {
+		inputEvent           string
+		inputFindings        []string
+		expectedStreakBefore int64
+		expectedStreak       int64
+	}{
+		{inputEvent: "event1"},
+		{inputEvent: "event2", inputFindings: []string{FindingBlack}, expectedStreak: 1},
+		{inputEvent: "event1", inputFindings: []string{FindingFrozen}, expectedStreakBefore: 1, expectedStreak: 2},
+		{inputEvent: "event3", inputFindings: []string{FindingBlack}, expectedStreakBefore: 2, expectedStreak: 3},
+		{inputEvent: "event2", inputFindings: []string{FindingBlack}, expectedStreakBefore: 3, expectedStreak: 3},
+		{inputEvent: "event4", expectedStreakBefore: 3},
+		{inputEvent: "event3"},
+		// event1 and event2 aren't kept anymore, their bad recordings still count in streak.
+		{inputEvent: "event5", inputFindings: []string{FindingBlack}, expectedStreak: 1},
+		{inputEvent: "event4", inputFindings: []string{FindingSilent}, expectedStreakBefore: 1, expectedStreak: 5},
+	}
+
+	for _, test := range tests {
+		streakBefore, streak := countAnalysis("analyze_interleaved_cam", test.inputEvent, test.inputFindings)
+		require.Equal(t, test.expectedStreakBefore, streakBefore, test.inputEvent)
+		require.Equal(t, test.expectedStreak, streak, test.inputEvent)
+	}
+
+	require.Equal(t, AnalysisStats{
+		Recordings: 5,
+		Bad:        5,
+		Streak:     5,
+		Findings:   map[string]int64{FindingBlack: 3, FindingFrozen: 1, FindingSilent: 1},
+	}, Analyses()["analyze_interleaved_cam"])
+}
+
+func TestAnalyzeResultWebhookTask(t *testing.T) {
+	now := time.Date(2023, time.January, 20, 1, 2, 3, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	result := &AnalyzeResult{JobID: "job1", EventID: "event1", Prefix: "door", CamName: "cam1", FileName: "cam1-001.mp4", Findings: []string{FindingBlack}, Bad: 3}
+	require.Nil(t, result.WebhookTask())
+
+	result.Alert = true
+	require.Equal(t, &Webhook{
+		Event:   "bad_recordings",
+		JobID:   "job1",
+		EventID: "event1",
+		Time:    now,
+		Data: map[string]any{
+			"prefix":    "door",
+			"cam_name":  "cam1",
+			"file_name": "cam1-001.mp4",
+			"findings":  []string{FindingBlack},
+			"bad":       int64(3),
+		},
+	}, result.WebhookTask())
+}
@@ -0,0 +1,119 @@
+package task
+
+import (
+	"context"
+	"fmt"
+)
+
+// RecordConfig contains configuration for Record task.
+type RecordConfig struct {
+	OutputDir       string
+	InputArgs       map[string]string
+	OutputArgs      map[string]string
+	Naming          *Naming
+	Container       string                       // Default container.
+	Containers      map[string]string            // Container of every camera, overrides default one.
+	Masks           map[string][]Mask            // Privacy masks of every camera.
+	ApplyMasks      bool                         // Apply masks while recording, output has to be re-encoded.
+	Finalize        bool                         // Remux bursts with faststart and repair broken ones.
+	Validation      *Validation                  // Checks of every burst, disabled when nil.
+	StallTimeout    int                          // Seconds without ffmpeg progress before it is killed, 0 disables it.
+	Reconnect       *Reconnect                   // Reconnects of dropped stream, disabled when nil.
+	Streams         map[string][]string          // Streams of every camera, tried in order.
+	FailoverTimeout int                          // Socket timeout in seconds of rtsp streams, when there are other streams to try.
+	NamedStreams    map[string]map[string]string // Streams of every camera recorded in sync for each event, by stream name.
+	Ingest          *Ingest                      // Shared upstream connections, disabled when nil.
+	BurstMode       string                       // How bursts are recorded, BurstModeOverlap when empty.
+}
+
+// ProbeConfig contains configuration for probing streams without recording.
+type ProbeConfig struct {
+	InputArgs    map[string]string
+	Timeout      int                          // Seconds before ffprobe is killed.
+	Streams      map[string][]string          // Streams of every camera.
+	NamedStreams map[string]map[string]string // Named streams of every camera, by stream name.
+}
+
+// UploadConfig contains configuration for Upload task.
+type UploadConfig struct {
+	SSHUser   string
+	SSHKey    string
+	SSHServer string
+	Timeout   int
+	MaxError  int
+	Naming    *Naming
+}
+
+// ConvertConfig contains configuration for Convert task.
+// Every recording is converted with each profile.
+type ConvertConfig struct {
+	OutputDir    string
+	Naming       *Naming
+	Profiles     []ConvertProfile
+	Masks        map[string][]Mask // Privacy masks of every camera, applied by every profile.
+	StallTimeout int               // Seconds without ffmpeg progress before it is killed, 0 disables it.
+}
+
+// ConvertProfile describes single convert output.
+type ConvertProfile struct {
+	Name       string            `mapstructure:"name"`
+	InputArgs  map[string]string `mapstructure:"input_args"`
+	OutputArgs map[string]string `mapstructure:"output_args"`
+	Suffix     string            `mapstructure:"suffix"`      // File name suffix, profile name by default.
+	Container  string            `mapstructure:"container"`   // Container name (mp4, fmp4, mkv, ts) or file extension, mp4 by default.
+	SkipUpload bool              `mapstructure:"skip_upload"` // Don't upload converted file, even when converted artifacts are uploaded.
+	Overlay    *ConvertOverlay   `mapstructure:"overlay"`     // Burn camera name and time into video, disabled when nil.
+}
+
+// ThumbnailConfig contains configuration for Thumbnail task.
+type ThumbnailConfig struct {
+	Offset float64 // Poster position in seconds.
+	Frames int     // Number of evenly spaced frames created next to poster.
+	Width  int     // Width of images, 0 keeps video width.
+}
+
+// PreviewConfig contains configuration for Preview task.
+type PreviewConfig struct {
+	Format   string // gif or webp.
+	Mode     string // first (first Length seconds) or speedup (whole video squeezed into Length seconds).
+	Length   int    // Preview length in seconds.
+	Width    int
+	FPS      int
+	MaxBytes int64             // Preview is shrunk until it fits, 0 disables limit.
+	Masks    map[string][]Mask // Privacy masks by camera, applied to unmasked videos.
+}
+
+// AnalyzeConfig contains configuration for Analyze task.
+// Durations are in seconds, 0 disables the filter.
+type AnalyzeConfig struct {
+	Black         float64 // Black video reported by blackdetect.
+	Freeze        float64 // Frozen video reported by freezedetect.
+	FreezeNoise   string  // Noise tolerance of freezedetect, e.g. -60dB.
+	Silence       float64 // Silent audio reported by silencedetect.
+	SilenceNoise  string  // Noise tolerance of silencedetect, e.g. -50dB.
+	BadRecordings int     // Bad recordings of camera in a row which raise webhook, 0 disables it.
+}
+
+// WebhookConfig contains configuration for Webhook task.
+type WebhookConfig struct {
+	URLs    []string
+	Timeout int
+}
+
+// configKey is used to store task configuration in context.
+// Every configuration type gets its own key, so configs can't collide.
+type configKey[C any] struct{}
+
+// WithConfig returns copy of ctx which carries task configuration.
+func WithConfig[C any](ctx context.Context, config *C) context.Context {
+	return context.WithValue(ctx, configKey[C]{}, config)
+}
+
+// ConfigFromContext returns task configuration stored in ctx.
+func ConfigFromContext[C any](ctx context.Context) (*C, error) {
+	config, ok := ctx.Value(configKey[C]{}).(*C)
+	if !ok || config == nil {
+		return nil, fmt.Errorf("missing %T in context", config)
+	}
+	return config, nil
+}
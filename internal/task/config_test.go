@@ -0,0 +1,43 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromContext(t *testing.T) {
+	tests := []struct {
+		inputCtxFunc   func() context.Context
+		expectedConfig *RecordConfig
+		expectedErr    error
+	}{
+		{
+			inputCtxFunc: func() context.Context {
+				return context.Background()
+			},
+			expectedErr: fmt.Errorf("missing *task.RecordConfig in context"),
+		},
+		{
+			inputCtxFunc: func() context.Context {
+				return WithConfig(context.Background(), &ConvertConfig{OutputDir: "/convert"})
+			},
+			expectedErr: fmt.Errorf("missing *task.RecordConfig in context"),
+		},
+		{
+			inputCtxFunc: func() context.Context {
+				ctx := WithConfig(context.Background(), &ConvertConfig{OutputDir: "/convert"})
+				return WithConfig(ctx, &RecordConfig{OutputDir: "/record"})
+			},
+			expectedConfig: &RecordConfig{OutputDir: "/record"},
+		},
+	}
+
+	for _, test := range tests {
+		config, err := ConfigFromContext[RecordConfig](test.inputCtxFunc())
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedConfig, config)
+	}
+}
@@ -0,0 +1,62 @@
+package task
+
+import (
+	"maps"
+	"slices"
+)
+
+// Container describes output container format.
+type Container struct {
+	Ext      string // File extension.
+	Format   string // ffmpeg muxer.
+	MIMEType string
+	MovFlags string // mp4 muxer flags required by format.
+}
+
+// Supported containers, crash-interrupted fmp4, mkv and ts recordings are still playable.
+var containers = map[string]*Container{
+	"mp4":  {Ext: "mp4", Format: "mp4", MIMEType: "video/mp4"},
+	"fmp4": {Ext: "mp4", Format: "mp4", MIMEType: "video/mp4", MovFlags: "frag_keyframe+empty_moov+default_base_moof"},
+	"mkv":  {Ext: "mkv", Format: "matroska", MIMEType: "video/x-matroska"},
+	"ts":   {Ext: "ts", Format: "mpegts", MIMEType: "video/mp2t"},
+}
+
+// LookupContainer returns container by its name.
+func LookupContainer(name string) (*Container, bool) {
+	container, ok := containers[name]
+	return container, ok
+}
+
+// ContainerNames returns names of supported containers.
+func ContainerNames() []string {
+	return slices.Sorted(maps.Keys(containers))
+}
+
+// ContainerMIMETypes returns MIME type of every container extension.
+func ContainerMIMETypes() map[string]string {
+	mimeTypes := make(map[string]string)
+	for _, container := range containers {
+		mimeTypes["."+container.Ext] = container.MIMEType
+	}
+	return mimeTypes
+}
+
+// withContainer returns copy of outputArgs which selects container muxer.
+// Muxer selected by user is kept, movflags are merged.
+func withContainer(outputArgs map[string]string, container *Container) map[string]string {
+	args := maps.Clone(outputArgs)
+	if args == nil {
+		args = make(map[string]string)
+	}
+	if _, ok := args["f"]; !ok {
+		args["f"] = container.Format
+	}
+	if container.MovFlags != "" {
+		if movflags := args["movflags"]; movflags != "" {
+			args["movflags"] = movflags + "+" + container.MovFlags
+		} else {
+			args["movflags"] = container.MovFlags
+		}
+	}
+	return args
+}
@@ -0,0 +1,101 @@
+package task
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithContainer(t *testing.T) {
+	tests := []struct {
+		inputOutputArgs    map[string]string
+		inputContainer     string
+		expectedOutputArgs map[string]string
+	}{
+		{
+			inputContainer:     "mp4",
+			expectedOutputArgs: map[string]string{"f": "mp4"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"c:v": "copy"},
+			inputContainer:     "fmp4",
+			expectedOutputArgs: map[string]string{"c:v": "copy", "f": "mp4", "movflags": "frag_keyframe+empty_moov+default_base_moof"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"movflags": "+faststart"},
+			inputContainer:     "fmp4",
+			expectedOutputArgs: map[string]string{"f": "mp4", "movflags": "+faststart+frag_keyframe+empty_moov+default_base_moof"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"f": "matroska"},
+			inputContainer:     "ts",
+			expectedOutputArgs: map[string]string{"f": "matroska"},
+		},
+		{
+			inputContainer:     "ts",
+			expectedOutputArgs: map[string]string{"f": "mpegts"},
+		},
+	}
+
+	for _, test := range tests {
+		container, ok := LookupContainer(test.inputContainer)
+		require.True(t, ok)
+		require.Equal(t, test.expectedOutputArgs, withContainer(test.inputOutputArgs, container))
+	}
+}
+
+func TestContainerMIMETypes(t *testing.T) {
+	require.Equal(t, map[string]string{
+		".mp4": "video/mp4",
+		".mkv": "video/x-matroska",
+		".ts":  "video/mp2t",
+	}, ContainerMIMETypes())
+	require.Equal(t, []string{"fmp4", "mkv", "mp4", "ts"}, ContainerNames())
+}
+
+func TestRecordContainer(t *testing.T) {
+	config := &RecordConfig{
+		Container:  "fmp4",
+		Containers: map[string]string{"cam1": "mkv", "cam2": "avi"},
+	}
+
+	tests := []struct {
+		inputRecord       *Record
+		inputConfig       *RecordConfig
+		expectedContainer *Container
+		expectedErr       error
+	}{
+		{
+			inputRecord:       &Record{CamName: "cam1"},
+			inputConfig:       &RecordConfig{},
+			expectedContainer: containers["mp4"],
+		},
+		{
+			inputRecord:       &Record{CamName: "cam3"},
+			inputConfig:       config,
+			expectedContainer: containers["fmp4"],
+		},
+		{
+			inputRecord:       &Record{CamName: "cam1"},
+			inputConfig:       config,
+			expectedContainer: containers["mkv"],
+		},
+		{
+			inputRecord:       &Record{CamName: "cam1", Container: "ts"},
+			inputConfig:       config,
+			expectedContainer: containers["ts"],
+		},
+		{
+			inputRecord: &Record{CamName: "cam2"},
+			inputConfig: config,
+			expectedErr: errors.New("unknown container avi"),
+		},
+	}
+
+	for _, test := range tests {
+		container, err := test.inputRecord.container(test.inputConfig)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedContainer, container)
+	}
+}
@@ -1,14 +1,18 @@
 package task
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"recorder/internal/job"
+
 	"github.com/google/uuid"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
@@ -22,45 +26,235 @@ var (
 )
 
 type Convert struct {
-	Prefix         string
-	RecordingDate  string
-	FileNamePrefix string
-	FilesPath      []string
-	TotalLength    int64
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	Tags          map[string]string
+	RecordingDate string
+	FilesPath     []string
+	FilesOffset   []time.Duration
+	Length        int64
+	TotalLength   int64
+	EventID       string
+	StreamName    string
+}
+
+// ConvertOutput is published by Convert task.
+// It is implemented by ConvertResult and FailureResult, which is published for every failed profile.
+type ConvertOutput interface {
+	convertOutput()
+}
+
+// ConvertResult is published when recording is converted with single profile.
+// It is published only after ffmpeg finished successfully.
+type ConvertResult struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	Profile       string
+	FileName      string
+	FilePath      string
+	SkipUpload    bool
+	EventID       string
+	StreamName    string
+}
+
+func (*ConvertResult) convertOutput() {}
+
+// UploadTask returns task which uploads converted recording.
+// nil is returned when profile should not be uploaded.
+func (r *ConvertResult) UploadTask() *Upload {
+	if r.SkipUpload {
+		return nil
+	}
+	return &Upload{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactConverted,
+	}
 }
 
-func (r *Convert) Do(ctx context.Context, chResult chan interface{}) error {
+func (r *Convert) Do(ctx context.Context, chResult chan ConvertOutput) error {
 	if len(r.FilesPath) == 0 {
 		return nil
 	}
-	now := time.Now()
+	config, err := ConfigFromContext[ConvertConfig](ctx)
+	if err != nil {
+		return err
+	}
 
-	// /data/prefix/26-02-2023
-	dirPath := filepath.Join(ctx.Value("outputDir").(string), r.Prefix, r.RecordingDate)
-	// 07:36:36.178-cam1-convert.mp4
-	fileName := fmt.Sprintf("%s-convert.mp4", r.FileNamePrefix)
 	// /data/prefix/26-02-2023/07:36:36.178-cam1-convert.mp4
-	filePath := filepath.Join(dirPath, fileName)
+	filesPath := make([]string, len(config.Profiles))
+	for i, profile := range config.Profiles {
+		filesPath[i] = filepath.Join(config.OutputDir, config.Naming.Path(config.Naming.Convert, &NameVars{
+			Prefix:  r.Prefix,
+			CamName: r.CamName,
+			Start:   r.StartTime,
+			Bursts:  int64(len(r.FilesPath)),
+			Suffix:  profile.Suffix,
+			Ext:     profile.FileExt(),
+			Stream:  r.StreamName,
+			Event:   r.EventID,
+		}))
+		dirPath := filepath.Dir(filesPath[i])
+		if err := osMkdirAll(dirPath, 0755); err != nil {
+			log.Printf("unable to create %s: %v", dirPath, err)
+			return err
+		}
+	}
 
-	if err := osMkdirAll(dirPath, 0755); err != nil {
-		log.Printf("unable to create %s: %v", dirPath, err)
-		return err
+	parts := concatParts(r.FilesPath, r.FilesOffset, r.Length)
+
+	var failedProfiles []string
+	for i, profile := range config.Profiles {
+		now := time.Now()
+		filePath := filesPath[i]
+		fileName := filepath.Base(filePath)
+
+		var masks, overlay string
+		if cameraMasks := config.Masks[r.CamName]; len(cameraMasks) > 0 {
+			masks = maskFilter(cameraMasks)
+		}
+		if profile.Overlay != nil {
+			textFile, err := r.writeOverlayText(profile.Overlay)
+			if err != nil {
+				log.Printf("unable to prepare overlay %s (profile:%s): %v", filePath, profile.Name, err)
+				failedProfiles = append(failedProfiles, profile.Name)
+				continue
+			}
+			defer os.Remove(textFile)
+			overlay = overlayFilter(profile.Overlay, textFile)
+		}
+		outputArgs := withVideoFilter(profile.OutputArgs, masks, overlay)
+		if container, ok := LookupContainer(profile.Container); ok {
+			outputArgs = withContainer(outputArgs, container)
+		}
+
+		metadata := recordingMetadata(r.CamName, r.Prefix, r.StartTime, r.Tags)
+		metadata["profile"] = profile.Name
+
+		stall := time.Duration(config.StallTimeout) * time.Second
+		if err := ffmpegConvert(parts, filePath, profile.InputArgs, outputArgs, metadata, r.TotalLength, stall, jobProgress(ctx, r.JobID, "convert", filePath)); err != nil {
+			log.Printf("unable to convert %s (profile:%s): %v", filePath, profile.Name, err)
+			countFFmpegError("convert", err)
+			job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{
+				Type:       "converted",
+				FilePath:   filePath,
+				Status:     StatusFailed,
+				Error:      err.Error(),
+				ErrorClass: errorClass(err),
+				Stream:     r.StreamName,
+			})
+			chResult <- &FailureResult{
+				Task:       "convert",
+				JobID:      r.JobID,
+				Prefix:     r.Prefix,
+				CamName:    r.CamName,
+				FilePath:   filePath,
+				ErrorClass: errorClass(err),
+				Error:      err.Error(),
+				EventID:    r.EventID,
+				StreamName: r.StreamName,
+			}
+			failedProfiles = append(failedProfiles, profile.Name)
+			continue
+		}
+		log.Printf("converted %s (profile:%s length:%ds took:%.2fs)", filePath, profile.Name, int(r.TotalLength), time.Since(now).Seconds())
+		job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{Type: "converted", FilePath: filePath, Stream: r.StreamName})
+
+		chResult <- &ConvertResult{
+			JobID:         r.JobID,
+			EventID:       r.EventID,
+			StreamName:    r.StreamName,
+			Prefix:        r.Prefix,
+			CamName:       r.CamName,
+			StartTime:     r.StartTime,
+			RecordingDate: r.RecordingDate,
+			Profile:       profile.Name,
+			FileName:      fileName,
+			FilePath:      filePath,
+			SkipUpload:    profile.SkipUpload,
+		}
 	}
 
-	if err := ffmpegConvert(r.FilesPath, filePath, ctx.Value("ffmpegInputArgs").(map[string]string), ctx.Value("ffmpegOutputArgs").(map[string]string), r.TotalLength); err != nil {
-		log.Printf("unable to convert %s: %v", filePath, err)
-		return err
+	if len(failedProfiles) > 0 {
+		return fmt.Errorf("unable to convert profiles: %s", strings.Join(failedProfiles, ", "))
 	}
-	log.Printf("converted %s (length:%ds took:%.2fs)", filePath, int(r.TotalLength), time.Since(now).Seconds())
 	return nil
 }
 
-func ffmpegConvert(inputFiles []string, outputFileName string, inputArgs map[string]string, outputArgs map[string]string, length int64) error {
+// FileExt returns file extension of converted recording.
+// Unknown containers are used as file extension, muxer is guessed by ffmpeg then.
+func (p *ConvertProfile) FileExt() string {
+	if container, ok := LookupContainer(p.Container); ok {
+		return container.Ext
+	}
+	return p.Container
+}
+
+// writeOverlayText writes drawtext text for recording to temporary file.
+func (r *Convert) writeOverlayText(overlay *ConvertOverlay) (string, error) {
+	loc, err := time.LoadLocation(overlay.Timezone)
+	if err != nil {
+		return "", err
+	}
+
+	textFile := filepath.Join(tmpDir, uuid.New().String())
+	if err := osWriteFile(textFile, []byte(overlayText(r.CamName, r.StartTime, loc)), 0644); err != nil {
+		return "", err
+	}
+	return textFile, nil
+}
+
+// concatParts returns concat demuxer directives for all files.
+// Bursts are overlapping, so every part starts where parts before it end.
+// Retried burst starts later than bursts after it, so parts are joined in order of their offsets
+// and part starting with part before it is skipped.
+// When offsets are not known, files are concatenated as-is.
+func concatParts(filesPath []string, filesOffset []time.Duration, length int64) []string {
+	if len(filesOffset) != len(filesPath) {
+		var parts []string
+		for _, filePath := range filesPath {
+			parts = append(parts, "file "+filePath)
+		}
+		return parts
+	}
+
+	order := make([]int, len(filesPath))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(filesOffset[a], filesOffset[b])
+	})
+
 	var parts []string
-	for _, inputFile := range inputFiles {
-		parts = append(parts, "file "+inputFile)
+	var coveredEnd time.Duration
+	for n, i := range order {
+		end := filesOffset[i] + time.Duration(length)*time.Second
+		if n > 0 && end <= coveredEnd {
+			continue
+		}
+		parts = append(parts, "file "+filesPath[i])
+		if inpoint := coveredEnd - filesOffset[i]; n > 0 && inpoint > 0 {
+			parts = append(parts, fmt.Sprintf("inpoint %.3f", inpoint.Seconds()))
+		}
+		coveredEnd = end
 	}
+	return parts
+}
 
+func ffmpegConvert(parts []string, outputFileName string, inputArgs map[string]string, outputArgs map[string]string, metadata map[string]string, length int64, stall time.Duration, onProgress func(*job.Progress)) error {
 	content := []byte(strings.Join(parts, "\n"))
 
 	listFileName := filepath.Join(tmpDir, uuid.New().String())
@@ -80,11 +274,10 @@ func ffmpegConvert(inputFiles []string, outputFileName string, inputArgs map[str
 	for k, v := range outputArgs {
 		outputKwArgs[k] = v
 	}
+	addMetadata(outputKwArgs, outputFileName, metadata)
 
-	err := ffmpeg.Input(listFileName, inputKwArgs).
-		Output(outputFileName, outputKwArgs).
-		WithTimeout(time.Duration(length*int64(ffmpegConvertRatio)) * time.Second).
-		Run()
+	err := runFFmpeg(ffmpeg.Input(listFileName, inputKwArgs).Output(outputFileName, outputKwArgs),
+		time.Duration(length*int64(ffmpegConvertRatio))*time.Second, stall, onProgress)
 
 	if err != nil {
 		defer os.Remove(outputFileName)
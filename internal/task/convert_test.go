@@ -2,33 +2,50 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestConvertDo(t *testing.T) {
+	convertStartTime := time.Date(2023, time.January, 28, 23, 40, 27, 876000000, time.Local)
 	tests := []struct {
-		inputCtxFunc   func() context.Context
-		inputConvert   *Convert
-		mockOsMkdirAll func(string, os.FileMode) error
-		expectedErr    error
+		inputCtxFunc     func() context.Context
+		inputConvert     *Convert
+		mockOsMkdirAll   func(string, os.FileMode) error
+		expectedErr      error
+		expectedResults  []*ConvertResult
+		expectedFailures []*FailureResult
+		expectedDuration float64
+		expectedMetadata map[string]string
 	}{
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "convert",
+							InputArgs:  map[string]string{},
+							OutputArgs: map[string]string{},
+							Suffix:     "convert",
+							Container:  "mp4",
+						},
+					},
+				})
 			},
 			inputConvert: &Convert{
-				Prefix:         "prefix",
-				RecordingDate:  "28-01-2023",
-				FileNamePrefix: "23:40:27.876-cam1",
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				CamName:       "cam1",
+				StartTime:     convertStartTime,
 				FilesPath: []string{
 					"a",
 				},
@@ -42,56 +59,272 @@ func TestConvertDo(t *testing.T) {
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "convert",
+							InputArgs:  map[string]string{},
+							OutputArgs: map[string]string{},
+							Suffix:     "convert",
+							Container:  "mp4",
+						},
+					},
+				})
 			},
 			inputConvert: &Convert{
-				Prefix:         "prefix",
-				RecordingDate:  "28-01-2023",
-				FileNamePrefix: "23:40:27.876-cam1",
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				CamName:       "cam1",
+				StartTime:     convertStartTime,
 				FilesPath: []string{
 					"a",
 				},
 				TotalLength: 10,
 			},
-			expectedErr: fmt.Errorf("exit status 183"),
+			expectedErr: fmt.Errorf("unable to convert profiles: convert"),
 		},
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "convert",
+							InputArgs:  map[string]string{},
+							OutputArgs: map[string]string{},
+							Suffix:     "convert",
+							Container:  "mp4",
+						},
+					},
+				})
 			},
 			inputConvert: &Convert{
-				Prefix:         "prefix",
-				RecordingDate:  "28-01-2023",
-				FileNamePrefix: "23:40:27.876-cam1",
-				FilesPath:      []string{},
-				TotalLength:    0,
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				CamName:       "cam1",
+				StartTime:     convertStartTime,
+				FilesPath:     []string{},
+				TotalLength:   0,
 			},
 		},
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{"f": "concat", "safe": "0"})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{"c:a": "copy", "c:v": "copy", "preset": "veryfast"})
-				return ctx
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "convert",
+							InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+							OutputArgs: map[string]string{"c:a": "copy", "c:v": "copy", "preset": "veryfast"},
+							Suffix:     "convert",
+							Container:  "mp4",
+						},
+					},
+				})
 			},
 			inputConvert: &Convert{
-				Prefix:         "prefix",
-				RecordingDate:  "28-01-2023",
-				FileNamePrefix: "23:40:27.876-cam1",
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				CamName:       "cam1",
+				StartTime:     convertStartTime,
 				FilesPath: []string{
 					filepath.Join(outputPath, "test_recording.mp4"),
 					filepath.Join(outputPath, "test_recording.mp4"),
 				},
 				TotalLength: 10,
 			},
+			expectedResults: []*ConvertResult{
+				{
+					Prefix:        "prefix",
+					CamName:       "cam1",
+					StartTime:     convertStartTime,
+					RecordingDate: "28-01-2023",
+					Profile:       "convert",
+					FileName:      "23:40:27.876-cam1-convert.mp4",
+					FilePath:      filepath.Join(outputPath, "prefix", "28-01-2023", "23:40:27.876-cam1-convert.mp4"),
+				},
+			},
+			expectedDuration: 10,
+		},
+		{
+			inputCtxFunc: func() context.Context {
+				ctx := context.Background()
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "evidence",
+							InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+							OutputArgs: map[string]string{"c:v": "h264", "preset": "veryfast", "vf": "scale=-2:120"},
+							Suffix:     "evidence",
+							Container:  "mp4",
+							Overlay:    &ConvertOverlay{FontSize: 12, Position: "bottom-left", Timezone: "UTC"},
+						},
+					},
+					Masks: map[string][]Mask{
+						"cam1": {
+							{Type: MaskBlur, Rect: []int{0, 0, 40, 40}},
+							{Type: MaskBlack, Polygon: [][]int{{50, 50}, {80, 50}, {60, 90}}},
+						},
+					},
+				})
+			},
+			inputConvert: &Convert{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				Tags:          map[string]string{"event": "door-open"},
+				CamName:       "cam1",
+				StartTime:     convertStartTime,
+				FilesPath: []string{
+					filepath.Join(outputPath, "test_recording.mp4"),
+				},
+				TotalLength: 5,
+			},
+			expectedResults: []*ConvertResult{
+				{
+					Prefix:        "prefix",
+					CamName:       "cam1",
+					StartTime:     convertStartTime,
+					RecordingDate: "28-01-2023",
+					Profile:       "evidence",
+					FileName:      "23:40:27.876-cam1-evidence.mp4",
+					FilePath:      filepath.Join(outputPath, "prefix", "28-01-2023", "23:40:27.876-cam1-evidence.mp4"),
+				},
+			},
+			expectedDuration: 5,
+			expectedMetadata: map[string]string{
+				"camera":        "cam1",
+				"prefix":        "prefix",
+				"profile":       "evidence",
+				"event":         "door-open",
+				"creation_time": convertStartTime.UTC().Format("2006-01-02T15:04:05.000000Z"),
+			},
+		},
+		{
+			inputCtxFunc: func() context.Context {
+				ctx := context.Background()
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "convert",
+							InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+							OutputArgs: map[string]string{"c:a": "copy", "c:v": "h264", "preset": "veryfast"},
+							Suffix:     "convert",
+							Container:  "mp4",
+						},
+					},
+				})
+			},
+			inputConvert: &Convert{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				CamName:       "cam2",
+				StartTime:     convertStartTime,
+				FilesPath: []string{
+					filepath.Join(outputPath, "test_recording.mp4"),
+					filepath.Join(outputPath, "test_recording.mp4"),
+					filepath.Join(outputPath, "test_recording.mp4"),
+				},
+				FilesOffset: []time.Duration{0, 3 * time.Second, 6 * time.Second},
+				Length:      5,
+				TotalLength: 15,
+			},
+			expectedResults: []*ConvertResult{
+				{
+					Prefix:        "prefix",
+					CamName:       "cam2",
+					StartTime:     convertStartTime,
+					RecordingDate: "28-01-2023",
+					Profile:       "convert",
+					FileName:      "23:40:27.876-cam2-convert.mp4",
+					FilePath:      filepath.Join(outputPath, "prefix", "28-01-2023", "23:40:27.876-cam2-convert.mp4"),
+				},
+			},
+			// 3 bursts, 5s each, every burst overlaps previous one by 2s.
+			expectedDuration: 11,
+		},
+		{
+			inputCtxFunc: func() context.Context {
+				ctx := context.Background()
+				return WithConfig(ctx, &ConvertConfig{
+					OutputDir: outputPath,
+					Naming:    &Naming{Convert: DefaultConvertTemplate},
+					Profiles: []ConvertProfile{
+						{
+							Name:       "archive",
+							InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+							OutputArgs: map[string]string{"c:a": "copy", "c:v": "copy"},
+							Suffix:     "archive",
+							Container:  "mp4",
+						},
+						{
+							Name:       "broken",
+							InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+							OutputArgs: map[string]string{"abc": "test"},
+							Suffix:     "broken",
+							Container:  "mp4",
+						},
+						{
+							Name:       "preview",
+							InputArgs:  map[string]string{"f": "concat", "safe": "0"},
+							OutputArgs: map[string]string{"c:v": "h264", "vf": "scale=-2:480", "an": ""},
+							Suffix:     "480p",
+							Container:  "mkv",
+							SkipUpload: true,
+						},
+					},
+				})
+			},
+			inputConvert: &Convert{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				CamName:       "cam3",
+				StartTime:     convertStartTime,
+				FilesPath: []string{
+					filepath.Join(outputPath, "test_recording.mp4"),
+				},
+				TotalLength: 5,
+			},
+			expectedResults: []*ConvertResult{
+				{
+					Prefix:        "prefix",
+					CamName:       "cam3",
+					StartTime:     convertStartTime,
+					RecordingDate: "28-01-2023",
+					Profile:       "archive",
+					FileName:      "23:40:27.876-cam3-archive.mp4",
+					FilePath:      filepath.Join(outputPath, "prefix", "28-01-2023", "23:40:27.876-cam3-archive.mp4"),
+				},
+				{
+					Prefix:        "prefix",
+					CamName:       "cam3",
+					StartTime:     convertStartTime,
+					RecordingDate: "28-01-2023",
+					Profile:       "preview",
+					FileName:      "23:40:27.876-cam3-480p.mkv",
+					FilePath:      filepath.Join(outputPath, "prefix", "28-01-2023", "23:40:27.876-cam3-480p.mkv"),
+					SkipUpload:    true,
+				},
+			},
+			expectedFailures: []*FailureResult{
+				{
+					Task:       "convert",
+					Prefix:     "prefix",
+					CamName:    "cam3",
+					FilePath:   filepath.Join(outputPath, "prefix", "28-01-2023", "23:40:27.876-cam3-broken.mp4"),
+					ErrorClass: ErrorClassUnknown,
+				},
+			},
+			expectedErr: fmt.Errorf("unable to convert profiles: broken"),
 		},
 	}
 
@@ -100,9 +333,8 @@ func TestConvertDo(t *testing.T) {
 	require.Nil(t, err)
 	defer os.RemoveAll(outputPath)
 
-	chResult := make(chan interface{}, 10)
-
 	for _, test := range tests {
+		chResult := make(chan ConvertOutput, 10)
 		createTestVideo(filepath.Join(outputPath, "test_recording.mp4"))
 
 		osMkdirAll = os.MkdirAll
@@ -121,6 +353,86 @@ func TestConvertDo(t *testing.T) {
 		} else {
 			require.Nil(t, err)
 		}
+
+		close(chResult)
+		var results []*ConvertResult
+		var failures []*FailureResult
+		for output := range chResult {
+			switch output := output.(type) {
+			case *ConvertResult:
+				results = append(results, output)
+			case *FailureResult:
+				require.NotEmpty(t, output.Error)
+				output.Error = ""
+				failures = append(failures, output)
+			}
+		}
+		require.Equal(t, test.expectedResults, results)
+		require.Equal(t, test.expectedFailures, failures)
+
+		if test.expectedDuration > 0 {
+			result, err := probe(test.expectedResults[0].FilePath)
+			require.Nil(t, err)
+			require.InDelta(t, test.expectedDuration, result.Duration(), 0.2)
+		}
+
+		if test.expectedMetadata != nil {
+			metadata, err := ReadMetadata(test.expectedResults[0].FilePath)
+			require.Nil(t, err)
+			for k, v := range test.expectedMetadata {
+				require.Equal(t, v, metadata[k])
+			}
+		}
+	}
+}
+
+func TestConcatParts(t *testing.T) {
+	tests := []struct {
+		inputFilesPath   []string
+		inputFilesOffset []time.Duration
+		inputLength      int64
+		expectedParts    []string
+	}{
+		{
+			inputFilesPath: []string{"a", "b"},
+			expectedParts:  []string{"file a", "file b"},
+		},
+		{
+			inputFilesPath:   []string{"a", "b", "c"},
+			inputFilesOffset: []time.Duration{0, 8 * time.Second, 16 * time.Second},
+			inputLength:      10,
+			expectedParts:    []string{"file a", "file b", "inpoint 2.000", "file c", "inpoint 2.000"},
+		},
+		{
+			inputFilesPath:   []string{"a", "c"},
+			inputFilesOffset: []time.Duration{0, 16 * time.Second},
+			inputLength:      10,
+			expectedParts:    []string{"file a", "file c"},
+		},
+		{
+			inputFilesPath:   []string{"b", "c"},
+			inputFilesOffset: []time.Duration{8 * time.Second, 16 * time.Second},
+			inputLength:      10,
+			expectedParts:    []string{"file b", "file c", "inpoint 2.000"},
+		},
+		{
+			// Burst a was retried after c started.
+			inputFilesPath:   []string{"a", "b", "c"},
+			inputFilesOffset: []time.Duration{19 * time.Second, 8 * time.Second, 16 * time.Second},
+			inputLength:      10,
+			expectedParts:    []string{"file b", "file c", "inpoint 2.000", "file a", "inpoint 7.000"},
+		},
+		{
+			// Burst b started with a, so it is covered by a.
+			inputFilesPath:   []string{"a", "b", "c"},
+			inputFilesOffset: []time.Duration{0, 0, 8 * time.Second},
+			inputLength:      10,
+			expectedParts:    []string{"file a", "file c", "inpoint 2.000"},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedParts, concatParts(test.inputFilesPath, test.inputFilesOffset, test.inputLength))
 	}
 }
 
@@ -185,7 +497,11 @@ func TestFFMEGConvert(t *testing.T) {
 				osWriteFile = os.WriteFile
 			}()
 		}
-		err = ffmpegConvert(test.inputFFMPEGInputFiles, filepath.Join(outputPath, "test_output.mp4"), test.inputFFMPEGInputArgs, test.inputFFMPEGOutputArgs, 5)
+		err = ffmpegConvert(concatParts(test.inputFFMPEGInputFiles, nil, 0), filepath.Join(outputPath, "test_output.mp4"), test.inputFFMPEGInputArgs, test.inputFFMPEGOutputArgs, nil, 5, 0, nil)
+		var ffmpegErr *FFmpegError
+		if errors.As(err, &ffmpegErr) {
+			err = ffmpegErr.Err
+		}
 		if test.expectedErr != nil {
 			require.Equal(t, test.expectedErr.Error(), err.Error())
 		}
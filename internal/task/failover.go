@@ -0,0 +1,156 @@
+package task
+
+import (
+	"log"
+	"maps"
+	"net/url"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"recorder/internal/job"
+)
+
+var (
+	// mocks for tests.
+	ffmpegMajorVersion = sync.OnceValue(detectFFmpegVersion)
+)
+
+var sourceFailures = struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int64
+}{counts: make(map[string]map[string]int64)}
+
+// sources returns streams of burst in order they are tried: streams from request, then streams of camera.
+// Named streams are recorded only from their own URL.
+func (r *Record) sources(config *RecordConfig) []string {
+	cameraStreams := config.Streams[r.CamName]
+	if r.StreamName != "" {
+		cameraStreams = nil
+	}
+	var sources []string
+	for _, stream := range slices.Concat([]string{r.Stream}, r.Streams, cameraStreams) {
+		if stream != "" && !slices.Contains(sources, stream) {
+			sources = append(sources, stream)
+		}
+	}
+	return sources
+}
+
+// recordFromSources records piece from the first source which works.
+// Source works when it records anything, even when it drops later. Used source is returned without credentials.
+func (r *Record) recordFromSources(config *RecordConfig, sources []string, piecePath string, outputArgs, metadata map[string]string, length int64, onProgress func(*job.Progress)) (string, error) {
+	stall := time.Duration(config.StallTimeout) * time.Second
+	var err error
+	for i, source := range sources {
+		sourceMetadata := maps.Clone(metadata)
+		sourceMetadata["source"] = redactURL(source)
+
+		var input string
+		var inputArgs map[string]string
+		var release func()
+		input, inputArgs, release, err = r.input(config, source, len(sources) > 1)
+		if err == nil {
+			err = recordPiece(input, piecePath, inputArgs, outputArgs, sourceMetadata, length, stall, onProgress)
+			release()
+		}
+		if err == nil || pieceDuration(piecePath) > 0 {
+			return redactURL(source), err
+		}
+		osRemove(piecePath)
+		countSourceFailure(r.CamName, redactURL(source))
+		if i < len(sources)-1 {
+			log.Printf("source %s of %s failed, trying next one: %v", redactURL(source), r.CamName, err)
+		}
+	}
+	return "", err
+}
+
+// failoverInputArgs returns input args of source.
+// When there are other sources to try, rtsp sources get socket timeout, so dead source fails fast.
+func failoverInputArgs(config *RecordConfig, source string, failover bool) map[string]string {
+	if !failover || config.FailoverTimeout <= 0 || !strings.HasPrefix(source, "rtsp://") {
+		return config.InputArgs
+	}
+	for _, option := range []string{"timeout", "stimeout"} {
+		if _, ok := config.InputArgs[option]; ok {
+			return config.InputArgs
+		}
+	}
+	inputArgs := maps.Clone(config.InputArgs)
+	if inputArgs == nil {
+		inputArgs = make(map[string]string)
+	}
+	inputArgs[rtspTimeoutOption()] = strconv.FormatInt((time.Duration(config.FailoverTimeout) * time.Second).Microseconds(), 10)
+	return inputArgs
+}
+
+// rtspTimeoutOption returns name of rtsp socket timeout option.
+// ffmpeg 4.x calls it stimeout, since 5.0 it's timeout (which was listen timeout before).
+func rtspTimeoutOption() string {
+	if version := ffmpegMajorVersion(); version > 0 && version < 5 {
+		return "stimeout"
+	}
+	return "timeout"
+}
+
+// detectFFmpegVersion returns major version of installed ffmpeg, 0 when it's unknown.
+func detectFFmpegVersion() int {
+	output, err := exec.Command("ffmpeg", "-version").Output()
+	if err != nil {
+		log.Printf("unable to detect ffmpeg version: %v", err)
+		return 0
+	}
+	return parseFFmpegVersion(string(output))
+}
+
+// parseFFmpegVersion returns major version from ffmpeg -version output, e.g. "ffmpeg version 4.4.2-0ubuntu0.22.04.1".
+// Builds from git (e.g. "N-109500-g...") have no version and are assumed to be recent.
+func parseFFmpegVersion(output string) int {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != "ffmpeg" || fields[1] != "version" {
+		return 0
+	}
+	version := strings.TrimPrefix(fields[2], "n")
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// redactURL returns stream URL without credentials.
+func redactURL(stream string) string {
+	u, err := url.Parse(stream)
+	if err != nil || u.User == nil {
+		return stream
+	}
+	u.User = nil
+	return u.String()
+}
+
+func countSourceFailure(camName, source string) {
+	sourceFailures.mu.Lock()
+	defer sourceFailures.mu.Unlock()
+
+	if sourceFailures.counts[camName] == nil {
+		sourceFailures.counts[camName] = make(map[string]int64)
+	}
+	sourceFailures.counts[camName][source]++
+}
+
+// SourceFailures returns number of failed sources, by camera and source.
+func SourceFailures() map[string]map[string]int64 {
+	sourceFailures.mu.Lock()
+	defer sourceFailures.mu.Unlock()
+
+	counts := make(map[string]map[string]int64)
+	for camName, sources := range sourceFailures.counts {
+		counts[camName] = maps.Clone(sources)
+	}
+	return counts
+}
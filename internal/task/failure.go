@@ -0,0 +1,191 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Classes of ffmpeg failures.
+const (
+	ErrorClassAuth       = "auth_failed"
+	ErrorClassConnection = "connection_refused"
+	ErrorClassNotFound   = "stream_not_found"
+	ErrorClassCodec      = "codec_unsupported"
+	ErrorClassTimeout    = "timeout"
+	ErrorClassDiskFull   = "disk_full"
+	ErrorClassUnknown    = "unknown"
+)
+
+// StatusFailed is reported when ffmpeg failed and output was removed.
+const StatusFailed = "failed"
+
+var (
+	stderrBufferSize = 16 * 1024
+
+	// errorPatterns are matched against lowercase ffmpeg stderr, first matching class wins.
+	errorPatterns = []struct {
+		class    string
+		patterns []string
+	}{
+		{ErrorClassDiskFull, []string{"no space left on device", "disk quota exceeded"}},
+		{ErrorClassAuth, []string{"401 unauthorized", "403 forbidden", "authorization failed"}},
+		{ErrorClassNotFound, []string{"404 not found", "454 session not found", "no such file or directory", "server returned 404"}},
+		{ErrorClassCodec, []string{"unknown encoder", "encoder not found", "decoder not found", "not currently supported in container", "could not find tag for codec", "unsupported codec"}},
+		{ErrorClassTimeout, []string{"timed out"}},
+		{ErrorClassConnection, []string{"connection refused", "no route to host", "network is unreachable", "connection reset by peer", "name or service not known"}},
+	}
+
+	ffmpegErrors = struct {
+		mu     sync.Mutex
+		counts map[string]map[string]int64
+	}{counts: make(map[string]map[string]int64)}
+)
+
+// FFmpegError describes failed ffmpeg process.
+// Stderr contains tail of ffmpeg output.
+type FFmpegError struct {
+	Class  string
+	Stderr string
+	Err    error
+}
+
+func (e *FFmpegError) Error() string {
+	lines := strings.Split(strings.TrimSpace(e.Stderr), "\n")
+	return fmt.Sprintf("ffmpeg failed (%s): %v: %s", e.Class, e.Err, lines[len(lines)-1])
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// FailureResult is published by Record, Convert and Analyze tasks when ffmpeg fails.
+// Task is name of failed task, e.g. record.
+type FailureResult struct {
+	Task       string
+	JobID      string
+	Prefix     string
+	CamName    string
+	FilePath   string
+	ErrorClass string
+	Error      string
+	EventID    string
+	StreamName string
+}
+
+func (*FailureResult) recordResult()  {}
+func (*FailureResult) convertOutput() {}
+func (*FailureResult) analyzeOutput() {}
+
+// WebhookTask returns failure event.
+func (r *FailureResult) WebhookTask() *Webhook {
+	return &Webhook{
+		Event:   "failure",
+		JobID:   r.JobID,
+		EventID: r.EventID,
+		Stream:  r.StreamName,
+		Time:    timeNow(),
+		Data: map[string]string{
+			"task":        r.Task,
+			"prefix":      r.Prefix,
+			"cam_name":    r.CamName,
+			"file_name":   filepath.Base(r.FilePath),
+			"error_class": r.ErrorClass,
+			"error":       r.Error,
+		},
+	}
+}
+
+// ringBuffer keeps last size bytes written to it.
+type ringBuffer struct {
+	mu   sync.Mutex
+	buf  []byte
+	size int
+	cut  bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.size; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+		b.cut = true
+	}
+	return len(p), nil
+}
+
+// String returns buffered output, without line which was cut in half.
+func (b *ringBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := string(b.buf)
+	if b.cut {
+		if _, rest, ok := strings.Cut(s, "\n"); ok {
+			return rest
+		}
+	}
+	return s
+}
+
+// classifyStderr returns class of ffmpeg failure, based on its stderr.
+// Process killed after deadline is classified as timeout when stderr doesn't tell more.
+func classifyStderr(stderr string, timedOut bool) string {
+	stderr = strings.ToLower(stderr)
+	for _, p := range errorPatterns {
+		for _, pattern := range p.patterns {
+			if strings.Contains(stderr, pattern) {
+				return p.class
+			}
+		}
+	}
+	if timedOut {
+		return ErrorClassTimeout
+	}
+	return ErrorClassUnknown
+}
+
+// errorClass returns class of ffmpeg failure wrapped in err, or empty string.
+func errorClass(err error) string {
+	var ffmpegErr *FFmpegError
+	if errors.As(err, &ffmpegErr) {
+		return ffmpegErr.Class
+	}
+	return ""
+}
+
+// countFFmpegError counts ffmpeg failure of task, other errors are ignored.
+func countFFmpegError(task string, err error) {
+	class := errorClass(err)
+	if class == "" {
+		return
+	}
+	ffmpegErrors.mu.Lock()
+	defer ffmpegErrors.mu.Unlock()
+
+	if ffmpegErrors.counts[task] == nil {
+		ffmpegErrors.counts[task] = make(map[string]int64)
+	}
+	ffmpegErrors.counts[task][class]++
+}
+
+// FFmpegErrors returns number of ffmpeg failures, by task and class.
+func FFmpegErrors() map[string]map[string]int64 {
+	ffmpegErrors.mu.Lock()
+	defer ffmpegErrors.mu.Unlock()
+
+	counts := make(map[string]map[string]int64)
+	for task, classes := range ffmpegErrors.counts {
+		counts[task] = maps.Clone(classes)
+	}
+	return counts
+}
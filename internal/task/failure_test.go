@@ -0,0 +1,117 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		inputStderr   string
+		inputTimedOut bool
+		expectedClass string
+	}{
+		{
+			inputStderr:   "[rtsp @ 0x55d0c8a0] method DESCRIBE failed: 401 Unauthorized\nrtsp://cam1/stream: Server returned 401 Unauthorized (authorization failed)",
+			expectedClass: ErrorClassAuth,
+		},
+		{
+			inputStderr:   "[tcp @ 0x55d0c8a0] Connection to tcp://10.0.0.10:554?timeout=0 failed: Connection refused\nrtsp://10.0.0.10/stream: Connection refused",
+			expectedClass: ErrorClassConnection,
+		},
+		{
+			inputStderr:   "[rtsp @ 0x55d0c8a0] method DESCRIBE failed: 404 Not Found\nrtsp://cam1/missing: Server returned 404 Not Found",
+			expectedClass: ErrorClassNotFound,
+		},
+		{
+			inputStderr:   "Unknown encoder 'h264_vaapi'",
+			expectedClass: ErrorClassCodec,
+		},
+		{
+			inputStderr:   "[tcp @ 0x55d0c8a0] Connection to tcp://10.0.0.10:554 failed: Connection timed out",
+			expectedClass: ErrorClassTimeout,
+		},
+		{
+			inputStderr:   "[mp4 @ 0x55d0c8a0] Error writing trailer: No space left on device",
+			expectedClass: ErrorClassDiskFull,
+		},
+		{
+			inputStderr:   "frame=  100 fps= 25 q=-1.0 size=    1024kB time=00:00:04.00",
+			inputTimedOut: true,
+			expectedClass: ErrorClassTimeout,
+		},
+		{
+			inputStderr:   "Unrecognized option 'abc'.\nError splitting the argument list: Option not found",
+			expectedClass: ErrorClassUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedClass, classifyStderr(test.inputStderr, test.inputTimedOut))
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	b := newRingBuffer(16)
+	fmt.Fprint(b, "line 1\n")
+	require.Equal(t, "line 1\n", b.String())
+
+	// Line which was cut in half is dropped.
+	fmt.Fprint(b, "line 2\nline 3\n")
+	require.Equal(t, "line 2\nline 3\n", b.String())
+}
+
+func TestFFmpegError(t *testing.T) {
+	err := fmt.Errorf("unable to record: %w", &FFmpegError{
+		Class:  ErrorClassConnection,
+		Stderr: "ffmpeg version 6.0\nrtsp://cam1/stream: Connection refused\n",
+		Err:    errors.New("exit status 1"),
+	})
+	require.Equal(t, "unable to record: ffmpeg failed (connection_refused): exit status 1: rtsp://cam1/stream: Connection refused", err.Error())
+	require.Equal(t, ErrorClassConnection, errorClass(err))
+	require.Equal(t, "", errorClass(errors.New("mock error")))
+
+	countFFmpegError("test", err)
+	countFFmpegError("test", err)
+	countFFmpegError("test", errors.New("mock error"))
+	require.Equal(t, map[string]int64{ErrorClassConnection: 2}, FFmpegErrors()["test"])
+}
+
+func TestFailureResultWebhookTask(t *testing.T) {
+	now := time.Date(2023, 2, 20, 7, 36, 36, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	r := &FailureResult{
+		Task:       "record",
+		JobID:      "job",
+		Prefix:     "prefix",
+		CamName:    "cam1",
+		FilePath:   "/data/prefix/20-02-2023/07:36:36.000-cam1-001-001.mp4",
+		ErrorClass: ErrorClassAuth,
+		Error:      "ffmpeg failed (auth_failed): exit status 1: 401 Unauthorized",
+		EventID:    "event1",
+		StreamName: "sub",
+	}
+	require.Equal(t, &Webhook{
+		Event:   "failure",
+		JobID:   "job",
+		EventID: "event1",
+		Stream:  "sub",
+		Time:    now,
+		Data: map[string]string{
+			"task":        "record",
+			"prefix":      "prefix",
+			"cam_name":    "cam1",
+			"file_name":   "07:36:36.000-cam1-001-001.mp4",
+			"error_class": "auth_failed",
+			"error":       "ffmpeg failed (auth_failed): exit status 1: 401 Unauthorized",
+		},
+	}, r.WebhookTask())
+}
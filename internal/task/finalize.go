@@ -0,0 +1,106 @@
+package task
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	// FinalizeOK is reported when recording was remuxed without errors.
+	FinalizeOK = "ok"
+	// FinalizeRepaired is reported when broken recording was recovered.
+	FinalizeRepaired = "repaired"
+	// FinalizeUnrecoverable is reported when nothing could be recovered, recording is removed.
+	FinalizeUnrecoverable = "unrecoverable"
+)
+
+var (
+	errNoVideo       = errors.New("no decodable video")
+	errUnrecoverable = errors.New("recording is unrecoverable")
+
+	// mocks for tests.
+	ffmpegRemux = remux
+	osRename    = os.Rename
+	osRemove    = os.Remove
+)
+
+// finalize remuxes recorded file in place, moving moov atom to the beginning of mp4 files.
+// When recording failed or remux fails, it tries to recover whatever is decodable.
+// Unrecoverable recordings are removed, length of recording limits remux time.
+func finalize(filePath string, container *Container, length int64, stall time.Duration, recordErr error) string {
+	if _, err := osStat(filePath); err != nil {
+		return FinalizeUnrecoverable
+	}
+
+	if recordErr == nil {
+		err := remuxInPlace(filePath, container, length, stall, false)
+		if err == nil {
+			return FinalizeOK
+		}
+		log.Printf("unable to remux %s, trying to repair: %v", filePath, err)
+	}
+
+	if err := remuxInPlace(filePath, container, length, stall, true); err != nil {
+		log.Printf("unable to repair %s: %v", filePath, err)
+		osRemove(filePath)
+		return FinalizeUnrecoverable
+	}
+	return FinalizeRepaired
+}
+
+// remuxInPlace remuxes filePath into temporary file and replaces original with it.
+// Remuxed file is accepted only when it contains decodable video.
+func remuxInPlace(filePath string, container *Container, length int64, stall time.Duration, repair bool) error {
+	ext := filepath.Ext(filePath)
+	tmpPath := strings.TrimSuffix(filePath, ext) + ".finalize" + ext
+
+	if err := ffmpegRemux(filePath, tmpPath, finalizeArgs(container), repair, length, stall); err != nil {
+		osRemove(tmpPath)
+		return err
+	}
+	result, err := probe(tmpPath)
+	if err == nil && result.Duration() <= 0 {
+		err = errNoVideo
+	}
+	if err != nil {
+		osRemove(tmpPath)
+		return err
+	}
+	return osRename(tmpPath, filePath)
+}
+
+// finalizeArgs returns output args used to remux recording stored in container.
+// Fragmented mp4 is already playable while written, so faststart is used only for regular mp4.
+func finalizeArgs(container *Container) map[string]string {
+	outputArgs := withContainer(map[string]string{"c": "copy", "map_metadata": "0"}, container)
+	if outputArgs["f"] == "mp4" {
+		movflags := "+use_metadata_tags"
+		if container.MovFlags == "" {
+			movflags = "+faststart" + movflags
+		}
+		outputArgs["movflags"] = outputArgs["movflags"] + movflags
+	}
+	return outputArgs
+}
+
+func remux(inputFile, outputFile string, outputArgs map[string]string, repair bool, length int64, stall time.Duration) error {
+	inputKwArgs := ffmpeg.KwArgs{}
+	outputKwArgs := ffmpeg.KwArgs{}
+
+	if repair {
+		inputKwArgs["err_detect"] = "ignore_err"
+		inputKwArgs["fflags"] = "+genpts+discardcorrupt"
+	}
+	for k, v := range outputArgs {
+		outputKwArgs[k] = v
+	}
+
+	return runFFmpeg(ffmpeg.Input(inputFile, inputKwArgs).Output(outputFile, outputKwArgs).OverWriteOutput(),
+		time.Duration(length*int64(ffmpegRecordRatio))*time.Second, stall, nil)
+}
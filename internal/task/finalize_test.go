@@ -0,0 +1,130 @@
+package task
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestFinalize(t *testing.T) {
+	okProbe := func(string, ...ffmpeg.KwArgs) (string, error) {
+		return `{"format": {"duration": "5.000000"}}`, nil
+	}
+	emptyProbe := func(string, ...ffmpeg.KwArgs) (string, error) {
+		return `{"format": {"duration": "0.000000"}}`, nil
+	}
+
+	tests := []struct {
+		inputRecordErr  error
+		inputMissing    bool
+		mockRemuxErr    map[bool]error
+		mockProbe       func(string, ...ffmpeg.KwArgs) (string, error)
+		expectedStatus  string
+		expectedRepairs []bool
+		expectedExists  bool
+	}{
+		{
+			mockProbe:       okProbe,
+			expectedStatus:  FinalizeOK,
+			expectedRepairs: []bool{false},
+			expectedExists:  true,
+		},
+		{
+			mockRemuxErr:    map[bool]error{false: errors.New("moov atom not found")},
+			mockProbe:       okProbe,
+			expectedStatus:  FinalizeRepaired,
+			expectedRepairs: []bool{false, true},
+			expectedExists:  true,
+		},
+		{
+			inputRecordErr:  errors.New("signal: killed"),
+			mockProbe:       okProbe,
+			expectedStatus:  FinalizeRepaired,
+			expectedRepairs: []bool{true},
+			expectedExists:  true,
+		},
+		{
+			inputRecordErr:  errors.New("signal: killed"),
+			mockProbe:       emptyProbe,
+			expectedStatus:  FinalizeUnrecoverable,
+			expectedRepairs: []bool{true},
+		},
+		{
+			inputRecordErr:  errors.New("signal: killed"),
+			mockRemuxErr:    map[bool]error{true: errors.New("invalid data")},
+			mockProbe:       okProbe,
+			expectedStatus:  FinalizeUnrecoverable,
+			expectedRepairs: []bool{true},
+		},
+		{
+			inputRecordErr: errors.New("connection refused"),
+			inputMissing:   true,
+			expectedStatus: FinalizeUnrecoverable,
+		},
+	}
+
+	defer func() {
+		ffmpegRemux = remux
+		ffmpegProbe = ffmpeg.Probe
+	}()
+
+	for _, test := range tests {
+		filePath := filepath.Join(t.TempDir(), "cam1-001-001.mp4")
+		if !test.inputMissing {
+			require.Nil(t, os.WriteFile(filePath, []byte("recording"), 0644))
+		}
+
+		var repairs []bool
+		ffmpegRemux = func(inputFile, outputFile string, outputArgs map[string]string, repair bool, length int64, stall time.Duration) error {
+			require.Equal(t, int64(10), length)
+			require.Equal(t, 5*time.Second, stall)
+			repairs = append(repairs, repair)
+			if err := test.mockRemuxErr[repair]; err != nil {
+				return err
+			}
+			return os.WriteFile(outputFile, []byte("remuxed"), 0644)
+		}
+		ffmpegProbe = test.mockProbe
+
+		require.Equal(t, test.expectedStatus, finalize(filePath, containers["mp4"], 10, 5*time.Second, test.inputRecordErr))
+		require.Equal(t, test.expectedRepairs, repairs)
+
+		files, _ := filepath.Glob(filepath.Join(filepath.Dir(filePath), "*"))
+		if test.expectedExists {
+			require.Equal(t, []string{filePath}, files)
+			b, _ := os.ReadFile(filePath)
+			require.Equal(t, "remuxed", string(b))
+		} else {
+			require.Empty(t, files)
+		}
+	}
+}
+
+func TestFinalizeArgs(t *testing.T) {
+	tests := []struct {
+		inputContainer     string
+		expectedOutputArgs map[string]string
+	}{
+		{
+			inputContainer:     "mp4",
+			expectedOutputArgs: map[string]string{"c": "copy", "map_metadata": "0", "f": "mp4", "movflags": "+faststart+use_metadata_tags"},
+		},
+		{
+			inputContainer:     "fmp4",
+			expectedOutputArgs: map[string]string{"c": "copy", "map_metadata": "0", "f": "mp4", "movflags": "frag_keyframe+empty_moov+default_base_moof+use_metadata_tags"},
+		},
+		{
+			inputContainer:     "mkv",
+			expectedOutputArgs: map[string]string{"c": "copy", "map_metadata": "0", "f": "matroska"},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedOutputArgs, finalizeArgs(containers[test.inputContainer]))
+	}
+}
@@ -0,0 +1,301 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	errIngestStopped  = errors.New("ingest stopped")
+	errIngestNotReady = errors.New("ingest is not ready")
+
+	ingestPollInterval = 100 * time.Millisecond
+	// ingestInputArgs are used by recordings of ingest, playback starts at the newest segment.
+	ingestInputArgs = map[string]string{"live_start_index": "-1"}
+
+	ingestStats = struct {
+		mu          sync.Mutex
+		consumers   map[string]int64
+		connections map[string]int64
+	}{consumers: make(map[string]int64), connections: make(map[string]int64)}
+
+	// mocks for tests.
+	ingestStream = ffmpegIngest
+	osRemoveAll  = os.RemoveAll
+)
+
+// Ingest keeps single upstream connection of every stream while any recording or snapshot needs it.
+// Stream is restreamed into rolling HLS playlist in Dir, recordings read the playlist.
+// Connections are shared only with the same input args. Probes and camera monitor bypass it, they check camera itself.
+type Ingest struct {
+	Dir          string
+	IdleTimeout  int // Seconds without recordings before upstream connection is closed.
+	ReadyTimeout int // Seconds to wait for the first segment.
+	SegmentTime  int // Length of segments in seconds.
+	ListSize     int // Segments kept in playlist.
+	StallTimeout int // Seconds without ffmpeg progress before upstream connection is closed, 0 disables it.
+
+	mu       sync.Mutex
+	sessions map[string]*ingestSession // By source and input args.
+}
+
+// ingestSession describes single upstream connection.
+type ingestSession struct {
+	key       string
+	source    string
+	playlist  string
+	consumers int
+	idle      *time.Timer
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+}
+
+// IngestStats describes shared upstream connection of single stream.
+type IngestStats struct {
+	Consumers   int64
+	Connections int64
+}
+
+// Acquire returns playlist of source, upstream connection is opened when there is none.
+// Returned release has to be called when recording is finished.
+func (in *Ingest) Acquire(source string, inputArgs map[string]string) (string, func(), error) {
+	in.mu.Lock()
+	if in.sessions == nil {
+		in.sessions = make(map[string]*ingestSession)
+	}
+	key := ingestKey(source, inputArgs)
+	s, ok := in.sessions[key]
+	if !ok || s.stopped() {
+		s = in.start(key, source, inputArgs)
+		in.sessions[key] = s
+	}
+	s.consumers++
+	if s.idle != nil {
+		s.idle.Stop()
+		s.idle = nil
+	}
+	setIngestConsumers(source, in.consumers(source))
+	in.mu.Unlock()
+
+	if err := in.waitReady(s); err != nil {
+		in.release(s)
+		return "", nil, err
+	}
+	return s.playlist, func() { in.release(s) }, nil
+}
+
+// Close closes all upstream connections.
+func (in *Ingest) Close() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for key, s := range in.sessions {
+		s.cancel()
+		delete(in.sessions, key)
+		setIngestConsumers(s.source, 0)
+	}
+}
+
+// ingestKey returns key of session, connections with different input args aren't shared.
+func ingestKey(source string, inputArgs map[string]string) string {
+	key := []string{source}
+	for _, k := range slices.Sorted(maps.Keys(inputArgs)) {
+		key = append(key, k+"="+inputArgs[k])
+	}
+	return strings.Join(key, " ")
+}
+
+// consumers returns consumers of every session of source, ingest lock has to be held.
+func (in *Ingest) consumers(source string) int {
+	consumers := 0
+	for _, s := range in.sessions {
+		if s.source == source {
+			consumers += s.consumers
+		}
+	}
+	return consumers
+}
+
+// start opens upstream connection of source.
+func (in *Ingest) start(key, source string, inputArgs map[string]string) *ingestSession {
+	// Closed connection can still be writing its segments, so every connection has its own directory.
+	dir := filepath.Join(in.Dir, uuid.New().String())
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ingestSession{
+		key:      key,
+		source:   source,
+		playlist: filepath.Join(dir, "index.m3u8"),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	countIngestConnection(source)
+	log.Printf("opening ingest of %s", redactURL(source))
+
+	go func() {
+		defer close(s.done)
+		defer osRemoveAll(dir)
+
+		if err := osMkdirAll(dir, 0755); err != nil {
+			log.Printf("unable to create %s: %v", dir, err)
+			s.err = err
+			return
+		}
+		stall := time.Duration(in.StallTimeout) * time.Second
+		s.err = ingestStream(ctx, source, s.playlist, inputArgs, in.SegmentTime, in.ListSize, stall)
+		if ctx.Err() != nil {
+			log.Printf("closed ingest of %s", redactURL(source))
+			return
+		}
+		if s.err == nil {
+			s.err = errIngestStopped
+		}
+		log.Printf("ingest of %s stopped: %v", redactURL(source), s.err)
+	}()
+	return s
+}
+
+// waitReady waits until playlist of session is written.
+func (in *Ingest) waitReady(s *ingestSession) error {
+	deadline := timeNow().Add(time.Duration(in.ReadyTimeout) * time.Second)
+	for {
+		if _, err := osStat(s.playlist); err == nil {
+			return nil
+		}
+		select {
+		case <-s.done:
+			return fmt.Errorf("unable to open ingest: %w", s.err)
+		case <-time.After(ingestPollInterval):
+		}
+		if timeNow().After(deadline) {
+			return fmt.Errorf("%w after %ds", errIngestNotReady, in.ReadyTimeout)
+		}
+	}
+}
+
+// release removes consumer of session.
+// Upstream connection is closed after idle timeout, when nothing acquired it again.
+func (in *Ingest) release(s *ingestSession) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	s.consumers--
+	current := in.sessions[s.key] == s
+	if current {
+		setIngestConsumers(s.source, in.consumers(s.source))
+	}
+	if s.consumers > 0 {
+		return
+	}
+	if !current || s.stopped() {
+		s.cancel()
+		if current {
+			delete(in.sessions, s.key)
+		}
+		return
+	}
+	s.idle = time.AfterFunc(time.Duration(in.IdleTimeout)*time.Second, func() {
+		in.mu.Lock()
+		defer in.mu.Unlock()
+
+		if s.consumers == 0 && in.sessions[s.key] == s {
+			delete(in.sessions, s.key)
+			s.cancel()
+		}
+	})
+}
+
+// stopped reports whether upstream connection was closed.
+func (s *ingestSession) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// input returns input of recording from source.
+// Network streams are read from shared ingest, when it is enabled.
+func (r *Record) input(config *RecordConfig, source string, failover bool) (string, map[string]string, func(), error) {
+	return ingestInput(config.Ingest, source, failoverInputArgs(config, source, failover))
+}
+
+// ingestInput returns input and its args for source, network streams are read from ingest when it isn't nil.
+// Returned release has to be called when input isn't needed anymore.
+func ingestInput(ingest *Ingest, source string, inputArgs map[string]string) (string, map[string]string, func(), error) {
+	if ingest == nil || !isNetworkStream(source) {
+		return source, inputArgs, func() {}, nil
+	}
+	playlist, release, err := ingest.Acquire(source, inputArgs)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return playlist, ingestInputArgs, release, nil
+}
+
+// isNetworkStream reports whether source is read over network, e.g. rtsp:// URL.
+func isNetworkStream(source string) bool {
+	u, err := url.Parse(source)
+	return err == nil && u.Scheme != "" && u.Scheme != "file"
+}
+
+func setIngestConsumers(source string, consumers int) {
+	ingestStats.mu.Lock()
+	defer ingestStats.mu.Unlock()
+
+	ingestStats.consumers[redactURL(source)] = int64(consumers)
+}
+
+func countIngestConnection(source string) {
+	ingestStats.mu.Lock()
+	defer ingestStats.mu.Unlock()
+
+	ingestStats.connections[redactURL(source)]++
+}
+
+// Ingests returns shared upstream connections, by source.
+func Ingests() map[string]IngestStats {
+	ingestStats.mu.Lock()
+	defer ingestStats.mu.Unlock()
+
+	stats := make(map[string]IngestStats)
+	for source := range ingestStats.connections {
+		stats[source] = IngestStats{
+			Consumers:   ingestStats.consumers[source],
+			Connections: ingestStats.connections[source],
+		}
+	}
+	return stats
+}
+
+// ffmpegIngest restreams source into rolling HLS playlist until ctx is canceled or stream drops.
+func ffmpegIngest(ctx context.Context, source, playlist string, inputArgs map[string]string, segmentTime, listSize int, stall time.Duration) error {
+	inputKwArgs := ffmpeg.KwArgs{}
+	for k, v := range inputArgs {
+		inputKwArgs[k] = v
+	}
+
+	stream := ffmpeg.Input(source, inputKwArgs).Output(playlist, ffmpeg.KwArgs{
+		"c":             "copy",
+		"f":             "hls",
+		"hls_time":      segmentTime,
+		"hls_list_size": listSize,
+		"hls_flags":     "delete_segments+omit_endlist",
+	})
+	stream.Context = ctx
+	return runFFmpeg(stream, 0, stall, nil)
+}
@@ -0,0 +1,143 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestAcquire(t *testing.T) {
+	var started, closed atomic.Int64
+	defer func() {
+		ingestStream = ffmpegIngest
+	}()
+	ingestStream = func(ctx context.Context, source, playlist string, _ map[string]string, _, _ int, _ time.Duration) error {
+		started.Add(1)
+		defer closed.Add(1)
+		if source == "rtsp://cam1/broken" {
+			return errors.New("mock error")
+		}
+		if source == "rtsp://cam1/slow" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		if err := os.WriteFile(playlist, []byte("#EXTM3U"), 0644); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ingest := &Ingest{Dir: t.TempDir(), IdleTimeout: 0, ReadyTimeout: 1}
+	defer ingest.Close()
+
+	playlist1, release1, err := ingest.Acquire("rtsp://cam1/main", nil)
+	require.Nil(t, err)
+	playlist2, release2, err := ingest.Acquire("rtsp://cam1/main", nil)
+	require.Nil(t, err)
+	require.Equal(t, playlist1, playlist2)
+	require.Equal(t, "index.m3u8", filepath.Base(playlist1))
+	require.Equal(t, int64(1), started.Load())
+	require.Equal(t, IngestStats{Consumers: 2, Connections: 1}, Ingests()["rtsp://cam1/main"])
+
+	// Connection with other input args isn't shared.
+	playlistTCP, releaseTCP, err := ingest.Acquire("rtsp://cam1/main", map[string]string{"rtsp_transport": "tcp"})
+	require.Nil(t, err)
+	require.NotEqual(t, playlist1, playlistTCP)
+	require.Equal(t, int64(2), started.Load())
+	require.Equal(t, IngestStats{Consumers: 3, Connections: 2}, Ingests()["rtsp://cam1/main"])
+	releaseTCP()
+	require.Eventually(t, func() bool { return closed.Load() == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, IngestStats{Consumers: 2, Connections: 2}, Ingests()["rtsp://cam1/main"])
+
+	// Connection is kept while any recording uses it.
+	release1()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(1), closed.Load())
+
+	// Connection is closed after idle timeout and its segments are removed.
+	release2()
+	require.Eventually(t, func() bool { return closed.Load() == 2 }, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Dir(playlist1))
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+
+	// Next recording opens new connection.
+	playlist3, release3, err := ingest.Acquire("rtsp://cam1/main", nil)
+	require.Nil(t, err)
+	require.NotEqual(t, playlist1, playlist3)
+	require.Equal(t, int64(3), started.Load())
+	release3()
+
+	_, _, err = ingest.Acquire("rtsp://cam1/broken", nil)
+	require.EqualError(t, err, "unable to open ingest: mock error")
+
+	_, _, err = ingest.Acquire("rtsp://cam1/slow", nil)
+	require.True(t, errors.Is(err, errIngestNotReady))
+	require.Eventually(t, func() bool { return closed.Load() == 5 }, time.Second, 10*time.Millisecond)
+}
+
+func TestIngestKey(t *testing.T) {
+	require.Equal(t, "rtsp://cam1/main", ingestKey("rtsp://cam1/main", nil))
+	require.Equal(t, "rtsp://cam1/main rtsp_transport=tcp timeout=5000000", ingestKey("rtsp://cam1/main", map[string]string{"timeout": "5000000", "rtsp_transport": "tcp"}))
+}
+
+func TestRecordInput(t *testing.T) {
+	defer func() {
+		ingestStream = ffmpegIngest
+	}()
+	ingestStream = func(ctx context.Context, _, playlist string, inputArgs map[string]string, _, _ int, _ time.Duration) error {
+		require.Equal(t, map[string]string{"rtsp_transport": "tcp"}, inputArgs)
+		if err := os.WriteFile(playlist, []byte("#EXTM3U"), 0644); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	}
+
+	ingest := &Ingest{Dir: t.TempDir(), ReadyTimeout: 1}
+	defer ingest.Close()
+
+	tests := []struct {
+		inputConfig       *RecordConfig
+		inputSource       string
+		expectedIngest    bool
+		expectedInputArgs map[string]string
+	}{
+		{
+			inputConfig:       &RecordConfig{InputArgs: map[string]string{"rtsp_transport": "tcp"}},
+			inputSource:       "rtsp://cam1/main",
+			expectedInputArgs: map[string]string{"rtsp_transport": "tcp"},
+		},
+		{
+			inputConfig:       &RecordConfig{InputArgs: map[string]string{"rtsp_transport": "tcp"}, Ingest: ingest},
+			inputSource:       "/tmp/recording.mp4",
+			expectedInputArgs: map[string]string{"rtsp_transport": "tcp"},
+		},
+		{
+			inputConfig:       &RecordConfig{InputArgs: map[string]string{"rtsp_transport": "tcp"}, Ingest: ingest},
+			inputSource:       "rtsp://cam1/main",
+			expectedIngest:    true,
+			expectedInputArgs: ingestInputArgs,
+		},
+	}
+
+	for _, test := range tests {
+		input, inputArgs, release, err := (&Record{CamName: "cam1"}).input(test.inputConfig, test.inputSource, false)
+		require.Nil(t, err)
+		if test.expectedIngest {
+			require.Equal(t, "index.m3u8", filepath.Base(input))
+		} else {
+			require.Equal(t, test.inputSource, input)
+		}
+		require.Equal(t, test.expectedInputArgs, inputArgs)
+		release()
+	}
+}
@@ -0,0 +1,79 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaskBlur blurs masked region.
+	MaskBlur = "blur"
+	// MaskBlack fills masked region with black.
+	MaskBlack = "black"
+)
+
+// Mask describes single privacy region, coordinates are in source video pixels.
+// Polygon is masked by its bounding box, so masked region is never smaller than configured one.
+type Mask struct {
+	Type    string  `mapstructure:"type"`    // blur or black.
+	Rect    []int   `mapstructure:"rect"`    // x, y, width, height.
+	Polygon [][]int `mapstructure:"polygon"` // List of x, y points.
+}
+
+// Validate checks mask type and region.
+func (m *Mask) Validate() error {
+	if m.Type != MaskBlur && m.Type != MaskBlack {
+		return fmt.Errorf("unknown mask type %s", m.Type)
+	}
+	if (m.Rect == nil) == (m.Polygon == nil) {
+		return fmt.Errorf("mask requires either rect or polygon")
+	}
+	if m.Rect != nil && (len(m.Rect) != 4 || m.Rect[0] < 0 || m.Rect[1] < 0 || m.Rect[2] <= 0 || m.Rect[3] <= 0) {
+		return fmt.Errorf("invalid mask rect %v", m.Rect)
+	}
+	if m.Polygon != nil {
+		if len(m.Polygon) < 3 {
+			return fmt.Errorf("invalid mask polygon %v", m.Polygon)
+		}
+		for _, point := range m.Polygon {
+			if len(point) != 2 || point[0] < 0 || point[1] < 0 {
+				return fmt.Errorf("invalid mask polygon %v", m.Polygon)
+			}
+		}
+	}
+	return nil
+}
+
+// bounds returns masked rectangle as x, y, width, height.
+func (m *Mask) bounds() (int, int, int, int) {
+	if m.Rect != nil {
+		return m.Rect[0], m.Rect[1], m.Rect[2], m.Rect[3]
+	}
+	minX, minY := m.Polygon[0][0], m.Polygon[0][1]
+	maxX, maxY := minX, minY
+	for _, point := range m.Polygon[1:] {
+		minX, maxX = min(minX, point[0]), max(maxX, point[0])
+		minY, maxY = min(minY, point[1]), max(maxY, point[1])
+	}
+	return minX, minY, max(maxX-minX, 1), max(maxY-minY, 1)
+}
+
+// maskFilter returns video filter which hides all masks.
+// Filter has single input and output, so it can be chained with other filters.
+// Masks are in source pixels, so filter has to run before any scaling or user filters.
+func maskFilter(masks []Mask) string {
+	var filters []string
+	for i, mask := range masks {
+		x, y, w, h := mask.bounds()
+		switch mask.Type {
+		case MaskBlack:
+			filters = append(filters, fmt.Sprintf("drawbox=x=%d:y=%d:w=%d:h=%d:color=black:t=fill", x, y, w, h))
+		case MaskBlur:
+			// Blurred copy of region is put over original frame.
+			filters = append(filters, fmt.Sprintf(
+				"split[mask%[1]d][region%[1]d];[region%[1]d]crop=%[4]d:%[5]d:%[2]d:%[3]d,boxblur=luma_radius=min(w\\,h)/4:luma_power=3[blurred%[1]d];[mask%[1]d][blurred%[1]d]overlay=%[2]d:%[3]d",
+				i, x, y, w, h))
+		}
+	}
+	return strings.Join(filters, ",")
+}
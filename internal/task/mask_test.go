@@ -0,0 +1,87 @@
+package task
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskValidate(t *testing.T) {
+	tests := []struct {
+		inputMask   *Mask
+		expectedErr error
+	}{
+		{
+			inputMask: &Mask{Type: MaskBlur, Rect: []int{0, 0, 100, 50}},
+		},
+		{
+			inputMask: &Mask{Type: MaskBlack, Polygon: [][]int{{0, 0}, {100, 0}, {50, 50}}},
+		},
+		{
+			inputMask:   &Mask{Type: "pixelate", Rect: []int{0, 0, 100, 50}},
+			expectedErr: errors.New("unknown mask type pixelate"),
+		},
+		{
+			inputMask:   &Mask{Type: MaskBlur},
+			expectedErr: errors.New("mask requires either rect or polygon"),
+		},
+		{
+			inputMask:   &Mask{Type: MaskBlur, Rect: []int{0, 0, 100, 50}, Polygon: [][]int{{0, 0}, {100, 0}, {50, 50}}},
+			expectedErr: errors.New("mask requires either rect or polygon"),
+		},
+		{
+			inputMask:   &Mask{Type: MaskBlur, Rect: []int{0, 0, 100}},
+			expectedErr: errors.New("invalid mask rect [0 0 100]"),
+		},
+		{
+			inputMask:   &Mask{Type: MaskBlur, Rect: []int{0, 0, 0, 50}},
+			expectedErr: errors.New("invalid mask rect [0 0 0 50]"),
+		},
+		{
+			inputMask:   &Mask{Type: MaskBlack, Polygon: [][]int{{0, 0}, {100, 0}}},
+			expectedErr: errors.New("invalid mask polygon [[0 0] [100 0]]"),
+		},
+		{
+			inputMask:   &Mask{Type: MaskBlack, Polygon: [][]int{{0, 0}, {100, 0}, {50}}},
+			expectedErr: errors.New("invalid mask polygon [[0 0] [100 0] [50]]"),
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedErr, test.inputMask.Validate())
+	}
+}
+
+func TestMaskFilter(t *testing.T) {
+	tests := []struct {
+		inputMasks     []Mask
+		expectedFilter string
+	}{
+		{
+			expectedFilter: "",
+		},
+		{
+			inputMasks:     []Mask{{Type: MaskBlack, Rect: []int{10, 20, 100, 50}}},
+			expectedFilter: "drawbox=x=10:y=20:w=100:h=50:color=black:t=fill",
+		},
+		{
+			inputMasks:     []Mask{{Type: MaskBlack, Polygon: [][]int{{50, 60}, {150, 20}, {90, 120}}}},
+			expectedFilter: "drawbox=x=50:y=20:w=100:h=100:color=black:t=fill",
+		},
+		{
+			inputMasks: []Mask{
+				{Type: MaskBlur, Rect: []int{10, 20, 100, 50}},
+				{Type: MaskBlack, Rect: []int{0, 0, 10, 10}},
+				{Type: MaskBlur, Rect: []int{200, 100, 40, 40}},
+			},
+			expectedFilter: "split[mask0][region0];[region0]crop=100:50:10:20,boxblur=luma_radius=min(w\\,h)/4:luma_power=3[blurred0];[mask0][blurred0]overlay=10:20," +
+				"drawbox=x=0:y=0:w=10:h=10:color=black:t=fill," +
+				"split[mask2][region2];[region2]crop=40:40:200:100,boxblur=luma_radius=min(w\\,h)/4:luma_power=3[blurred2];[mask2][blurred2]overlay=200:100",
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedFilter, maskFilter(test.inputMasks))
+	}
+}
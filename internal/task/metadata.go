@@ -0,0 +1,80 @@
+package task
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	recorderHost, _ = os.Hostname()
+	recorderVersion = buildVersion()
+)
+
+// buildVersion returns vcs revision stamped by go build, "dev" when it's not available.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return "dev"
+}
+
+// recordingMetadata returns container metadata describing recording.
+// Request tags can't override tags set by recorder.
+func recordingMetadata(camName, prefix string, start time.Time, tags map[string]string) map[string]string {
+	metadata := maps.Clone(tags)
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["camera"] = camName
+	metadata["prefix"] = prefix
+	metadata["creation_time"] = start.UTC().Format("2006-01-02T15:04:05.000000Z")
+	metadata["recorder_host"] = recorderHost
+	metadata["recorder_version"] = recorderVersion
+	return metadata
+}
+
+// addMetadata adds -metadata arguments to ffmpeg output arguments.
+// mp4/mov muxer drops custom tags unless use_metadata_tags flag is set.
+func addMetadata(outputKwArgs ffmpeg.KwArgs, outputFile string, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	var args []string
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		args = append(args, fmt.Sprintf("%s=%s", key, metadata[key]))
+	}
+	outputKwArgs["metadata"] = args
+
+	switch strings.ToLower(filepath.Ext(outputFile)) {
+	case ".mp4", ".mov", ".m4v":
+		if movflags, ok := outputKwArgs["movflags"].(string); ok && movflags != "" {
+			outputKwArgs["movflags"] = movflags + "+use_metadata_tags"
+		} else {
+			outputKwArgs["movflags"] = "use_metadata_tags"
+		}
+	}
+}
+
+// ReadMetadata returns container metadata of recording.
+func ReadMetadata(filePath string) (map[string]string, error) {
+	probeResult, err := probe(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return probeResult.Format.Tags, nil
+}
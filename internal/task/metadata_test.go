@@ -0,0 +1,99 @@
+package task
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestRecordingMetadata(t *testing.T) {
+	start := time.Date(2023, 1, 28, 23, 40, 27, 876000000, time.FixedZone("CET", 3600))
+
+	require.Equal(t, map[string]string{
+		"camera":           "cam1",
+		"prefix":           "door",
+		"creation_time":    "2023-01-28T22:40:27.876000Z",
+		"recorder_host":    recorderHost,
+		"recorder_version": recorderVersion,
+	}, recordingMetadata("cam1", "door", start, nil))
+
+	tags := map[string]string{"event": "door-open", "camera": "fake"}
+	require.Equal(t, map[string]string{
+		"camera":           "cam1",
+		"prefix":           "door",
+		"event":            "door-open",
+		"creation_time":    "2023-01-28T22:40:27.876000Z",
+		"recorder_host":    recorderHost,
+		"recorder_version": recorderVersion,
+	}, recordingMetadata("cam1", "door", start, tags))
+	require.Equal(t, map[string]string{"event": "door-open", "camera": "fake"}, tags)
+}
+
+func TestAddMetadata(t *testing.T) {
+	tests := []struct {
+		inputKwArgs     ffmpeg.KwArgs
+		inputOutputFile string
+		inputMetadata   map[string]string
+		expectedKwArgs  ffmpeg.KwArgs
+	}{
+		{
+			inputKwArgs:     ffmpeg.KwArgs{"c:v": "copy"},
+			inputOutputFile: "a.mp4",
+			expectedKwArgs:  ffmpeg.KwArgs{"c:v": "copy"},
+		},
+		{
+			inputKwArgs:     ffmpeg.KwArgs{"c:v": "copy"},
+			inputOutputFile: "a.mp4",
+			inputMetadata:   map[string]string{"prefix": "door", "camera": "cam1"},
+			expectedKwArgs: ffmpeg.KwArgs{
+				"c:v":      "copy",
+				"metadata": []string{"camera=cam1", "prefix=door"},
+				"movflags": "use_metadata_tags",
+			},
+		},
+		{
+			inputKwArgs:     ffmpeg.KwArgs{"movflags": "+faststart"},
+			inputOutputFile: "a.MOV",
+			inputMetadata:   map[string]string{"camera": "cam1"},
+			expectedKwArgs: ffmpeg.KwArgs{
+				"metadata": []string{"camera=cam1"},
+				"movflags": "+faststart+use_metadata_tags",
+			},
+		},
+		{
+			inputKwArgs:     ffmpeg.KwArgs{},
+			inputOutputFile: "a.mkv",
+			inputMetadata:   map[string]string{"camera": "cam1"},
+			expectedKwArgs: ffmpeg.KwArgs{
+				"metadata": []string{"camera=cam1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		addMetadata(test.inputKwArgs, test.inputOutputFile, test.inputMetadata)
+		require.Equal(t, test.expectedKwArgs, test.inputKwArgs)
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	ffmpegProbe = func(string, ...ffmpeg.KwArgs) (string, error) {
+		return `{"format": {"duration": "5.0", "tags": {"camera": "cam1", "prefix": "door"}}}`, nil
+	}
+	defer func() {
+		ffmpegProbe = ffmpeg.Probe
+	}()
+
+	metadata, err := ReadMetadata("a.mp4")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"camera": "cam1", "prefix": "door"}, metadata)
+
+	ffmpegProbe = func(string, ...ffmpeg.KwArgs) (string, error) {
+		return "", fmt.Errorf("mock error")
+	}
+	_, err = ReadMetadata("a.mp4")
+	require.Equal(t, fmt.Errorf("mock error"), err)
+}
@@ -0,0 +1,154 @@
+package task
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Monitor periodically probes every configured camera.
+// Camera is up when any of its streams can be probed, Notify is called when camera goes up or down.
+type Monitor struct {
+	Probe     *ProbeConfig
+	Interval  int            // Seconds between probes of all cameras.
+	Readiness bool           // Camera which is down makes recorder not ready.
+	Notify    func(*Webhook) // Delivers camera_up and camera_down events, can be nil.
+
+	mu     sync.Mutex
+	health map[string]*CameraHealth
+}
+
+// CameraHealth describes result of last camera probe.
+type CameraHealth struct {
+	Up          bool      `json:"up"`
+	Latency     int64     `json:"latency_ms"` // Latency of fastest stream which was probed.
+	LastCheck   time.Time `json:"last_check"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	ErrorClass  string    `json:"error_class,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Run probes cameras every Interval seconds, until ctx is canceled.
+func (m *Monitor) Run(ctx context.Context) {
+	log.Printf("starting camera monitor")
+	for {
+		m.check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(m.Interval) * time.Second):
+		}
+	}
+}
+
+// Health returns health of every camera probed at least once.
+func (m *Monitor) Health() map[string]CameraHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := make(map[string]CameraHealth)
+	for camName, h := range m.health {
+		health[camName] = *h
+	}
+	return health
+}
+
+// Ready reports whether every probed camera is up, it is always true when cameras are excluded from readiness.
+func (m *Monitor) Ready() bool {
+	if !m.Readiness {
+		return true
+	}
+	for _, h := range m.Health() {
+		if !h.Up {
+			return false
+		}
+	}
+	return true
+}
+
+// check probes all cameras in parallel.
+func (m *Monitor) check() {
+	var wg sync.WaitGroup
+	for _, camName := range m.Probe.Cameras() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := m.Probe.Probe("", camName)
+			if err != nil {
+				log.Printf("unable to probe %s: %v", camName, err)
+				return
+			}
+			m.update(camName, results)
+		}()
+	}
+	wg.Wait()
+}
+
+// update stores health of camera from its probe results.
+// First failed probe is reported too, first successful one isn't.
+func (m *Monitor) update(camName string, results []*StreamProbe) {
+	now := timeNow()
+	health := &CameraHealth{LastCheck: now}
+	for _, result := range results {
+		if result.OK && (!health.Up || result.Latency < health.Latency) {
+			health.Up = true
+			health.Latency = result.Latency
+		}
+	}
+	if !health.Up {
+		health.ErrorClass = results[0].ErrorClass
+		health.Error = results[0].Error
+	}
+
+	m.mu.Lock()
+	if m.health == nil {
+		m.health = make(map[string]*CameraHealth)
+	}
+	previous, known := m.health[camName]
+	if health.Up {
+		health.LastSuccess = now
+	} else if known {
+		health.LastSuccess = previous.LastSuccess
+	}
+	m.health[camName] = health
+	m.mu.Unlock()
+
+	changed := known && previous.Up != health.Up
+	if !changed && (known || health.Up) {
+		return
+	}
+	event := "camera_up"
+	if !health.Up {
+		event = "camera_down"
+		log.Printf("camera %s is down: %s", camName, health.Error)
+	} else {
+		log.Printf("camera %s is up", camName)
+	}
+	if m.Notify != nil {
+		m.Notify(&Webhook{
+			Event: event,
+			Time:  now,
+			Data: map[string]any{
+				"cam_name":    camName,
+				"latency_ms":  health.Latency,
+				"error_class": health.ErrorClass,
+				"error":       health.Error,
+			},
+		})
+	}
+}
+
+// Cameras returns names of cameras with configured streams.
+func (c *ProbeConfig) Cameras() []string {
+	cameras := slices.Collect(maps.Keys(c.Streams))
+	for camName := range c.NamedStreams {
+		if !slices.Contains(cameras, camName) {
+			cameras = append(cameras, camName)
+		}
+	}
+	slices.Sort(cameras)
+	return cameras
+}
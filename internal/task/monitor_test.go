@@ -0,0 +1,116 @@
+package task
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestMonitorCheck(t *testing.T) {
+	now := time.Date(2023, time.January, 20, 1, 2, 3, 0, time.UTC)
+	defer func() {
+		timeNow = time.Now
+		ffmpegProbeTimeout = ffmpeg.ProbeWithTimeout
+	}()
+
+	down := map[string]bool{}
+	ffmpegProbeTimeout = func(source string, _ time.Duration, _ ffmpeg.KwArgs) (string, error) {
+		if down[source] {
+			return "", errors.New("[Connection refused] exit status 1")
+		}
+		return `{"streams": [{"codec_type": "video", "codec_name": "h264"}]}`, nil
+	}
+
+	var mu sync.Mutex
+	var events []*Webhook
+	monitor := &Monitor{
+		Probe: &ProbeConfig{
+			Streams:      map[string][]string{"cam1": {"rtsp://cam1/main", "rtsp://cam1/sub"}},
+			NamedStreams: map[string]map[string]string{"cam2": {"wide": "rtsp://cam2/wide"}},
+		},
+		Readiness: true,
+		Notify: func(w *Webhook) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, w)
+		},
+	}
+	require.Equal(t, []string{"cam1", "cam2"}, monitor.Probe.Cameras())
+
+	tests := []struct {
+		inputDown      map[string]bool
+		inputTime      time.Time
+		expectedHealth map[string]CameraHealth
+		expectedEvents []string
+		expectedReady  bool
+	}{
+		{
+			inputDown: map[string]bool{"rtsp://cam2/wide": true},
+			inputTime: now,
+			expectedHealth: map[string]CameraHealth{
+				"cam1": {Up: true, LastCheck: now, LastSuccess: now},
+				"cam2": {LastCheck: now, ErrorClass: ErrorClassConnection, Error: "[Connection refused] exit status 1"},
+			},
+			expectedEvents: []string{"camera_down:cam2"},
+		},
+		{
+			// Camera with working stream is up.
+			inputDown: map[string]bool{"rtsp://cam1/main": true, "rtsp://cam2/wide": true},
+			inputTime: now.Add(time.Minute),
+			expectedHealth: map[string]CameraHealth{
+				"cam1": {Up: true, LastCheck: now.Add(time.Minute), LastSuccess: now.Add(time.Minute)},
+				"cam2": {LastCheck: now.Add(time.Minute), ErrorClass: ErrorClassConnection, Error: "[Connection refused] exit status 1"},
+			},
+		},
+		{
+			inputDown: map[string]bool{"rtsp://cam1/main": true, "rtsp://cam1/sub": true},
+			inputTime: now.Add(2 * time.Minute),
+			expectedHealth: map[string]CameraHealth{
+				"cam1": {LastCheck: now.Add(2 * time.Minute), LastSuccess: now.Add(time.Minute), ErrorClass: ErrorClassConnection, Error: "[Connection refused] exit status 1"},
+				"cam2": {Up: true, LastCheck: now.Add(2 * time.Minute), LastSuccess: now.Add(2 * time.Minute)},
+			},
+			expectedEvents: []string{"camera_down:cam1", "camera_up:cam2"},
+		},
+		{
+			inputTime: now.Add(3 * time.Minute),
+			expectedHealth: map[string]CameraHealth{
+				"cam1": {Up: true, LastCheck: now.Add(3 * time.Minute), LastSuccess: now.Add(3 * time.Minute)},
+				"cam2": {Up: true, LastCheck: now.Add(3 * time.Minute), LastSuccess: now.Add(3 * time.Minute)},
+			},
+			expectedEvents: []string{"camera_up:cam1"},
+			expectedReady:  true,
+		},
+	}
+
+	for _, test := range tests {
+		down = test.inputDown
+		inputTime := test.inputTime
+		timeNow = func() time.Time { return inputTime }
+		events = nil
+
+		monitor.check()
+
+		health := monitor.Health()
+		for camName, h := range health {
+			h.Latency = 0
+			health[camName] = h
+		}
+		require.Equal(t, test.expectedHealth, health)
+		var eventNames []string
+		for _, event := range events {
+			require.Equal(t, test.inputTime, event.Time)
+			eventNames = append(eventNames, event.Event+":"+event.Data.(map[string]any)["cam_name"].(string))
+		}
+		require.ElementsMatch(t, test.expectedEvents, eventNames)
+		require.Equal(t, test.expectedReady, monitor.Ready())
+	}
+
+	monitor.Readiness = false
+	down = map[string]bool{"rtsp://cam2/wide": true}
+	monitor.check()
+	require.True(t, monitor.Ready())
+}
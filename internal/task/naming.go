@@ -0,0 +1,111 @@
+package task
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// placeholderRegexp matches template placeholders, e.g. {prefix}.
+	placeholderRegexp = regexp.MustCompile(`\{([a-z_]+)\}`)
+)
+
+// Default naming templates, they keep layout used before templates were configurable.
+const (
+	DefaultRecordTemplate   = "{prefix}/{date}/{time}-{cam}-{burst}-{bursts}.{ext}"
+	DefaultConvertTemplate  = "{prefix}/{date}/{time}-{cam}-{suffix}.{ext}"
+	DefaultRemoteTemplate   = "{prefix}/{date}/{file}"
+	DefaultSnapshotTemplate = "{prefix}/{date}/{time}-{cam}.{ext}"
+)
+
+// Naming builds file paths from templates.
+// Templates use placeholders, e.g. {prefix}/{yyyy}/{mm}/{dd}/{time}-{cam}-{burst}.{ext}.
+type Naming struct {
+	Record   string         // Recorded burst, relative to record dir.
+	Convert  string         // Converted recording, relative to convert dir.
+	Remote   string         // Uploaded file, relative to remote root.
+	Snapshot string         // Saved snapshot, relative to record dir.
+	Location *time.Location // Timezone of date and time placeholders.
+}
+
+// NameVars contains values of template placeholders.
+type NameVars struct {
+	Prefix  string
+	CamName string
+	Start   time.Time
+	Burst   int64
+	Bursts  int64
+	Suffix  string
+	Ext     string
+	File    string
+	Stream  string
+	Event   string
+}
+
+// placeholders returns value of every placeholder.
+// Local time is used when loc is nil.
+func (v *NameVars) placeholders(loc *time.Location) map[string]string {
+	if loc == nil {
+		loc = time.Local
+	}
+	start := v.Start.In(loc)
+	return map[string]string{
+		"prefix": v.Prefix,
+		"cam":    v.CamName,
+		"date":   start.Format(dateLayout),
+		"time":   start.Format(timeLayout),
+		"yyyy":   start.Format("2006"),
+		"mm":     start.Format("01"),
+		"dd":     start.Format("02"),
+		"hh":     start.Format("15"),
+		"min":    start.Format("04"),
+		"ss":     start.Format("05"),
+		"ms":     start.Format(".000")[1:],
+		"burst":  fmt.Sprintf("%03d", v.Burst),
+		"bursts": fmt.Sprintf("%03d", v.Bursts),
+		"suffix": v.Suffix,
+		"ext":    v.Ext,
+		"file":   v.File,
+		"stream": v.Stream,
+		"event":  v.Event,
+	}
+}
+
+// ValidateTemplate checks that template uses only known placeholders and required ones.
+func ValidateTemplate(template string, required ...string) error {
+	if template == "" || filepath.IsAbs(template) {
+		return fmt.Errorf("template %q has to be relative path", template)
+	}
+	known := (&NameVars{}).placeholders(time.UTC)
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(template, -1) {
+		if _, ok := known[match[1]]; !ok {
+			return fmt.Errorf("unknown placeholder {%s} in template %q", match[1], template)
+		}
+	}
+	for _, placeholder := range required {
+		if !strings.Contains(template, "{"+placeholder+"}") {
+			return fmt.Errorf("template %q requires {%s} placeholder", template, placeholder)
+		}
+	}
+	return nil
+}
+
+// Date returns date of recording started at start, as {date} placeholder of paths.
+func (n *Naming) Date(start time.Time) string {
+	return (&NameVars{Start: start}).placeholders(n.Location)["date"]
+}
+
+// Path returns path built from template.
+// Stream name is appended to {cam} when template doesn't use {stream}, so files of named streams don't collide.
+func (n *Naming) Path(template string, vars *NameVars) string {
+	placeholders := vars.placeholders(n.Location)
+	if vars.Stream != "" && !strings.Contains(template, "{stream}") {
+		placeholders["cam"] += "-" + vars.Stream
+	}
+	return filepath.Clean(placeholderRegexp.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return placeholders[strings.Trim(placeholder, "{}")]
+	}))
+}
@@ -0,0 +1,142 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamingPath(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	require.Nil(t, err)
+
+	vars := &NameVars{
+		Prefix:  "door",
+		CamName: "cam1",
+		Start:   time.Date(2023, 1, 28, 23, 40, 27, 876000000, time.UTC),
+		Burst:   1,
+		Bursts:  3,
+		Suffix:  "480p",
+		Ext:     "mp4",
+		File:    "a.mp4",
+	}
+
+	tests := []struct {
+		inputTemplate string
+		inputLocation *time.Location
+		expectedPath  string
+	}{
+		{
+			inputTemplate: DefaultRecordTemplate,
+			inputLocation: time.UTC,
+			expectedPath:  "door/28-01-2023/23:40:27.876-cam1-001-003.mp4",
+		},
+		{
+			inputTemplate: DefaultConvertTemplate,
+			inputLocation: time.UTC,
+			expectedPath:  "door/28-01-2023/23:40:27.876-cam1-480p.mp4",
+		},
+		{
+			inputTemplate: DefaultRemoteTemplate,
+			inputLocation: time.UTC,
+			expectedPath:  "door/28-01-2023/a.mp4",
+		},
+		{
+			inputTemplate: "{prefix}/{yyyy}/{mm}/{dd}/{hh}{min}{ss}.{ms}-{cam}-{burst}.{ext}",
+			inputLocation: time.UTC,
+			expectedPath:  "door/2023/01/28/234027.876-cam1-001.mp4",
+		},
+		{
+			inputTemplate: "{prefix}/{yyyy}/{mm}/{dd}/{hh}{min}{ss}-{cam}-{burst}.{ext}",
+			inputLocation: warsaw,
+			expectedPath:  "door/2023/01/29/004027-cam1-001.mp4",
+		},
+		{
+			inputTemplate: "{cam}/../{prefix}//{file}",
+			inputLocation: time.UTC,
+			expectedPath:  "door/a.mp4",
+		},
+	}
+
+	for _, test := range tests {
+		naming := &Naming{Location: test.inputLocation}
+		require.Equal(t, test.expectedPath, naming.Path(test.inputTemplate, vars))
+	}
+}
+
+func TestNamingPathStream(t *testing.T) {
+	vars := &NameVars{
+		Prefix:  "door",
+		CamName: "cam1",
+		Start:   time.Date(2023, 1, 28, 23, 40, 27, 876000000, time.UTC),
+		Burst:   1,
+		Bursts:  3,
+		Ext:     "mp4",
+		Stream:  "sub",
+		Event:   "event1",
+	}
+
+	tests := []struct {
+		inputTemplate string
+		expectedPath  string
+	}{
+		{
+			inputTemplate: DefaultRecordTemplate,
+			expectedPath:  "door/28-01-2023/23:40:27.876-cam1-sub-001-003.mp4",
+		},
+		{
+			inputTemplate: "{prefix}/{event}/{stream}/{cam}-{burst}.{ext}",
+			expectedPath:  "door/event1/sub/cam1-001.mp4",
+		},
+	}
+
+	for _, test := range tests {
+		naming := &Naming{Location: time.UTC}
+		require.Equal(t, test.expectedPath, naming.Path(test.inputTemplate, vars))
+	}
+}
+
+func TestNamingDate(t *testing.T) {
+	start := time.Date(2023, time.February, 20, 23, 30, 0, 0, time.UTC)
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	require.Nil(t, err)
+
+	require.Equal(t, "20-02-2023", (&Naming{Location: time.UTC}).Date(start))
+	require.Equal(t, "21-02-2023", (&Naming{Location: warsaw}).Date(start))
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		inputTemplate string
+		inputRequired []string
+		expectedErr   error
+	}{
+		{
+			inputTemplate: DefaultRecordTemplate,
+			inputRequired: []string{"burst"},
+		},
+		{
+			inputTemplate: "",
+			expectedErr:   errors.New(`template "" has to be relative path`),
+		},
+		{
+			inputTemplate: "/data/{file}",
+			expectedErr:   errors.New(`template "/data/{file}" has to be relative path`),
+		},
+		{
+			inputTemplate: "{prefix}/{year}/{file}",
+			expectedErr:   errors.New(`unknown placeholder {year} in template "{prefix}/{year}/{file}"`),
+		},
+		{
+			inputTemplate: "{prefix}/{time}-{cam}.{ext}",
+			inputRequired: []string{"burst"},
+			expectedErr:   errors.New(`template "{prefix}/{time}-{cam}.{ext}" requires {burst} placeholder`),
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedErr, ValidateTemplate(test.inputTemplate, test.inputRequired...))
+	}
+}
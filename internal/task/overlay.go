@@ -0,0 +1,90 @@
+package task
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Overlay positions supported by ConvertOverlay.
+var overlayPositions = map[string][2]string{
+	"top-left":     {"10", "10"},
+	"top-right":    {"w-tw-10", "10"},
+	"bottom-left":  {"10", "h-th-10"},
+	"bottom-right": {"w-tw-10", "h-th-10"},
+}
+
+// ConvertOverlay describes camera name and wall-clock time burned into converted video.
+type ConvertOverlay struct {
+	FontFile string `mapstructure:"font_file"` // Font used by drawtext, fontconfig default when empty.
+	FontSize int    `mapstructure:"font_size"`
+	Position string `mapstructure:"position"` // top-left, top-right, bottom-left or bottom-right.
+	Timezone string `mapstructure:"timezone"` // IANA timezone of displayed clock, e.g. Europe/Warsaw.
+}
+
+// Validate checks overlay position and timezone.
+func (o *ConvertOverlay) Validate() error {
+	if _, ok := overlayPositions[o.Position]; !ok {
+		return fmt.Errorf("unknown overlay position %s", o.Position)
+	}
+	if _, err := time.LoadLocation(o.Timezone); err != nil {
+		return fmt.Errorf("unknown overlay timezone %s", o.Timezone)
+	}
+	return nil
+}
+
+// overlayText returns drawtext text, clock starts at start and is displayed in loc.
+// drawtext can only show time in UTC or process timezone, so start is shifted by loc offset and displayed as UTC.
+func overlayText(camName string, start time.Time, loc *time.Location) string {
+	_, offset := start.In(loc).Zone()
+	epoch := float64(start.UnixMilli())/1000 + float64(offset)
+
+	// Backslash escapes any character in drawtext text, % starts expansion.
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`)
+	return fmt.Sprintf(`%s %%{pts:gmtime:%.3f:%%Y-%%m-%%d %%H\:%%M\:%%S}`, escaper.Replace(camName), epoch)
+}
+
+// overlayFilter returns drawtext filter which reads text from textFile.
+// Text is passed in file, so it doesn't need filtergraph escaping.
+func overlayFilter(overlay *ConvertOverlay, textFile string) string {
+	position := overlayPositions[overlay.Position]
+	options := []string{
+		"textfile=" + textFile,
+		fmt.Sprintf("fontsize=%d", overlay.FontSize),
+		"fontcolor=white",
+		"box=1",
+		"boxcolor=black@0.5",
+		"boxborderw=4",
+		"x=" + position[0],
+		"y=" + position[1],
+	}
+	if overlay.FontFile != "" {
+		options = append(options, "fontfile="+overlay.FontFile)
+	}
+	return "drawtext=" + strings.Join(options, ":")
+}
+
+// withVideoFilter returns copy of outputArgs with filters put before and after user video filters.
+// Empty filters are skipped.
+func withVideoFilter(outputArgs map[string]string, before, after string) map[string]string {
+	args := maps.Clone(outputArgs)
+	if args == nil {
+		args = make(map[string]string)
+	}
+	key := "vf"
+	if _, ok := args["filter:v"]; ok {
+		key = "filter:v"
+	}
+
+	var filters []string
+	for _, filter := range []string{before, args[key], after} {
+		if filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+	if len(filters) > 0 {
+		args[key] = strings.Join(filters, ",")
+	}
+	return args
+}
@@ -0,0 +1,80 @@
+package task
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertOverlayValidate(t *testing.T) {
+	require.Nil(t, (&ConvertOverlay{Position: "top-left", Timezone: "Europe/Warsaw"}).Validate())
+	require.Equal(t, errors.New("unknown overlay position center"), (&ConvertOverlay{Position: "center", Timezone: "UTC"}).Validate())
+	require.Equal(t, errors.New("unknown overlay timezone Mars/Olympus"), (&ConvertOverlay{Position: "top-left", Timezone: "Mars/Olympus"}).Validate())
+}
+
+func TestOverlayText(t *testing.T) {
+	start := time.Date(2023, 1, 28, 23, 40, 27, 876000000, time.UTC)
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	require.Nil(t, err)
+
+	require.Equal(t, `cam1 %{pts:gmtime:1674949227.876:%Y-%m-%d %H\:%M\:%S}`, overlayText("cam1", start, time.UTC))
+	require.Equal(t, `cam1 %{pts:gmtime:1674952827.876:%Y-%m-%d %H\:%M\:%S}`, overlayText("cam1", start, warsaw))
+	require.Equal(t, `100\% \\cam %{pts:gmtime:1674949227.876:%Y-%m-%d %H\:%M\:%S}`, overlayText(`100% \cam`, start, time.UTC))
+}
+
+func TestOverlayFilter(t *testing.T) {
+	require.Equal(t,
+		"drawtext=textfile=/tmp/text:fontsize=24:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=4:x=10:y=h-th-10",
+		overlayFilter(&ConvertOverlay{FontSize: 24, Position: "bottom-left"}, "/tmp/text"))
+	require.Equal(t,
+		"drawtext=textfile=/tmp/text:fontsize=32:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=4:x=w-tw-10:y=10:fontfile=/fonts/a.ttf",
+		overlayFilter(&ConvertOverlay{FontFile: "/fonts/a.ttf", FontSize: 32, Position: "top-right"}, "/tmp/text"))
+}
+
+func TestWithVideoFilter(t *testing.T) {
+	tests := []struct {
+		inputOutputArgs    map[string]string
+		inputBefore        string
+		inputAfter         string
+		expectedOutputArgs map[string]string
+	}{
+		{
+			expectedOutputArgs: map[string]string{},
+		},
+		{
+			inputAfter:         "drawtext",
+			expectedOutputArgs: map[string]string{"vf": "drawtext"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"c:v": "h264"},
+			inputAfter:         "drawtext",
+			expectedOutputArgs: map[string]string{"c:v": "h264", "vf": "drawtext"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"vf": "scale=-2:480"},
+			inputAfter:         "drawtext",
+			expectedOutputArgs: map[string]string{"vf": "scale=-2:480,drawtext"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"filter:v": "scale=-2:480"},
+			inputBefore:        "drawbox",
+			inputAfter:         "drawtext",
+			expectedOutputArgs: map[string]string{"filter:v": "drawbox,scale=-2:480,drawtext"},
+		},
+		{
+			inputOutputArgs:    map[string]string{"c:v": "h264"},
+			inputBefore:        "drawbox",
+			expectedOutputArgs: map[string]string{"c:v": "h264", "vf": "drawbox"},
+		},
+	}
+
+	for _, test := range tests {
+		outputArgs := withVideoFilter(test.inputOutputArgs, test.inputBefore, test.inputAfter)
+		require.Equal(t, test.expectedOutputArgs, outputArgs)
+		if test.inputOutputArgs != nil && (test.inputBefore != "" || test.inputAfter != "") {
+			require.NotEqual(t, test.inputOutputArgs, outputArgs)
+		}
+	}
+}
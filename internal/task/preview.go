@@ -0,0 +1,275 @@
+package task
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"recorder/internal/job"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	PreviewFormatGIF  = "gif"
+	PreviewFormatWebP = "webp"
+
+	PreviewModeFirst   = "first"
+	PreviewModeSpeedup = "speedup"
+)
+
+var (
+	ffmpegPreviewTimeout = 60 * time.Second
+	previewAttempts      = 3
+
+	// mocks for tests.
+	osStat     = os.Stat
+	osReadFile = os.ReadFile
+)
+
+// Previewable is implemented by results with video which should get animated preview.
+type Previewable interface {
+	PreviewTask() *Preview
+}
+
+// Preview creates short animated GIF/WebP clip of video, suitable for notifications.
+// Preview is stored next to the video.
+type Preview struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	Artifact      string
+	SkipUpload    bool
+	Unmasked      bool
+	EventID       string
+	StreamName    string
+}
+
+// PreviewResult is published when preview is created.
+type PreviewResult struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	ContentType   string
+	Artifact      string
+	SkipUpload    bool
+	Unmasked      bool
+	EventID       string
+	StreamName    string
+}
+
+// UploadTask returns task which uploads preview, with the same policy as video.
+func (r *PreviewResult) UploadTask() *Upload {
+	if r.SkipUpload {
+		return nil
+	}
+	return &Upload{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      r.Artifact,
+		Unmasked:      r.Unmasked,
+	}
+}
+
+// WebhookTask returns preview event, image is embedded as base64.
+// nil is returned when preview can't be read.
+func (r *PreviewResult) WebhookTask() *Webhook {
+	image, err := osReadFile(r.FilePath)
+	if err != nil {
+		log.Printf("unable to read preview %s: %v", r.FilePath, err)
+		return nil
+	}
+	return &Webhook{
+		Event:   "preview",
+		JobID:   r.JobID,
+		EventID: r.EventID,
+		Stream:  r.StreamName,
+		Time:    timeNow(),
+		Data: map[string]string{
+			"prefix":         r.Prefix,
+			"recording_date": r.RecordingDate,
+			"file_name":      r.FileName,
+			"content_type":   r.ContentType,
+			"image":          base64.StdEncoding.EncodeToString(image),
+		},
+	}
+}
+
+// PreviewTask returns task which creates preview for recorded burst.
+func (r *SingleRecordResult) PreviewTask() *Preview {
+	return &Preview{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactBursts,
+		Unmasked:      r.Unmasked,
+	}
+}
+
+// PreviewTask returns task which creates preview for converted recording.
+func (r *ConvertResult) PreviewTask() *Preview {
+	return &Preview{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactConverted,
+		SkipUpload:    r.SkipUpload,
+	}
+}
+
+func (r *Preview) Do(ctx context.Context, chResult chan *PreviewResult) error {
+	config, err := ConfigFromContext[PreviewConfig](ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	probeResult, err := probe(r.FilePath)
+	if err != nil {
+		log.Printf("unable to probe %s: %v", r.FilePath, err)
+		return err
+	}
+
+	// /data/prefix/20-02-2023/07:36:36.178-cam1-001-003.gif
+	previewPath := strings.TrimSuffix(r.FilePath, filepath.Ext(r.FilePath)) + "." + config.Format
+
+	// Previews end up in notifications, so unmasked videos are masked here.
+	var masks string
+	if cameraMasks := config.Masks[r.CamName]; r.Unmasked && len(cameraMasks) > 0 {
+		masks = maskFilter(cameraMasks)
+	}
+
+	width, fps := config.Width, config.FPS
+	for attempt := 1; ; attempt++ {
+		if err := ffmpegPreview(r.FilePath, previewPath, config, masks, probeResult.Duration(), width, fps); err != nil {
+			log.Printf("unable to create preview %s: %v", previewPath, err)
+			return r.failed(ctx, previewPath, err)
+		}
+		fileInfo, err := osStat(previewPath)
+		if err != nil {
+			log.Printf("unable to stat preview %s: %v", previewPath, err)
+			return err
+		}
+		if config.MaxBytes <= 0 || fileInfo.Size() <= config.MaxBytes {
+			break
+		}
+		if attempt == previewAttempts {
+			os.Remove(previewPath)
+			return r.failed(ctx, previewPath, fmt.Errorf("preview %s exceeds %d bytes", previewPath, config.MaxBytes))
+		}
+		width, fps = shrinkPreview(width, fps, fileInfo.Size(), config.MaxBytes)
+	}
+	log.Printf("created preview %s (width:%d fps:%d took:%.2fs)", previewPath, width, fps, time.Since(now).Seconds())
+	job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{Type: "preview", FilePath: previewPath})
+
+	chResult <- &PreviewResult{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      filepath.Base(previewPath),
+		FilePath:      previewPath,
+		ContentType:   "image/" + config.Format,
+		Artifact:      r.Artifact,
+		SkipUpload:    r.SkipUpload,
+		Unmasked:      r.Unmasked && masks == "",
+	}
+	return nil
+}
+
+// failed reports preview which can't be created in job, err is returned.
+func (r *Preview) failed(ctx context.Context, previewPath string, err error) error {
+	countFFmpegError("preview", err)
+	job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{
+		Type:       "preview",
+		FilePath:   previewPath,
+		Status:     StatusFailed,
+		Error:      err.Error(),
+		ErrorClass: errorClass(err),
+		Stream:     r.StreamName,
+	})
+	return err
+}
+
+// shrinkPreview returns smaller width and frame rate, so preview of size bytes fits into maxBytes.
+// Size grows with square of width and with frame rate, both are shrunk by the same ratio, at least to 2/3.
+func shrinkPreview(width, fps int, size, maxBytes int64) (int, int) {
+	ratio := min(math.Cbrt(float64(maxBytes)/float64(size))*0.9, 2.0/3)
+	return max(int(float64(width)*ratio), 16), max(int(float64(fps)*ratio), 1)
+}
+
+// previewFilter returns video filter for preview.
+// In speedup mode whole video is squeezed into length seconds.
+func previewFilter(format, mode, masks string, length int, duration float64, width, fps int) string {
+	var filters []string
+	if masks != "" {
+		filters = append(filters, masks)
+	}
+	if mode == PreviewModeSpeedup && length > 0 && duration > float64(length) {
+		filters = append(filters, fmt.Sprintf("setpts=PTS/%.3f", duration/float64(length)))
+	}
+	filters = append(filters, fmt.Sprintf("fps=%d", fps), fmt.Sprintf("scale=%d:-2:flags=lanczos", width))
+
+	filter := strings.Join(filters, ",")
+	if format == PreviewFormatGIF {
+		// GIF gets its own palette, default one makes video look terrible.
+		filter += ",split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse"
+	}
+	return filter
+}
+
+func ffmpegPreview(inputFile, outputFile string, config *PreviewConfig, masks string, duration float64, width, fps int) error {
+	inputKwArgs := ffmpeg.KwArgs{}
+	if config.Mode != PreviewModeSpeedup {
+		inputKwArgs["t"] = config.Length
+	}
+
+	outputKwArgs := ffmpeg.KwArgs{
+		"vf":   previewFilter(config.Format, config.Mode, masks, config.Length, duration, width, fps),
+		"an":   "",
+		"loop": 0,
+	}
+	if config.Format == PreviewFormatWebP {
+		outputKwArgs["c:v"] = "libwebp"
+		outputKwArgs["q:v"] = 60
+	}
+
+	return runFFmpeg(ffmpeg.Input(inputFile, inputKwArgs).Output(outputFile, outputKwArgs).OverWriteOutput(),
+		ffmpegPreviewTimeout, 0, nil)
+}
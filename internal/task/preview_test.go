@@ -0,0 +1,226 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestPreviewDo(t *testing.T) {
+	tests := []struct {
+		inputConfig     *PreviewConfig
+		inputPreview    *Preview
+		mockFFMPEGProbe func(string, ...ffmpeg.KwArgs) (string, error)
+		expectedErr     error
+		expectedResult  *PreviewResult
+	}{
+		{
+			inputConfig: &PreviewConfig{Format: PreviewFormatGIF, Mode: PreviewModeFirst, Length: 2, Width: 160, FPS: 5},
+			inputPreview: &Preview{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactBursts,
+			},
+			mockFFMPEGProbe: func(string, ...ffmpeg.KwArgs) (string, error) {
+				return "", fmt.Errorf("mock error")
+			},
+			expectedErr: fmt.Errorf("mock error"),
+		},
+		{
+			inputConfig: &PreviewConfig{Format: PreviewFormatGIF, Mode: PreviewModeFirst, Length: 2, Width: 160, FPS: 5, MaxBytes: 1},
+			inputPreview: &Preview{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactBursts,
+			},
+			expectedErr: fmt.Errorf("preview %s exceeds 1 bytes", filepath.Join(outputPath, "test_recording.gif")),
+		},
+		{
+			inputConfig: &PreviewConfig{Format: PreviewFormatGIF, Mode: PreviewModeFirst, Length: 2, Width: 160, FPS: 5, MaxBytes: 1048576},
+			inputPreview: &Preview{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactBursts,
+			},
+			expectedResult: &PreviewResult{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.gif",
+				FilePath:      filepath.Join(outputPath, "test_recording.gif"),
+				ContentType:   "image/gif",
+				Artifact:      ArtifactBursts,
+			},
+		},
+		{
+			inputConfig: &PreviewConfig{Format: PreviewFormatWebP, Mode: PreviewModeSpeedup, Length: 2, Width: 160, FPS: 5},
+			inputPreview: &Preview{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactConverted,
+				SkipUpload:    true,
+			},
+			expectedResult: &PreviewResult{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.webp",
+				FilePath:      filepath.Join(outputPath, "test_recording.webp"),
+				ContentType:   "image/webp",
+				Artifact:      ArtifactConverted,
+				SkipUpload:    true,
+			},
+		},
+	}
+
+	os.RemoveAll(outputPath)
+	err := os.Mkdir(outputPath, os.ModePerm)
+	require.Nil(t, err)
+	defer os.RemoveAll(outputPath)
+
+	err = createTestVideo(filepath.Join(outputPath, "test_recording.mp4"))
+	require.Nil(t, err)
+
+	for _, test := range tests {
+		ffmpegProbe = ffmpeg.Probe
+		if test.mockFFMPEGProbe != nil {
+			ffmpegProbe = test.mockFFMPEGProbe
+			defer func() {
+				ffmpegProbe = ffmpeg.Probe
+			}()
+		}
+
+		chResult := make(chan *PreviewResult, 1)
+		ctx := WithConfig(context.Background(), test.inputConfig)
+
+		err := test.inputPreview.Do(ctx, chResult)
+		require.Equal(t, test.expectedErr, err)
+
+		if test.expectedResult == nil {
+			require.Equal(t, 0, len(chResult))
+			continue
+		}
+		result := <-chResult
+		require.Equal(t, test.expectedResult, result)
+		fileInfo, err := os.Stat(result.FilePath)
+		require.Nil(t, err)
+		if test.inputConfig.MaxBytes > 0 {
+			require.LessOrEqual(t, fileInfo.Size(), test.inputConfig.MaxBytes)
+		}
+	}
+}
+
+func TestPreviewFilter(t *testing.T) {
+	tests := []struct {
+		inputFormat    string
+		inputMode      string
+		inputMasks     string
+		inputLength    int
+		inputDuration  float64
+		expectedFilter string
+	}{
+		{
+			inputFormat:    PreviewFormatWebP,
+			inputMode:      PreviewModeFirst,
+			inputLength:    3,
+			inputDuration:  30,
+			expectedFilter: "fps=10,scale=320:-2:flags=lanczos",
+		},
+		{
+			inputFormat:    PreviewFormatWebP,
+			inputMode:      PreviewModeSpeedup,
+			inputLength:    3,
+			inputDuration:  30,
+			expectedFilter: "setpts=PTS/10.000,fps=10,scale=320:-2:flags=lanczos",
+		},
+		{
+			inputFormat:    PreviewFormatWebP,
+			inputMode:      PreviewModeSpeedup,
+			inputLength:    3,
+			inputDuration:  2,
+			expectedFilter: "fps=10,scale=320:-2:flags=lanczos",
+		},
+		{
+			inputFormat:    PreviewFormatGIF,
+			inputMode:      PreviewModeFirst,
+			inputLength:    3,
+			inputDuration:  30,
+			expectedFilter: "fps=10,scale=320:-2:flags=lanczos,split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse",
+		},
+		{
+			inputFormat:    PreviewFormatWebP,
+			inputMode:      PreviewModeSpeedup,
+			inputMasks:     "drawbox=x=0:y=0:w=10:h=10:color=black:t=fill",
+			inputLength:    3,
+			inputDuration:  30,
+			expectedFilter: "drawbox=x=0:y=0:w=10:h=10:color=black:t=fill,setpts=PTS/10.000,fps=10,scale=320:-2:flags=lanczos",
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedFilter, previewFilter(test.inputFormat, test.inputMode, test.inputMasks, test.inputLength, test.inputDuration, 320, 10))
+	}
+}
+
+func TestShrinkPreview(t *testing.T) {
+	tests := []struct {
+		inputSize     int64
+		expectedWidth int
+		expectedFPS   int
+	}{
+		{inputSize: 1100, expectedWidth: 213, expectedFPS: 6},
+		{inputSize: 8000, expectedWidth: 144, expectedFPS: 4},
+		{inputSize: 1000000, expectedWidth: 28, expectedFPS: 1},
+		{inputSize: 100000000, expectedWidth: 16, expectedFPS: 1},
+	}
+
+	for _, test := range tests {
+		width, fps := shrinkPreview(320, 10, test.inputSize, 1000)
+		require.Equal(t, test.expectedWidth, width)
+		require.Equal(t, test.expectedFPS, fps)
+	}
+}
+
+func TestPreviewResultWebhookTask(t *testing.T) {
+	osReadFile = func(string) ([]byte, error) {
+		return []byte("GIF89a"), nil
+	}
+	defer func() {
+		osReadFile = os.ReadFile
+	}()
+
+	result := &PreviewResult{
+		JobID:         "job",
+		Prefix:        "prefix",
+		RecordingDate: "28-01-2023",
+		FileName:      "test_recording.gif",
+		FilePath:      "/data/test_recording.gif",
+		ContentType:   "image/gif",
+	}
+	tWebhook := result.WebhookTask()
+	require.Equal(t, "preview", tWebhook.Event)
+	require.Equal(t, "job", tWebhook.JobID)
+	require.Equal(t, map[string]string{
+		"prefix":         "prefix",
+		"recording_date": "28-01-2023",
+		"file_name":      "test_recording.gif",
+		"content_type":   "image/gif",
+		"image":          "R0lGODlh",
+	}, tWebhook.Data)
+
+	osReadFile = func(string) ([]byte, error) {
+		return nil, fmt.Errorf("mock error")
+	}
+	require.Nil(t, result.WebhookTask())
+}
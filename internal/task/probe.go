@@ -0,0 +1,180 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	// mocks for tests.
+	ffmpegProbe        = ffmpeg.Probe
+	ffmpegProbeTimeout = ffmpeg.ProbeWithTimeout
+)
+
+// probeResult describes ffprobe output.
+type probeResult struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		Size     string            `json:"size"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+	} `json:"streams"`
+}
+
+// StreamProbe describes live stream probed without recording.
+type StreamProbe struct {
+	Source     string  `json:"source"`
+	Stream     string  `json:"stream,omitempty"` // Name of named stream.
+	OK         bool    `json:"ok"`
+	VideoCodec string  `json:"video_codec,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FPS        float64 `json:"fps,omitempty"`
+	Audio      bool    `json:"audio"`
+	AudioCodec string  `json:"audio_codec,omitempty"`
+	Latency    int64   `json:"latency_ms"` // Time to open stream and read its info.
+	ErrorClass string  `json:"error_class,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Duration returns duration of probed file in seconds.
+func (p *probeResult) Duration() float64 {
+	duration, _ := strconv.ParseFloat(p.Format.Duration, 64)
+	return duration
+}
+
+// probe runs ffprobe against fileName.
+func probe(fileName string) (*probeResult, error) {
+	out, err := ffmpegProbe(fileName)
+	if err != nil {
+		return nil, err
+	}
+	result := &probeResult{}
+	if err := json.Unmarshal([]byte(out), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// HasStreams reports whether camera has configured streams or named streams.
+func (c *ProbeConfig) HasStreams(camName string) bool {
+	return len(c.Streams[camName]) > 0 || len(c.NamedStreams[camName]) > 0
+}
+
+// Probe probes stream, or every stream configured for camera when stream is empty.
+// Streams are probed in parallel, failed probe is reported in its result.
+func (c *ProbeConfig) Probe(stream, camName string) ([]*StreamProbe, error) {
+	type probeSource struct{ name, url string }
+	var sources []probeSource
+	if stream != "" {
+		sources = append(sources, probeSource{url: stream})
+	} else {
+		for _, url := range c.Streams[camName] {
+			sources = append(sources, probeSource{url: url})
+		}
+		named := c.NamedStreams[camName]
+		for _, name := range slices.Sorted(maps.Keys(named)) {
+			sources = append(sources, probeSource{name: name, url: named[name]})
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("camera %s has no configured streams", camName)
+	}
+
+	results := make([]*StreamProbe, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probeStream(source.url, c.InputArgs, time.Duration(c.Timeout)*time.Second)
+			results[i].Stream = source.name
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// probeStream runs ffprobe against live stream with inputArgs, ffprobe is killed after timeout.
+func probeStream(source string, inputArgs map[string]string, timeout time.Duration) *StreamProbe {
+	result := &StreamProbe{Source: redactURL(source)}
+	kwArgs := ffmpeg.KwArgs{"v": "error"}
+	for k, v := range inputArgs {
+		kwArgs[k] = v
+	}
+
+	start := timeNow()
+	out, err := ffmpegProbeTimeout(source, timeout, kwArgs)
+	elapsed := timeNow().Sub(start)
+	result.Latency = elapsed.Milliseconds()
+	if err != nil {
+		result.ErrorClass = classifyStderr(err.Error(), timeout > 0 && elapsed >= timeout)
+		result.Error = strings.Join(strings.Fields(redactStderr(err.Error(), source)), " ")
+		return result
+	}
+
+	probed := &probeResult{}
+	if err := json.Unmarshal([]byte(out), probed); err != nil {
+		result.ErrorClass = ErrorClassUnknown
+		result.Error = fmt.Sprintf("unable to read ffprobe output: %v", err)
+		return result
+	}
+	for _, s := range probed.Streams {
+		switch {
+		case s.CodecType == "video" && result.VideoCodec == "":
+			result.VideoCodec = s.CodecName
+			result.Width = s.Width
+			result.Height = s.Height
+			result.FPS = frameRate(s.AvgFrameRate)
+			if result.FPS == 0 {
+				result.FPS = frameRate(s.RFrameRate)
+			}
+		case s.CodecType == "audio" && !result.Audio:
+			result.Audio = true
+			result.AudioCodec = s.CodecName
+		}
+	}
+	if result.VideoCodec == "" {
+		result.ErrorClass = ErrorClassNotFound
+		result.Error = "stream has no video"
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// redactStderr removes credentials of source from ffprobe output.
+func redactStderr(stderr, source string) string {
+	return strings.ReplaceAll(stderr, source, redactURL(source))
+}
+
+// frameRate parses ffprobe frame rate, e.g. "30000/1001", unknown rate is 0.
+func frameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		fps, _ := strconv.ParseFloat(rate, 64)
+		return fps
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*100) / 100
+}
@@ -0,0 +1,183 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"recorder/internal/job"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	errStalled         = errors.New("ffmpeg stalled")
+	stallCheckInterval = time.Second
+)
+
+// progressWatcher parses ffmpeg -progress output.
+// Every block of keys is reported to onProgress, which can be nil.
+type progressWatcher struct {
+	mu         sync.Mutex
+	buf        []byte
+	current    job.Progress
+	advanced   time.Time
+	onProgress func(*job.Progress)
+}
+
+func newProgressWatcher(onProgress func(*job.Progress)) *progressWatcher {
+	return &progressWatcher{
+		advanced:   timeNow(),
+		onProgress: onProgress,
+	}
+}
+
+// Write implements io.Writer, incomplete lines are kept until next write.
+func (w *progressWatcher) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.parseLine(strings.TrimSpace(string(w.buf[:i])))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// parseLine updates current progress with single key=value line.
+// Values which are not available yet (N/A) are ignored.
+func (w *progressWatcher) parseLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+	switch key {
+	case "frame":
+		w.current.Frame, _ = strconv.ParseInt(value, 10, 64)
+	case "fps":
+		w.current.FPS, _ = strconv.ParseFloat(value, 64)
+	case "bitrate":
+		w.current.Bitrate, _ = strconv.ParseFloat(strings.TrimSuffix(value, "kbits/s"), 64)
+	case "speed":
+		w.current.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	case "drop_frames":
+		w.current.DroppedFrames, _ = strconv.ParseInt(value, 10, 64)
+	case "out_time_us":
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return
+		}
+		if outTime := float64(us) / float64(time.Second/time.Microsecond); outTime > w.current.OutTime {
+			w.current.OutTime = outTime
+			w.advanced = timeNow()
+		}
+	case "progress":
+		w.report()
+	}
+}
+
+// report passes copy of current progress to onProgress.
+func (w *progressWatcher) report() {
+	if w.onProgress != nil {
+		progress := w.current
+		w.onProgress(&progress)
+	}
+}
+
+// stalled returns true when out_time didn't advance for longer than stall.
+func (w *progressWatcher) stalled(stall time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return timeNow().Sub(w.advanced) > stall
+}
+
+// finish reports final progress, after ffmpeg exited.
+func (w *progressWatcher) finish(stalled bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.current.Done = true
+	w.current.Stalled = stalled
+	w.report()
+}
+
+// jobProgress returns onProgress which reports progress of filePath to job registry stored in ctx.
+func jobProgress(ctx context.Context, jobID, task, filePath string) func(*job.Progress) {
+	jobs := job.FromContext(ctx)
+	return func(progress *job.Progress) {
+		progress.Task = task
+		progress.File = filePath
+		jobs.SetProgress(jobID, progress)
+	}
+}
+
+// runFFmpeg runs stream with progress reported to onProgress.
+// ffmpeg is killed after timeout, or when its output time doesn't advance for stall (0 disables it).
+// Failure is returned as *FFmpegError, classified by ffmpeg stderr.
+func runFFmpeg(stream *ffmpeg.Stream, timeout, stall time.Duration, onProgress func(*job.Progress)) error {
+	// GlobalArgs creates new stream, context with options has to be kept.
+	ctx, cancel := context.WithCancel(stream.Context)
+	defer cancel()
+	stream = stream.GlobalArgs("-progress", "pipe:1")
+	stream.Context = ctx
+
+	watcher := newProgressWatcher(onProgress)
+	done := make(chan struct{})
+	stalled := make(chan struct{})
+	if stall > 0 {
+		go func() {
+			ticker := time.NewTicker(stallCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if watcher.stalled(stall) {
+						close(stalled)
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	stderr := newRingBuffer(stderrBufferSize)
+	stream = stream.WithOutput(watcher, stderr).WithTimeout(timeout)
+	err := stream.Run()
+	close(done)
+
+	// Process which finished successfully was not killed, even when stall was detected meanwhile.
+	isStalled := false
+	select {
+	case <-stalled:
+		isStalled = err != nil
+	default:
+	}
+	watcher.finish(isStalled)
+	if isStalled {
+		return &FFmpegError{
+			Class:  ErrorClassTimeout,
+			Stderr: stderr.String(),
+			Err:    fmt.Errorf("%w, no progress for %s", errStalled, stall),
+		}
+	}
+	if err != nil {
+		return &FFmpegError{
+			Class:  classifyStderr(stderr.String(), errors.Is(stream.Context.Err(), context.DeadlineExceeded)),
+			Stderr: stderr.String(),
+			Err:    err,
+		}
+	}
+	return nil
+}
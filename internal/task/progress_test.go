@@ -0,0 +1,58 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"recorder/internal/job"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressWatcher(t *testing.T) {
+	now := time.Date(2023, 2, 20, 7, 36, 36, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	var reported []*job.Progress
+	w := newProgressWatcher(func(p *job.Progress) {
+		reported = append(reported, p)
+	})
+
+	// Values which are not available yet are ignored.
+	w.Write([]byte("frame=0\nfps=0.00\nbitrate=N/A\nout_time_us=N/A\nspeed=N/A\nprogress=continue\n"))
+	now = now.Add(5 * time.Second)
+	require.True(t, w.stalled(4*time.Second))
+
+	// Lines can be split between writes.
+	w.Write([]byte("frame=125\nfps=25.00\nstream_0_0_q=-1.0\nbitrate=2048.3kbits/s\ntotal_size=1280000\nout_ti"))
+	w.Write([]byte("me_us=5000000\nout_time_ms=5000000\nout_time=00:00:05.000000\ndup_frames=0\ndrop_frames=3\nspeed=1.01x\nprogress=continue\n"))
+	require.False(t, w.stalled(4*time.Second))
+
+	// Repeated out_time doesn't advance.
+	now = now.Add(5 * time.Second)
+	w.Write([]byte("out_time_us=5000000\nprogress=continue\n"))
+	require.True(t, w.stalled(4*time.Second))
+
+	w.finish(true)
+
+	require.Equal(t, []*job.Progress{
+		{},
+		{Frame: 125, FPS: 25, Bitrate: 2048.3, OutTime: 5, DroppedFrames: 3, Speed: 1.01},
+		{Frame: 125, FPS: 25, Bitrate: 2048.3, OutTime: 5, DroppedFrames: 3, Speed: 1.01},
+		{Frame: 125, FPS: 25, Bitrate: 2048.3, OutTime: 5, DroppedFrames: 3, Speed: 1.01, Done: true, Stalled: true},
+	}, reported)
+}
+
+func TestJobProgress(t *testing.T) {
+	jobs := job.NewRegistry(1)
+	jobs.Create("a")
+
+	onProgress := jobProgress(job.WithRegistry(t.Context(), jobs), "a", "record", "/data/a.mp4")
+	onProgress(&job.Progress{OutTime: 2})
+
+	j, _ := jobs.Get("a")
+	require.Equal(t, []*job.Progress{{Task: "record", File: "/data/a.mp4", OutTime: 2}}, j.Progress)
+}
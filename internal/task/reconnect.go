@@ -0,0 +1,181 @@
+package task
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"recorder/internal/job"
+)
+
+var (
+	// minPieceLength is the shortest piece recorded after reconnect.
+	minPieceLength = time.Second
+	// permanentErrorClasses are not fixed by reconnecting.
+	permanentErrorClasses = []string{ErrorClassAuth, ErrorClassNotFound, ErrorClassCodec, ErrorClassDiskFull}
+
+	recordGaps = struct {
+		mu    sync.Mutex
+		stats map[string]GapStats
+	}{stats: make(map[string]GapStats)}
+
+	// mocks for tests.
+	recordPiece  = ffmpegRecord
+	stitchPieces = ffmpegConvert
+	timeSleep    = time.Sleep
+)
+
+// Reconnect describes how burst is recorded again after stream drops.
+type Reconnect struct {
+	Attempts int
+	Delay    int // Seconds between stream drop and reconnect.
+}
+
+// GapStats describes gaps in recordings of single camera.
+type GapStats struct {
+	Gaps    int64
+	Seconds float64
+}
+
+// gap describes missing part of burst, relative to its start.
+type gap struct {
+	Offset time.Duration
+	Length time.Duration
+}
+
+// RecordGaps returns gaps of stitched recordings, by camera.
+func RecordGaps() map[string]GapStats {
+	recordGaps.mu.Lock()
+	defer recordGaps.mu.Unlock()
+
+	return maps.Clone(recordGaps.stats)
+}
+
+func countGaps(camName string, gaps []gap) {
+	recordGaps.mu.Lock()
+	defer recordGaps.mu.Unlock()
+
+	s := recordGaps.stats[camName]
+	for _, g := range gaps {
+		s.Gaps++
+		s.Seconds += g.Length.Seconds()
+	}
+	recordGaps.stats[camName] = s
+}
+
+// recordStitched records burst from sources into filePath, reconnecting when stream drops before burst length.
+// Recorded pieces are stitched into single file, gaps are written into metadata.
+// Sources of recorded pieces are returned, comma separated.
+func (r *Record) recordStitched(config *RecordConfig, container *Container, sources []string, filePath string, outputArgs, metadata map[string]string, onProgress func(*job.Progress)) (string, error) {
+	if config.Reconnect == nil {
+		return r.recordFromSources(config, sources, filePath, outputArgs, metadata, r.Length, onProgress)
+	}
+
+	start := timeNow()
+	end := start.Add(time.Duration(r.Length) * time.Second)
+	var pieces, used []string
+	var gaps []gap
+	var pieceStarts []time.Time
+	var pieceEnd time.Time
+	var err error
+	for attempt := 0; attempt <= config.Reconnect.Attempts; attempt++ {
+		remaining := end.Sub(timeNow())
+		if attempt > 0 && remaining < minPieceLength {
+			break
+		}
+
+		piecePath := piecePath(filePath, attempt)
+		pieceStart := timeNow()
+		var source string
+		source, err = r.recordFromSources(config, sources, piecePath, outputArgs, metadata, int64(math.Ceil(remaining.Seconds())), onProgress)
+		if duration := pieceDuration(piecePath); duration > 0 {
+			if len(pieces) > 0 {
+				gaps = append(gaps, gap{Offset: pieceEnd.Sub(start), Length: pieceStart.Sub(pieceEnd)})
+			}
+			pieces = append(pieces, piecePath)
+			pieceStarts = append(pieceStarts, pieceStart)
+			pieceEnd = pieceStart.Add(duration)
+			if !slices.Contains(used, source) {
+				used = append(used, source)
+			}
+		} else {
+			osRemove(piecePath)
+		}
+
+		if err == nil || slices.Contains(permanentErrorClasses, errorClass(err)) {
+			break
+		}
+		log.Printf("stream of %s dropped, reconnecting (attempt:%d): %v", filepath.Base(filePath), attempt+1, err)
+		timeSleep(time.Duration(config.Reconnect.Delay) * time.Second)
+	}
+
+	if len(pieces) == 0 {
+		return "", err
+	}
+	if len(pieces) == 1 {
+		return used[0], osRename(pieces[0], filePath)
+	}
+	defer func() {
+		for _, piece := range pieces {
+			osRemove(piece)
+		}
+	}()
+
+	countGaps(r.CamName, gaps)
+	stitchedMetadata := maps.Clone(metadata)
+	stitchedMetadata["gaps"] = formatGaps(gaps)
+	stitchedMetadata["source"] = strings.Join(used, ",")
+	stitchedArgs := withContainer(map[string]string{"c": "copy"}, container)
+	if err := stitchPieces(stitchParts(pieces, pieceStarts), filePath, map[string]string{"f": "concat", "safe": "0"}, stitchedArgs, stitchedMetadata, r.Length, 0, nil); err != nil {
+		return "", fmt.Errorf("unable to stitch %d pieces: %w", len(pieces), err)
+	}
+	log.Printf("stitched %s from %d pieces (gaps:%s)", filepath.Base(filePath), len(pieces), stitchedMetadata["gaps"])
+	return stitchedMetadata["source"], nil
+}
+
+// stitchParts returns concat demuxer directives for recorded pieces.
+// Every piece but the last one lasts until the next piece started, so gaps are kept in timestamps
+// and stitched burst has its full length, aligned with other bursts.
+func stitchParts(pieces []string, pieceStarts []time.Time) []string {
+	var parts []string
+	for i, piece := range pieces {
+		parts = append(parts, "file "+piece)
+		if i < len(pieces)-1 {
+			parts = append(parts, fmt.Sprintf("duration %.3f", pieceStarts[i+1].Sub(pieceStarts[i]).Seconds()))
+		}
+	}
+	return parts
+}
+
+// piecePath returns path of piece i of burst, e.g. cam1-001-003.part1.mp4.
+func piecePath(filePath string, i int) string {
+	ext := filepath.Ext(filePath)
+	return fmt.Sprintf("%s.part%d%s", strings.TrimSuffix(filePath, ext), i, ext)
+}
+
+// pieceDuration returns duration of recorded piece, 0 when it contains nothing.
+func pieceDuration(piecePath string) time.Duration {
+	if _, err := osStat(piecePath); err != nil {
+		return 0
+	}
+	result, err := probe(piecePath)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(result.Duration() * float64(time.Second))
+}
+
+// formatGaps returns gaps as comma separated offset+length in seconds, e.g. 4.00+2.50.
+func formatGaps(gaps []gap) string {
+	var formatted []string
+	for _, g := range gaps {
+		formatted = append(formatted, fmt.Sprintf("%.2f+%.2f", g.Offset.Seconds(), g.Length.Seconds()))
+	}
+	return strings.Join(formatted, ",")
+}
@@ -2,13 +2,19 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"recorder/internal/job"
+
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
@@ -24,86 +30,241 @@ var (
 )
 
 type Record struct {
-	Stream  string
-	Prefix  string
-	CamName string
-	Length  int64
-	Burst   int64
+	Stream    string
+	JobID     string
+	Prefix    string
+	CamName   string
+	Length    int64
+	Burst     int64
+	Tags      map[string]string // Written into container metadata.
+	Container string            // Overrides container of camera.
+	Streams   []string          // Tried in order after Stream fails, before streams of camera.
+	EventID   string            // Groups recordings of named streams, job ID is used when empty.
+
+	// NamedStreams are recorded in sync, by stream name. Overrides named streams of camera.
+	NamedStreams map[string]string
+	// StreamName is name of recorded stream, e.g. main or sub. Set for recordings of named streams.
+	StreamName string
+}
+
+// RecordResult is published by Record task.
+// It is implemented by SingleRecordResult and MultipleRecordResult.
+type RecordResult interface {
+	recordResult()
 }
 
+// SingleRecordResult is published when single burst is recorded.
+// Unmasked is set when camera has privacy masks which were not applied.
 type SingleRecordResult struct {
-	RecordRootDir  string
-	Prefix         string
-	RecordingDate  string
-	FileName       string
-	FilePath       string
-	FileNamePrefix string
+	RecordRootDir string
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	Unmasked      bool
+	Source        string
+	EventID       string
+	StreamName    string
 }
 
+// MultipleRecordResult is published when all bursts are recorded.
+// FilesOffset contains start of every burst, relative to start of the first one.
 type MultipleRecordResult struct {
-	RecordRootDir  string
-	Prefix         string
-	RecordingDate  string
-	FilesPath      []string
-	FileNamePrefix string
-	TotalLength    int64
+	RecordRootDir string
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	Tags          map[string]string
+	RecordingDate string
+	FilesPath     []string
+	FilesOffset   []time.Duration
+	Length        int64
+	TotalLength   int64
+	EventID       string
+	StreamName    string
 }
 
-func (r *Record) Do(ctx context.Context, chResult chan interface{}) error {
-	log.Printf("recording stream:%s; burst:%d; length:%d; cam_name:%s, prefix:%s", r.Stream, r.Burst, r.Length, r.CamName, r.Prefix)
+func (*SingleRecordResult) recordResult()   {}
+func (*MultipleRecordResult) recordResult() {}
 
-	var wg sync.WaitGroup
-	var parts []string
+// UploadTask returns task which uploads recorded burst.
+func (r *SingleRecordResult) UploadTask() *Upload {
+	return &Upload{
+		JobID:         r.JobID,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactBursts,
+		Unmasked:      r.Unmasked,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+	}
+}
 
-	startTime := timeNow()
-	// /data/prefix/20-02-2023
-	dirPath := filepath.Join(ctx.Value("outputDir").(string), r.Prefix, startTime.Format(dateLayout))
-	// 07:36:36.178-cam_nam
-	fileNamePrefix := fmt.Sprintf("%s-%s", startTime.Format(timeLayout), r.CamName)
+// ConvertTask returns task which converts all recorded bursts.
+func (r *MultipleRecordResult) ConvertTask() *Convert {
+	return &Convert{
+		JobID:         r.JobID,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		Tags:          r.Tags,
+		RecordingDate: r.RecordingDate,
+		FilesPath:     r.FilesPath,
+		FilesOffset:   r.FilesOffset,
+		Length:        r.Length,
+		TotalLength:   r.TotalLength,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+	}
+}
 
-	if err := osMkdirAll(dirPath, 0755); err != nil {
-		log.Printf("unable to create %s: %v", dirPath, err)
+func (r *Record) Do(ctx context.Context, chResult chan RecordResult) error {
+	config, err := ConfigFromContext[RecordConfig](ctx)
+	if err != nil {
 		return err
 	}
 
-	for i := int64(0); i < r.Burst; i++ {
+	namedStreams := r.NamedStreams
+	if len(namedStreams) == 0 {
+		namedStreams = config.NamedStreams[r.CamName]
+	}
+	if len(namedStreams) == 0 {
+		return r.record(ctx, chResult, config, timeNow())
+	}
+
+	// All streams share start time, so recordings of event are aligned.
+	startTime := timeNow()
+	names := slices.Sorted(maps.Keys(namedStreams))
+	log.Printf("recording event %s of %s (streams:%s)", r.eventID(), r.CamName, strings.Join(names, ","))
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(names))
+	for i, name := range names {
 		wg.Add(1)
-		go func(r *Record, i int64) {
+		go func(i int, name string) {
 			defer wg.Done()
+			if err := r.namedStream(name, namedStreams[name]).record(ctx, chResult, config, startTime); err != nil {
+				errs[i] = fmt.Errorf("stream %s: %w", name, err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// namedStream returns task which records single named stream of event.
+// Event ID and stream name are written into metadata of recordings.
+func (r *Record) namedStream(name, stream string) *Record {
+	tags := maps.Clone(r.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	tags["event_id"] = r.eventID()
+	tags["stream"] = name
 
-			// 07:36:36.178-cam_nam-001-003.mp4
-			fileName := fmt.Sprintf("%s-%03d-%03d.mp4", fileNamePrefix, i+1, r.Burst)
-			// /data/prefix/20-02-2023/07:36:36.178-cam_nam-001-003.mp4
-			filePath := filepath.Join(dirPath, fileName)
+	named := *r
+	named.Stream = stream
+	named.Streams = nil
+	named.NamedStreams = nil
+	named.StreamName = name
+	named.EventID = r.eventID()
+	named.Tags = tags
+	return &named
+}
 
-			now := timeNow()
-			if err := ffmpegRecord(r.Stream, filePath, ctx.Value("ffmpegInputArgs").(map[string]string), ctx.Value("ffmpegOutputArgs").(map[string]string), r.Length); err != nil {
-				log.Printf("unable to record %s from stream: %v", fileName, err)
-				return
-			}
-			log.Printf("recorded %s (took:%.2fs)", fileName, time.Since(now).Seconds())
-
-			chResult <- &SingleRecordResult{
-				RecordRootDir:  ctx.Value("outputDir").(string),
-				Prefix:         r.Prefix,
-				RecordingDate:  startTime.Format(dateLayout),
-				FileName:       fileName,
-				FilePath:       filePath,
-				FileNamePrefix: fileNamePrefix,
-			}
+// eventID returns ID of event, job ID is used when it is not set.
+func (r *Record) eventID() string {
+	if r.EventID != "" {
+		return r.EventID
+	}
+	return r.JobID
+}
+
+// record records all bursts of single stream, starting at startTime.
+func (r *Record) record(ctx context.Context, chResult chan RecordResult, config *RecordConfig, startTime time.Time) error {
+	log.Printf("recording stream:%s; burst:%d; length:%d; cam_name:%s, prefix:%s", r.Stream, r.Burst, r.Length, r.CamName, r.Prefix)
+
+	var parts []string
+	var offsets []time.Duration
+	recorded := make([]string, r.Burst)
+	recordedOffset := make([]time.Duration, r.Burst)
+
+	container, err := r.container(config)
+	if err != nil {
+		return err
+	}
+	sources := r.sources(config)
+	if len(sources) == 0 {
+		return fmt.Errorf("no stream for camera %s", r.CamName)
+	}
+	outputArgs := withContainer(config.OutputArgs, container)
+
+	// /data/prefix/20-02-2023/07:36:36.178-cam_nam-001-003.mp4
+	filesPath := make([]string, r.Burst)
+	for i := range filesPath {
+		filesPath[i] = filepath.Join(config.OutputDir, config.Naming.Path(config.Naming.Record, &NameVars{
+			Prefix:  r.Prefix,
+			CamName: r.CamName,
+			Start:   startTime,
+			Burst:   int64(i) + 1,
+			Bursts:  r.Burst,
+			Ext:     container.Ext,
+			Stream:  r.StreamName,
+			Event:   r.EventID,
+		}))
+		dirPath := filepath.Dir(filesPath[i])
+		if err := osMkdirAll(dirPath, 0755); err != nil {
+			log.Printf("unable to create %s: %v", dirPath, err)
+			return err
+		}
+	}
+
+	masks := config.Masks[r.CamName]
+	if len(masks) > 0 && config.ApplyMasks {
+		outputArgs = withVideoFilter(outputArgs, maskFilter(masks), "")
+	}
+	unmasked := len(masks) > 0 && !config.ApplyMasks
+
+	if config.BurstMode == BurstModeSegment {
+		r.recordSegments(ctx, chResult, config, container, sources, outputArgs, filesPath, startTime, unmasked, recorded)
+	} else {
+		r.recordBursts(ctx, chResult, config, container, sources, outputArgs, filesPath, startTime, unmasked, recorded, recordedOffset)
+	}
+
+	// Keep bursts in recording order, convert depends on it.
+	// Segments don't overlap, so they have no offsets.
+	for i, filePath := range recorded {
+		if filePath != "" {
 			parts = append(parts, filePath)
-		}(r, i)
-		time.Sleep(time.Duration(r.Length-int64(burstOverlap)) * time.Second)
+			if config.BurstMode != BurstModeSegment {
+				offsets = append(offsets, recordedOffset[i])
+			}
+		}
 	}
-	wg.Wait()
+
 	if len(parts) > 0 {
 		chResult <- &MultipleRecordResult{
-			RecordRootDir:  ctx.Value("outputDir").(string),
-			Prefix:         r.Prefix,
-			RecordingDate:  startTime.Format(dateLayout),
-			FilesPath:      parts,
-			FileNamePrefix: fileNamePrefix,
-			TotalLength:    int64(len(parts)) * r.Length,
+			RecordRootDir: config.OutputDir,
+			JobID:         r.JobID,
+			Prefix:        r.Prefix,
+			CamName:       r.CamName,
+			StartTime:     startTime,
+			Tags:          r.Tags,
+			RecordingDate: config.Naming.Date(startTime),
+			FilesPath:     parts,
+			FilesOffset:   offsets,
+			Length:        r.Length,
+			TotalLength:   int64(len(parts)) * r.Length,
+			EventID:       r.EventID,
+			StreamName:    r.StreamName,
 		}
 	}
 
@@ -114,7 +275,159 @@ func (r *Record) Do(ctx context.Context, chResult chan interface{}) error {
 	return nil
 }
 
-func ffmpegRecord(stream, outputFile string, inputArgs map[string]string, outputArgs map[string]string, length int64) error {
+// recordBursts records every burst with its own ffmpeg, bursts are overlapping.
+// Paths and offsets of recorded bursts are set in recorded and recordedOffset.
+func (r *Record) recordBursts(ctx context.Context, chResult chan RecordResult, config *RecordConfig, container *Container, sources []string, outputArgs map[string]string, filesPath []string, startTime time.Time, unmasked bool, recorded []string, recordedOffset []time.Duration) {
+	var wg sync.WaitGroup
+	for i := int64(0); i < r.Burst; i++ {
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+
+			filePath := filesPath[i]
+			var status, source string
+			var err error
+			now := timeNow()
+			offset := burstOffset(r.Length, i)
+			for attempt := 0; ; attempt++ {
+				if attempt > 0 {
+					offset = timeNow().Sub(startTime)
+				}
+				status, source, err = r.recordBurst(config, container, sources, outputArgs, filePath, i, startTime.Add(offset), jobProgress(ctx, r.JobID, "record", filePath))
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) || attempt >= config.Validation.Retries {
+					break
+				}
+				log.Printf("recording %s again (attempt:%d): %v", filepath.Base(filePath), attempt+1, err)
+			}
+
+			if r.reportBurst(ctx, chResult, config, filePath, startTime, status, source, unmasked, now, err) {
+				recorded[i] = filePath
+				recordedOffset[i] = offset
+			}
+		}(i)
+		time.Sleep(burstOffset(r.Length, 1))
+	}
+	wg.Wait()
+}
+
+// reportBurst reports recorded burst in job and publishes its result, now is when recording started.
+// Failed burst is published as FailureResult, false is returned then.
+func (r *Record) reportBurst(ctx context.Context, chResult chan RecordResult, config *RecordConfig, filePath string, startTime time.Time, status, source string, unmasked bool, now time.Time, err error) bool {
+	fileName := filepath.Base(filePath)
+	if err != nil {
+		log.Printf("unable to record %s from stream: %v", fileName, err)
+		countFFmpegError("record", err)
+		if status == "" {
+			status = StatusFailed
+		}
+		job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{
+			Type:       "burst",
+			FilePath:   filePath,
+			Status:     status,
+			Error:      err.Error(),
+			ErrorClass: errorClass(err),
+			Stream:     r.StreamName,
+		})
+		chResult <- &FailureResult{
+			Task:       "record",
+			JobID:      r.JobID,
+			Prefix:     r.Prefix,
+			CamName:    r.CamName,
+			FilePath:   filePath,
+			ErrorClass: errorClass(err),
+			Error:      err.Error(),
+			EventID:    r.EventID,
+			StreamName: r.StreamName,
+		}
+		return false
+	}
+	job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{Type: "burst", FilePath: filePath, Status: status, Source: source, Stream: r.StreamName})
+	log.Printf("recorded %s (finalize:%s; took:%.2fs)", fileName, status, time.Since(now).Seconds())
+
+	chResult <- &SingleRecordResult{
+		RecordRootDir: config.OutputDir,
+		JobID:         r.JobID,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     startTime,
+		RecordingDate: config.Naming.Date(startTime),
+		FileName:      fileName,
+		FilePath:      filePath,
+		Unmasked:      unmasked,
+		Source:        source,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+	}
+	return true
+}
+
+// container returns container selected by request, camera config or default one.
+func (r *Record) container(config *RecordConfig) (*Container, error) {
+	name := r.Container
+	if name == "" {
+		name = config.Containers[r.CamName]
+	}
+	if name == "" {
+		name = config.Container
+	}
+	if name == "" {
+		name = "mp4"
+	}
+	container, ok := LookupContainer(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown container %s", name)
+	}
+	return container, nil
+}
+
+// recordBurst records burst i from sources into filePath, then finalizes and validates it.
+// Returned status describes burst reported in job, it is empty when nothing checked the file.
+// Returned source describes sources which were recorded.
+func (r *Record) recordBurst(config *RecordConfig, container *Container, sources []string, outputArgs map[string]string, filePath string, i int64, start time.Time, onProgress func(*job.Progress)) (status string, source string, err error) {
+	metadata := recordingMetadata(r.CamName, r.Prefix, start, r.Tags)
+	metadata["burst"] = fmt.Sprintf("%d/%d", i+1, r.Burst)
+
+	source, err = r.recordStitched(config, container, sources, filePath, outputArgs, metadata, onProgress)
+	status, err = r.checkBurst(config, container, filePath, err)
+	return status, source, err
+}
+
+// checkBurst finalizes and validates recorded burst, recordErr is error of recording.
+// Burst which can't be used is removed.
+func (r *Record) checkBurst(config *RecordConfig, container *Container, filePath string, recordErr error) (status string, err error) {
+	if config.Finalize {
+		status = finalize(filePath, container, r.Length, time.Duration(config.StallTimeout)*time.Second, recordErr)
+		if status == FinalizeUnrecoverable && recordErr != nil {
+			return status, fmt.Errorf("%w: %w", errUnrecoverable, recordErr)
+		}
+		if status == FinalizeUnrecoverable {
+			return status, errUnrecoverable
+		}
+	} else if recordErr != nil {
+		osRemove(filePath)
+		return status, recordErr
+	}
+
+	if config.Validation != nil {
+		if err := config.Validation.Check(filePath, r.Length); err != nil {
+			osRemove(filePath)
+			return StatusInvalid, err
+		}
+		if status == "" {
+			status = StatusValid
+		}
+	}
+	return status, nil
+}
+
+// burstOffset returns start of burst i, relative to start of the first burst.
+// Every burst starts burstOverlap seconds before previous one ends.
+func burstOffset(length, i int64) time.Duration {
+	return time.Duration(i*(length-int64(burstOverlap))) * time.Second
+}
+
+func ffmpegRecord(stream, outputFile string, inputArgs map[string]string, outputArgs map[string]string, metadata map[string]string, length int64, stall time.Duration, onProgress func(*job.Progress)) error {
 	inputKwArgs := ffmpeg.KwArgs{}
 	outputKwArgs := ffmpeg.KwArgs{"t": length}
 
@@ -125,15 +438,8 @@ func ffmpegRecord(stream, outputFile string, inputArgs map[string]string, output
 	for k, v := range outputArgs {
 		outputKwArgs[k] = v
 	}
+	addMetadata(outputKwArgs, outputFile, metadata)
 
-	err := ffmpeg.Input(stream, inputKwArgs).
-		Output(outputFile, outputKwArgs).
-		WithTimeout(time.Duration(length*int64(ffmpegRecordRatio)) * time.Second).
-		Run()
-
-	if err != nil {
-		defer os.Remove(outputFile)
-		return err
-	}
-	return nil
+	return runFFmpeg(ffmpeg.Input(stream, inputKwArgs).Output(outputFile, outputKwArgs),
+		time.Duration(length*int64(ffmpegRecordRatio))*time.Second, stall, onProgress)
 }
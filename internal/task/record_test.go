@@ -2,12 +2,17 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
+	"recorder/internal/job"
+
 	"github.com/stretchr/testify/require"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
@@ -18,24 +23,27 @@ var (
 )
 
 func TestRecordDo(t *testing.T) {
+	recordStartTime := time.Date(2023, time.January, 20, 1, 2, 3, 4, time.UTC)
 	tests := []struct {
 		inputCtxFunc          func() context.Context
-		inputChResult         chan interface{}
+		inputChResult         chan RecordResult
 		inputRecord           *Record
 		inputFuncBeforeRecord func()
 		mockOsMkdirAll        func(string, os.FileMode) error
 		expectedErr           error
-		expectedResults       []interface{}
+		expectedResults       []RecordResult
 	}{
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &RecordConfig{
+					OutputDir:  outputPath,
+					Naming:     &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+					InputArgs:  map[string]string{},
+					OutputArgs: map[string]string{},
+				})
 			},
-			inputChResult: make(chan interface{}, 1),
+			inputChResult: make(chan RecordResult, 1),
 			inputRecord: &Record{
 				Stream:  "stream",
 				Prefix:  "prefix",
@@ -51,12 +59,14 @@ func TestRecordDo(t *testing.T) {
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &RecordConfig{
+					OutputDir:  outputPath,
+					Naming:     &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+					InputArgs:  map[string]string{},
+					OutputArgs: map[string]string{},
+				})
 			},
-			inputChResult: make(chan interface{}, 1),
+			inputChResult: make(chan RecordResult, 1),
 			inputRecord: &Record{
 				Stream:  "missing_stream",
 				Prefix:  "prefix",
@@ -65,16 +75,28 @@ func TestRecordDo(t *testing.T) {
 				Burst:   1,
 			},
 			expectedErr: fmt.Errorf("unable to record all bursts"),
+			expectedResults: []RecordResult{
+				&FailureResult{
+					Task:       "record",
+					Prefix:     "prefix",
+					CamName:    "camName",
+					FilePath:   "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-001.mp4",
+					ErrorClass: ErrorClassNotFound,
+				},
+			},
 		},
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &RecordConfig{
+					OutputDir:  outputPath,
+					Naming:     &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+					InputArgs:  map[string]string{},
+					OutputArgs: map[string]string{},
+					Masks:      map[string][]Mask{"camName": {{Type: MaskBlack, Rect: []int{0, 0, 10, 10}}}},
+				})
 			},
-			inputChResult: make(chan interface{}, 3),
+			inputChResult: make(chan RecordResult, 3),
 			inputRecord: &Record{
 				Stream:  filepath.Join(outputPath, "test_recording.mp4"),
 				Prefix:  "prefix",
@@ -82,36 +104,44 @@ func TestRecordDo(t *testing.T) {
 				Length:  3,
 				Burst:   1,
 			},
-			expectedResults: []interface{}{
+			expectedResults: []RecordResult{
 				&SingleRecordResult{
-					RecordRootDir:  "/tmp/recorder_tests",
-					Prefix:         "prefix",
-					RecordingDate:  "20-01-2023",
-					FileName:       "01:02:03.000-camName-001-001.mp4",
-					FilePath:       "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-001.mp4",
-					FileNamePrefix: "01:02:03.000-camName",
+					RecordRootDir: "/tmp/recorder_tests",
+					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
+					RecordingDate: "20-01-2023",
+					FileName:      "01:02:03.000-camName-001-001.mp4",
+					FilePath:      "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-001.mp4",
+					Unmasked:      true,
+					Source:        "/tmp/recorder_tests/test_recording.mp4",
 				},
 				&MultipleRecordResult{
 					RecordRootDir: "/tmp/recorder_tests",
 					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
 					RecordingDate: "20-01-2023",
 					FilesPath: []string{
 						"/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-001.mp4",
 					},
-					FileNamePrefix: "01:02:03.000-camName",
-					TotalLength:    3,
+					FilesOffset: []time.Duration{0},
+					Length:      3,
+					TotalLength: 3,
 				},
 			},
 		},
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &RecordConfig{
+					OutputDir:  outputPath,
+					Naming:     &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+					InputArgs:  map[string]string{},
+					OutputArgs: map[string]string{},
+				})
 			},
-			inputChResult: make(chan interface{}, 5),
+			inputChResult: make(chan RecordResult, 5),
 			inputRecord: &Record{
 				Stream:  filepath.Join(outputPath, "test_recording.mp4"),
 				Prefix:  "prefix",
@@ -119,45 +149,54 @@ func TestRecordDo(t *testing.T) {
 				Length:  3,
 				Burst:   2,
 			},
-			expectedResults: []interface{}{
+			expectedResults: []RecordResult{
 				&SingleRecordResult{
-					RecordRootDir:  "/tmp/recorder_tests",
-					Prefix:         "prefix",
-					RecordingDate:  "20-01-2023",
-					FileName:       "01:02:03.000-camName-001-002.mp4",
-					FilePath:       "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-002.mp4",
-					FileNamePrefix: "01:02:03.000-camName",
+					RecordRootDir: "/tmp/recorder_tests",
+					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
+					RecordingDate: "20-01-2023",
+					FileName:      "01:02:03.000-camName-001-002.mp4",
+					FilePath:      "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-002.mp4",
+					Source:        "/tmp/recorder_tests/test_recording.mp4",
 				},
 				&SingleRecordResult{
-					RecordRootDir:  "/tmp/recorder_tests",
-					Prefix:         "prefix",
-					RecordingDate:  "20-01-2023",
-					FileName:       "01:02:03.000-camName-002-002.mp4",
-					FilePath:       "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-002-002.mp4",
-					FileNamePrefix: "01:02:03.000-camName",
+					RecordRootDir: "/tmp/recorder_tests",
+					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
+					RecordingDate: "20-01-2023",
+					FileName:      "01:02:03.000-camName-002-002.mp4",
+					FilePath:      "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-002-002.mp4",
+					Source:        "/tmp/recorder_tests/test_recording.mp4",
 				},
 				&MultipleRecordResult{
 					RecordRootDir: "/tmp/recorder_tests",
 					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
 					RecordingDate: "20-01-2023",
 					FilesPath: []string{
 						"/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-002.mp4",
 						"/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-002-002.mp4",
 					},
-					FileNamePrefix: "01:02:03.000-camName",
-					TotalLength:    6,
+					FilesOffset: []time.Duration{0, time.Second},
+					Length:      3,
+					TotalLength: 6,
 				},
 			},
 		},
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "outputDir", outputPath)
-				ctx = context.WithValue(ctx, "ffmpegInputArgs", map[string]string{})
-				ctx = context.WithValue(ctx, "ffmpegOutputArgs", map[string]string{})
-				return ctx
+				return WithConfig(ctx, &RecordConfig{
+					OutputDir:  outputPath,
+					Naming:     &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+					InputArgs:  map[string]string{},
+					OutputArgs: map[string]string{},
+				})
 			},
-			inputChResult: make(chan interface{}, 5),
+			inputChResult: make(chan RecordResult, 5),
 			inputRecord: &Record{
 				Stream:  filepath.Join(outputPath, "test_recording.mp4"),
 				Prefix:  "prefix",
@@ -171,24 +210,29 @@ func TestRecordDo(t *testing.T) {
 					os.Remove(filepath.Join(outputPath, "test_recording.mp4"))
 				}()
 			},
-			expectedResults: []interface{}{
+			expectedResults: []RecordResult{
 				&SingleRecordResult{
-					RecordRootDir:  "/tmp/recorder_tests",
-					Prefix:         "prefix",
-					RecordingDate:  "20-01-2023",
-					FileName:       "01:02:03.000-camName-001-003.mp4",
-					FilePath:       "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-003.mp4",
-					FileNamePrefix: "01:02:03.000-camName",
+					RecordRootDir: "/tmp/recorder_tests",
+					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
+					RecordingDate: "20-01-2023",
+					FileName:      "01:02:03.000-camName-001-003.mp4",
+					FilePath:      "/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-003.mp4",
+					Source:        "/tmp/recorder_tests/test_recording.mp4",
 				},
 				&MultipleRecordResult{
 					RecordRootDir: "/tmp/recorder_tests",
 					Prefix:        "prefix",
+					CamName:       "camName",
+					StartTime:     recordStartTime,
 					RecordingDate: "20-01-2023",
 					FilesPath: []string{
 						"/tmp/recorder_tests/prefix/20-01-2023/01:02:03.000-camName-001-003.mp4",
 					},
-					FileNamePrefix: "01:02:03.000-camName",
-					TotalLength:    5,
+					FilesOffset: []time.Duration{0},
+					Length:      5,
+					TotalLength: 5,
 				},
 			},
 			expectedErr: fmt.Errorf("unable to record all bursts"),
@@ -229,11 +273,160 @@ func TestRecordDo(t *testing.T) {
 
 		for _, expectedResult := range test.expectedResults {
 			result := <-test.inputChResult
+			// ffmpeg output differs between versions.
+			if failure, ok := result.(*FailureResult); ok {
+				require.NotEmpty(t, failure.Error)
+				failure.Error = ""
+			}
 			require.Equal(t, expectedResult, result)
 		}
 	}
 }
 
+func TestRecordDoNamedStreams(t *testing.T) {
+	startTime := time.Date(2023, time.January, 20, 1, 2, 3, 4, time.UTC)
+	timeNow = func() time.Time {
+		return startTime
+	}
+	osMkdirAll = func(string, os.FileMode) error {
+		return nil
+	}
+	defer func() {
+		timeNow = time.Now
+		osMkdirAll = os.MkdirAll
+		recordPiece = ffmpegRecord
+	}()
+
+	var mu sync.Mutex
+	metadata := make(map[string]map[string]string)
+	recordPiece = func(stream, outputFile string, _, _ map[string]string, m map[string]string, _ int64, _ time.Duration, _ func(*job.Progress)) error {
+		mu.Lock()
+		defer mu.Unlock()
+		metadata[stream] = m
+		if stream == "rtsp://cam1/broken" {
+			return errors.New("mock error")
+		}
+		return nil
+	}
+
+	tests := []struct {
+		inputRecord      *Record
+		inputConfig      *RecordConfig
+		expectedErr      error
+		expectedFiles    []string
+		expectedMetadata map[string]string
+	}{
+		{
+			inputRecord: &Record{JobID: "job1", Prefix: "door", CamName: "cam1", Length: 2, Burst: 1},
+			inputConfig: &RecordConfig{
+				NamedStreams: map[string]map[string]string{"cam1": {"main": "rtsp://cam1/101", "sub": "rtsp://cam1/102"}},
+			},
+			expectedFiles: []string{
+				"/data/door/20-01-2023/01:02:03.000-cam1-main-001-001.mp4",
+				"/data/door/20-01-2023/01:02:03.000-cam1-sub-001-001.mp4",
+			},
+			expectedMetadata: map[string]string{"event_id": "job1", "stream": "sub"},
+		},
+		{
+			inputRecord: &Record{
+				JobID:        "job1",
+				EventID:      "event1",
+				Prefix:       "door",
+				CamName:      "cam1",
+				Length:       2,
+				Burst:        1,
+				NamedStreams: map[string]string{"sub": "rtsp://cam1/102", "main": "rtsp://cam1/broken"},
+			},
+			inputConfig: &RecordConfig{
+				Streams: map[string][]string{"cam1": {"rtsp://nvr/cam1"}},
+			},
+			expectedErr: errors.New("stream main: unable to record all bursts"),
+			expectedFiles: []string{
+				"/data/door/20-01-2023/01:02:03.000-cam1-sub-001-001.mp4",
+			},
+			expectedMetadata: map[string]string{"event_id": "event1", "stream": "sub"},
+		},
+	}
+
+	for _, test := range tests {
+		config := test.inputConfig
+		config.OutputDir = "/data"
+		config.Naming = &Naming{Record: DefaultRecordTemplate, Location: time.UTC}
+		chResult := make(chan RecordResult, 10)
+
+		err := test.inputRecord.Do(WithConfig(context.Background(), config), chResult)
+		if test.expectedErr != nil {
+			require.EqualError(t, err, test.expectedErr.Error())
+		} else {
+			require.Nil(t, err)
+		}
+		close(chResult)
+
+		var files []string
+		for result := range chResult {
+			if result, ok := result.(*SingleRecordResult); ok {
+				require.Equal(t, startTime, result.StartTime)
+				require.Equal(t, test.expectedMetadata["event_id"], result.EventID)
+				require.Equal(t, filepath.Base(result.FilePath), result.FileName)
+				files = append(files, result.FilePath)
+			}
+		}
+		slices.Sort(files)
+		require.Equal(t, test.expectedFiles, files)
+
+		m := metadata["rtsp://cam1/102"]
+		require.Equal(t, test.expectedMetadata["event_id"], m["event_id"])
+		require.Equal(t, test.expectedMetadata["stream"], m["stream"])
+		require.NotContains(t, metadata, "rtsp://nvr/cam1")
+	}
+}
+
+func TestRecordDoOffsets(t *testing.T) {
+	startTime := time.Date(2023, time.January, 20, 1, 2, 3, 4, time.UTC)
+	timeNow = func() time.Time {
+		return startTime
+	}
+	osMkdirAll = func(string, os.FileMode) error {
+		return nil
+	}
+	defer func() {
+		timeNow = time.Now
+		osMkdirAll = os.MkdirAll
+		recordPiece = ffmpegRecord
+	}()
+
+	recordPiece = func(_, outputFile string, _, _, _ map[string]string, _ int64, _ time.Duration, _ func(*job.Progress)) error {
+		if filepath.Base(outputFile) == "01:02:03.000-cam1-002-003.mp4" {
+			return errors.New("mock error")
+		}
+		return nil
+	}
+
+	chResult := make(chan RecordResult, 10)
+	config := &RecordConfig{
+		OutputDir: "/data",
+		Streams:   map[string][]string{"cam1": {"rtsp://cam1/main"}},
+		Naming:    &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+	}
+	err := (&Record{JobID: "job1", Prefix: "door", CamName: "cam1", Length: 3, Burst: 3}).Do(WithConfig(context.Background(), config), chResult)
+	require.EqualError(t, err, "unable to record all bursts")
+	close(chResult)
+
+	// Offset of failed burst is skipped, offsets stay aligned with recorded files.
+	var multiple *MultipleRecordResult
+	for result := range chResult {
+		if result, ok := result.(*MultipleRecordResult); ok {
+			multiple = result
+		}
+	}
+	require.NotNil(t, multiple)
+	require.Equal(t, []string{
+		"/data/door/20-01-2023/01:02:03.000-cam1-001-003.mp4",
+		"/data/door/20-01-2023/01:02:03.000-cam1-003-003.mp4",
+	}, multiple.FilesPath)
+	require.Equal(t, []time.Duration{0, 2 * time.Second}, multiple.FilesOffset)
+}
+
 func TestFFMEGRecord(t *testing.T) {
 	tests := []struct {
 		inputFFMPEGInputArgs  map[string]string
@@ -265,7 +458,11 @@ func TestFFMEGRecord(t *testing.T) {
 	require.Nil(t, err)
 
 	for _, test := range tests {
-		err = ffmpegRecord(filepath.Join(outputPath, "test_recording.mp4"), filepath.Join(outputPath, "test_output.mp4"), test.inputFFMPEGInputArgs, test.inputFFMPEGOutputArgs, 2)
+		err = ffmpegRecord(filepath.Join(outputPath, "test_recording.mp4"), filepath.Join(outputPath, "test_output.mp4"), test.inputFFMPEGInputArgs, test.inputFFMPEGOutputArgs, nil, 2, 0, nil)
+		var ffmpegErr *FFmpegError
+		if errors.As(err, &ffmpegErr) {
+			err = ffmpegErr.Err
+		}
 		if test.expectedErr != nil {
 			require.Equal(t, test.expectedErr.Error(), err.Error())
 		}
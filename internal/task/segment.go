@@ -0,0 +1,209 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"recorder/internal/job"
+
+	"github.com/google/uuid"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Burst modes.
+const (
+	// BurstModeOverlap records every burst with its own ffmpeg, bursts are overlapping.
+	BurstModeOverlap = "overlap"
+	// BurstModeSegment records all bursts with single ffmpeg segment muxer, bursts are cut on keyframes.
+	BurstModeSegment = "segment"
+)
+
+var (
+	segmentPollInterval = 500 * time.Millisecond
+
+	// mocks for tests.
+	recordSegmented = ffmpegSegment
+)
+
+// segment describes closed file of segment muxer.
+type segment struct {
+	File  string
+	Start float64 // Seconds from start of stream.
+}
+
+// recordSegments records all bursts with single ffmpeg, every burst is published as soon as its segment is closed.
+// Sources are tried in order until one of them records any segment.
+// Paths of recorded bursts are set in recorded, bursts don't overlap, so they are converted as-is.
+func (r *Record) recordSegments(ctx context.Context, chResult chan RecordResult, config *RecordConfig, container *Container, sources []string, outputArgs map[string]string, filesPath []string, startTime time.Time, unmasked bool, recorded []string) {
+	// Segments are written into hidden files, closed ones are renamed to paths from naming template.
+	dir := filepath.Dir(filesPath[0])
+	id := uuid.New().String()
+	pattern := filepath.Join(dir, fmt.Sprintf(".%s-%%03d.%s", id, container.Ext))
+	listPath := filepath.Join(dir, "."+id+".csv")
+	defer func() {
+		osRemove(listPath)
+		leftovers, _ := filepath.Glob(filepath.Join(dir, "."+id+"-*"))
+		for _, leftover := range leftovers {
+			osRemove(leftover)
+		}
+	}()
+
+	metadata := recordingMetadata(r.CamName, r.Prefix, startTime, r.Tags)
+	stall := time.Duration(config.StallTimeout) * time.Second
+	onProgress := jobProgress(ctx, r.JobID, "record", filesPath[0])
+
+	closed := 0
+	var err error
+	for i, source := range sources {
+		now := timeNow()
+		onSegment := func(s segment) {
+			index := closed
+			closed++
+			segmentPath := filepath.Join(dir, filepath.Base(s.File))
+			if index >= len(filesPath) {
+				osRemove(segmentPath)
+				return
+			}
+			filePath := filesPath[index]
+			status, err := r.checkBurst(config, container, filePath, osRename(segmentPath, filePath))
+			if r.reportBurst(ctx, chResult, config, filePath, startTime, status, redactURL(source), unmasked, now, err) {
+				recorded[index] = filePath
+			}
+		}
+
+		// Segment list of previous source can't be reused.
+		osRemove(listPath)
+		sourceMetadata := maps.Clone(metadata)
+		sourceMetadata["source"] = redactURL(source)
+
+		var input string
+		var inputArgs map[string]string
+		var release func()
+		input, inputArgs, release, err = r.input(config, source, len(sources) > 1)
+		if err == nil {
+			done := make(chan struct{})
+			watched := make(chan struct{})
+			go func() {
+				defer close(watched)
+				watchSegments(listPath, done, onSegment)
+			}()
+			err = recordSegmented(input, pattern, listPath, inputArgs, outputArgs, sourceMetadata, r.Length, r.Length*r.Burst, stall, onProgress)
+			close(done)
+			<-watched
+			release()
+		}
+		if err == nil || closed > 0 {
+			break
+		}
+		countSourceFailure(r.CamName, redactURL(source))
+		if i < len(sources)-1 {
+			log.Printf("source %s of %s failed, trying next one: %v", redactURL(source), r.CamName, err)
+		}
+	}
+
+	// Bursts which were not closed are reported as failed.
+	if err != nil {
+		for _, filePath := range filesPath[min(closed, len(filesPath)):] {
+			r.reportBurst(ctx, chResult, config, filePath, startTime, "", "", unmasked, startTime, err)
+		}
+	}
+}
+
+// watchSegments reports every segment closed by segment muxer, until done is closed.
+// Segments closed before done are reported after it.
+func watchSegments(listPath string, done <-chan struct{}, onSegment func(segment)) {
+	reported := 0
+	for {
+		finished := false
+		select {
+		case <-done:
+			finished = true
+		case <-time.After(segmentPollInterval):
+		}
+
+		segments := readSegmentList(listPath)
+		for _, s := range segments[min(reported, len(segments)):] {
+			onSegment(s)
+		}
+		reported = max(reported, len(segments))
+		if finished {
+			return
+		}
+	}
+}
+
+// readSegmentList returns segments listed in csv segment list, line which is being written is skipped.
+func readSegmentList(listPath string) []segment {
+	data, err := osReadFile(listPath)
+	if err != nil {
+		return nil
+	}
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		log.Printf("unable to read segment list %s: %v", listPath, err)
+		return nil
+	}
+	var segments []segment
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		start, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{File: record[0], Start: start})
+	}
+	return segments
+}
+
+// segmentOutputArgs returns ffmpeg output args of segment muxer writing segments of segmentLength seconds.
+// Muxer and its movflags are used for every segment. Re-encoded video gets keyframe at every cut.
+func segmentOutputArgs(outputKwArgs ffmpeg.KwArgs, listPath string, segmentLength int64) ffmpeg.KwArgs {
+	if format, ok := outputKwArgs["f"]; ok {
+		outputKwArgs["segment_format"] = format
+	}
+	if movflags, ok := outputKwArgs["movflags"]; ok {
+		outputKwArgs["segment_format_options"] = fmt.Sprintf("movflags=%v", movflags)
+		delete(outputKwArgs, "movflags")
+	}
+	if codec, ok := outputKwArgs["c:v"]; ok && codec != "copy" {
+		if _, ok := outputKwArgs["force_key_frames"]; !ok {
+			outputKwArgs["force_key_frames"] = fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentLength)
+		}
+	}
+	outputKwArgs["f"] = "segment"
+	outputKwArgs["segment_time"] = segmentLength
+	outputKwArgs["reset_timestamps"] = 1
+	outputKwArgs["segment_list"] = listPath
+	outputKwArgs["segment_list_type"] = "csv"
+	return outputKwArgs
+}
+
+// ffmpegSegment records length seconds of stream into segments of segmentLength seconds.
+// Closed segments are appended to listPath.
+func ffmpegSegment(stream, pattern, listPath string, inputArgs, outputArgs, metadata map[string]string, segmentLength, length int64, stall time.Duration, onProgress func(*job.Progress)) error {
+	inputKwArgs := ffmpeg.KwArgs{}
+	outputKwArgs := ffmpeg.KwArgs{"t": length}
+
+	for k, v := range inputArgs {
+		inputKwArgs[k] = v
+	}
+
+	for k, v := range outputArgs {
+		outputKwArgs[k] = v
+	}
+	addMetadata(outputKwArgs, pattern, metadata)
+
+	return runFFmpeg(ffmpeg.Input(stream, inputKwArgs).Output(pattern, segmentOutputArgs(outputKwArgs, listPath, segmentLength)),
+		time.Duration(length*int64(ffmpegRecordRatio))*time.Second, stall, onProgress)
+}
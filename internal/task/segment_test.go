@@ -0,0 +1,184 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"recorder/internal/job"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestRecordSegments(t *testing.T) {
+	startTime := time.Date(2023, time.January, 20, 1, 2, 3, 4, time.UTC)
+	timeNow = func() time.Time {
+		return startTime
+	}
+	segmentPollInterval = 10 * time.Millisecond
+	defer func() {
+		timeNow = time.Now
+		segmentPollInterval = 500 * time.Millisecond
+		recordSegmented = ffmpegSegment
+	}()
+
+	tests := []struct {
+		inputSegments   map[string][]float64
+		inputErr        map[string]error
+		inputSources    []string
+		expectedErr     error
+		expectedFiles   []string
+		expectedSources []string
+		expectedFailed  []string
+	}{
+		{
+			inputSources:    []string{"rtsp://cam1/main"},
+			inputSegments:   map[string][]float64{"rtsp://cam1/main": {1.5, 6.75, 11.5}},
+			expectedFiles:   []string{"01:02:03.000-cam1-001-003.mp4", "01:02:03.000-cam1-002-003.mp4", "01:02:03.000-cam1-003-003.mp4"},
+			expectedSources: []string{"rtsp://cam1/main"},
+		},
+		{
+			inputSources:    []string{"rtsp://cam1/main", "rtsp://cam1/sub"},
+			inputSegments:   map[string][]float64{"rtsp://cam1/sub": {0, 5}},
+			inputErr:        map[string]error{"rtsp://cam1/main": errors.New("mock error"), "rtsp://cam1/sub": errors.New("mock drop")},
+			expectedErr:     errors.New("unable to record all bursts"),
+			expectedFiles:   []string{"01:02:03.000-cam1-001-003.mp4", "01:02:03.000-cam1-002-003.mp4"},
+			expectedSources: []string{"rtsp://cam1/main", "rtsp://cam1/sub"},
+			expectedFailed:  []string{"01:02:03.000-cam1-003-003.mp4"},
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		var sources []string
+		recordSegmented = func(stream, pattern, listPath string, _, _, metadata map[string]string, segmentLength, length int64, _ time.Duration, _ func(*job.Progress)) error {
+			require.Equal(t, int64(5), segmentLength)
+			require.Equal(t, int64(15), length)
+			require.Equal(t, stream, metadata["source"])
+			sources = append(sources, stream)
+
+			var list strings.Builder
+			for i, start := range test.inputSegments[stream] {
+				segmentPath := fmt.Sprintf(pattern, i)
+				if err := os.WriteFile(segmentPath, []byte("segment"), 0644); err != nil {
+					return err
+				}
+				fmt.Fprintf(&list, "%s,%.6f,%.6f\n", filepath.Base(segmentPath), start, start+5)
+			}
+			// Segment which is not closed yet.
+			if err := os.WriteFile(fmt.Sprintf(pattern, len(test.inputSegments[stream])), []byte("segment"), 0644); err != nil {
+				return err
+			}
+			if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+				return err
+			}
+			return test.inputErr[stream]
+		}
+
+		record := &Record{CamName: "cam1", Prefix: "door", Length: 5, Burst: 3, Streams: test.inputSources}
+		config := &RecordConfig{
+			OutputDir: dir,
+			Naming:    &Naming{Record: DefaultRecordTemplate, Location: time.UTC},
+			BurstMode: BurstModeSegment,
+		}
+		chResult := make(chan RecordResult, 10)
+		err := record.Do(WithConfig(context.Background(), config), chResult)
+		require.Equal(t, test.expectedErr, err)
+		require.Equal(t, test.expectedSources, sources)
+		close(chResult)
+
+		var files, failed []string
+		var multiple *MultipleRecordResult
+		for result := range chResult {
+			switch result := result.(type) {
+			case *SingleRecordResult:
+				require.FileExists(t, result.FilePath)
+				files = append(files, result.FileName)
+			case *FailureResult:
+				failed = append(failed, filepath.Base(result.FilePath))
+			case *MultipleRecordResult:
+				multiple = result
+			}
+		}
+		require.Equal(t, test.expectedFiles, files)
+		require.Equal(t, test.expectedFailed, failed)
+		// Segments don't overlap, convert joins them as-is.
+		require.Nil(t, multiple.FilesOffset)
+
+		// Only renamed segments are kept.
+		entries, err := os.ReadDir(filepath.Join(dir, "door", "20-01-2023"))
+		require.Nil(t, err)
+		require.Len(t, entries, len(test.expectedFiles))
+	}
+}
+
+func TestReadSegmentList(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "list.csv")
+
+	tests := []struct {
+		inputList        string
+		expectedSegments []segment
+	}{
+		{
+			inputList: "",
+		},
+		{
+			inputList:        "a-000.mp4,0.000000,5.120000\n",
+			expectedSegments: []segment{{File: "a-000.mp4", Start: 0}},
+		},
+		{
+			inputList:        "a-000.mp4,0.000000,5.120000\na-001.mp4,5.120000,10.000000\na-002.mp4,10.0",
+			expectedSegments: []segment{{File: "a-000.mp4", Start: 0}, {File: "a-001.mp4", Start: 5.12}},
+		},
+	}
+
+	for _, test := range tests {
+		require.Nil(t, os.WriteFile(listPath, []byte(test.inputList), 0644))
+		require.Equal(t, test.expectedSegments, readSegmentList(listPath))
+	}
+	require.Nil(t, readSegmentList(filepath.Join(t.TempDir(), "missing.csv")))
+}
+
+func TestSegmentOutputArgs(t *testing.T) {
+	tests := []struct {
+		inputArgs    ffmpeg.KwArgs
+		expectedArgs ffmpeg.KwArgs
+	}{
+		{
+			inputArgs: ffmpeg.KwArgs{"c:v": "copy", "f": "mp4", "movflags": "use_metadata_tags"},
+			expectedArgs: ffmpeg.KwArgs{
+				"c:v":                    "copy",
+				"f":                      "segment",
+				"segment_format":         "mp4",
+				"segment_format_options": "movflags=use_metadata_tags",
+				"segment_time":           int64(10),
+				"reset_timestamps":       1,
+				"segment_list":           "/data/list.csv",
+				"segment_list_type":      "csv",
+			},
+		},
+		{
+			inputArgs: ffmpeg.KwArgs{"c:v": "h264", "f": "matroska"},
+			expectedArgs: ffmpeg.KwArgs{
+				"c:v":               "h264",
+				"force_key_frames":  "expr:gte(t,n_forced*10)",
+				"f":                 "segment",
+				"segment_format":    "matroska",
+				"segment_time":      int64(10),
+				"reset_timestamps":  1,
+				"segment_list":      "/data/list.csv",
+				"segment_list_type": "csv",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedArgs, segmentOutputArgs(test.inputArgs, "/data/list.csv", 10))
+	}
+}
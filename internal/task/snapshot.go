@@ -0,0 +1,217 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	// ErrUnknownCamera is returned for camera without configured streams.
+	ErrUnknownCamera = errors.New("unknown camera")
+
+	// mocks for tests.
+	grabSnapshot = ffmpegSnapshot
+)
+
+// Snapshots grabs single frames of camera streams.
+// Frames are cached, so dashboards polling the same camera don't open new connection on every request.
+type Snapshots struct {
+	InputArgs       map[string]string
+	Streams         map[string][]string          // Streams of every camera, tried in order.
+	NamedStreams    map[string]map[string]string // Used when camera has no Streams, by stream name.
+	FailoverTimeout int                          // Socket timeout of rtsp streams in seconds, when there is another stream to try.
+	Ingest          *Ingest                      // Shared connections of recordings, network streams are grabbed from it when set.
+	Cache           int                          // Seconds snapshot is served from cache, 0 disables cache.
+	Concurrency     int                          // Frames of single camera grabbed at once.
+	Timeout         int                          // Seconds before ffmpeg is killed.
+	Width           int                          // Width of snapshot, 0 keeps video width.
+	Masks           map[string][]Mask            // Privacy masks by camera, always applied.
+	OutputDir       string                       // Record dir, saved snapshots are stored there.
+	Prefix          string                       // Prefix of saved snapshots.
+	Naming          *Naming
+
+	mu      sync.Mutex
+	cameras map[string]*snapshotCamera
+}
+
+// snapshotCamera keeps last snapshot of camera and limits grabs running at once.
+type snapshotCamera struct {
+	slots chan struct{}
+
+	mu   sync.Mutex
+	last *Snapshot
+}
+
+// Snapshot describes single JPEG frame of camera.
+type Snapshot struct {
+	CamName string
+	Image   []byte
+	Time    time.Time
+	Cached  bool
+}
+
+// Get returns current frame of camera, from cache when it is fresh enough.
+// When concurrency limit is reached, request waits for running grab and gets its frame.
+func (s *Snapshots) Get(ctx context.Context, camName string) (*Snapshot, error) {
+	sources := s.sources(camName)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%w %s", ErrUnknownCamera, camName)
+	}
+	camera := s.camera(camName)
+	if snapshot := camera.cached(s.Cache); snapshot != nil {
+		return snapshot, nil
+	}
+
+	select {
+	case camera.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-camera.slots }()
+	// Frame could be grabbed while waiting.
+	if snapshot := camera.cached(s.Cache); snapshot != nil {
+		return snapshot, nil
+	}
+
+	now := timeNow()
+	timeout := time.Duration(s.Timeout) * time.Second
+	masks := maskFilter(s.Masks[camName])
+	var err error
+	for i, source := range sources {
+		var image []byte
+		image, err = s.grab(ctx, source, len(sources) > 1, masks, timeout)
+		if err == nil {
+			snapshot := &Snapshot{CamName: camName, Image: image, Time: now}
+			camera.store(snapshot)
+			return snapshot, nil
+		}
+		if i < len(sources)-1 {
+			log.Printf("source %s of %s failed, trying next one: %v", redactURL(source), camName, err)
+		}
+	}
+	log.Printf("unable to grab snapshot of %s: %v", camName, err)
+	return nil, err
+}
+
+// grab grabs frame of source with input args of recordings, so it shares their ingest connection.
+func (s *Snapshots) grab(ctx context.Context, source string, failover bool, masks string, timeout time.Duration) ([]byte, error) {
+	config := &RecordConfig{InputArgs: s.InputArgs, FailoverTimeout: s.FailoverTimeout}
+	input, inputArgs, release, err := ingestInput(s.Ingest, source, failoverInputArgs(config, source, failover))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return grabSnapshot(ctx, input, inputArgs, masks, s.Width, timeout)
+}
+
+// Save stores snapshot in record dir under Prefix, it returns path of stored file.
+func (s *Snapshots) Save(snapshot *Snapshot) (string, error) {
+	filePath := filepath.Join(s.OutputDir, s.Naming.Path(s.Naming.Snapshot, &NameVars{
+		Prefix:  s.Prefix,
+		CamName: snapshot.CamName,
+		Start:   snapshot.Time,
+		Ext:     "jpg",
+	}))
+	if err := osMkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		log.Printf("unable to create %s: %v", filepath.Dir(filePath), err)
+		return "", err
+	}
+	if err := osWriteFile(filePath, snapshot.Image, 0644); err != nil {
+		log.Printf("unable to save snapshot %s: %v", filePath, err)
+		return "", err
+	}
+	return filePath, nil
+}
+
+// sources returns streams of camera, named streams are tried in order of their names.
+func (s *Snapshots) sources(camName string) []string {
+	if streams := s.Streams[camName]; len(streams) > 0 {
+		return streams
+	}
+	named := s.NamedStreams[camName]
+	var sources []string
+	for _, name := range slices.Sorted(maps.Keys(named)) {
+		sources = append(sources, named[name])
+	}
+	return sources
+}
+
+// camera returns state of camera, it is created on first use.
+func (s *Snapshots) camera(camName string) *snapshotCamera {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cameras == nil {
+		s.cameras = make(map[string]*snapshotCamera)
+	}
+	camera, ok := s.cameras[camName]
+	if !ok {
+		camera = &snapshotCamera{slots: make(chan struct{}, max(s.Concurrency, 1))}
+		s.cameras[camName] = camera
+	}
+	return camera
+}
+
+// cached returns last snapshot, when it isn't older than cache seconds.
+func (c *snapshotCamera) cached(cache int) *Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last == nil || timeNow().Sub(c.last.Time) >= time.Duration(cache)*time.Second {
+		return nil
+	}
+	snapshot := *c.last
+	snapshot.Cached = true
+	return &snapshot
+}
+
+func (c *snapshotCamera) store(snapshot *Snapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last = snapshot
+}
+
+// ffmpegSnapshot grabs single frame of stream as JPEG, ffmpeg is killed after timeout.
+func ffmpegSnapshot(ctx context.Context, stream string, inputArgs map[string]string, masks string, width int, timeout time.Duration) ([]byte, error) {
+	inputKwArgs := ffmpeg.KwArgs{}
+	for k, v := range inputArgs {
+		inputKwArgs[k] = v
+	}
+	outputKwArgs := ffmpeg.KwArgs{"frames:v": 1, "q:v": 3, "c:v": "mjpeg", "f": "image2"}
+	var filters []string
+	if masks != "" {
+		filters = append(filters, masks)
+	}
+	if width > 0 {
+		filters = append(filters, fmt.Sprintf("scale=%d:-2", width))
+	}
+	if len(filters) > 0 {
+		outputKwArgs["vf"] = strings.Join(filters, ",")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	image := &bytes.Buffer{}
+	stderr := newRingBuffer(stderrBufferSize)
+	s := ffmpeg.Input(stream, inputKwArgs).Output("pipe:", outputKwArgs)
+	s.Context = ctx
+	if err := s.WithOutput(image).WithErrorOutput(stderr).Run(); err != nil {
+		return nil, &FFmpegError{Class: classifyStderr(stderr.String(), ctx.Err() != nil), Stderr: stderr.String(), Err: err}
+	}
+	if image.Len() == 0 {
+		return nil, fmt.Errorf("stream %s returned no frame", redactURL(stream))
+	}
+	return image.Bytes(), nil
+}
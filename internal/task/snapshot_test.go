@@ -0,0 +1,213 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotsGet(t *testing.T) {
+	now := time.Date(2023, time.January, 20, 1, 2, 3, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+		grabSnapshot = ffmpegSnapshot
+	}()
+
+	var grabs atomic.Int64
+	grabSnapshot = func(_ context.Context, stream string, inputArgs map[string]string, masks string, width int, timeout time.Duration) ([]byte, error) {
+		require.Equal(t, map[string]string{"rtsp_transport": "tcp"}, inputArgs)
+		if strings.HasPrefix(stream, "rtsp://cam1/") {
+			require.Equal(t, "drawbox=x=0:y=0:w=10:h=10:color=black:t=fill", masks)
+		} else {
+			require.Empty(t, masks)
+		}
+		require.Equal(t, 640, width)
+		require.Equal(t, 10*time.Second, timeout)
+		grabs.Add(1)
+		if stream == "rtsp://cam1/main" || stream == "rtsp://cam3/main" {
+			return nil, errors.New("mock error")
+		}
+		return []byte(stream), nil
+	}
+
+	snapshots := &Snapshots{
+		InputArgs:    map[string]string{"rtsp_transport": "tcp"},
+		Streams:      map[string][]string{"cam1": {"rtsp://cam1/main", "rtsp://cam1/sub"}, "cam3": {"rtsp://cam3/main"}},
+		NamedStreams: map[string]map[string]string{"cam2": {"wide": "rtsp://cam2/wide", "main": "rtsp://cam2/main"}},
+		Cache:        5,
+		Concurrency:  1,
+		Timeout:      10,
+		Width:        640,
+		Masks:        map[string][]Mask{"cam1": {{Type: MaskBlack, Rect: []int{0, 0, 10, 10}}}},
+	}
+
+	tests := []struct {
+		inputCamName     string
+		inputTime        time.Time
+		expectedErr      string
+		expectedSnapshot *Snapshot
+		expectedGrabs    int64
+	}{
+		{
+			inputCamName:  "cam4",
+			inputTime:     now,
+			expectedErr:   "unknown camera cam4",
+			expectedGrabs: 0,
+		},
+		{
+			inputCamName:  "cam3",
+			inputTime:     now,
+			expectedErr:   "mock error",
+			expectedGrabs: 1,
+		},
+		{
+			inputCamName:     "cam1",
+			inputTime:        now,
+			expectedSnapshot: &Snapshot{CamName: "cam1", Image: []byte("rtsp://cam1/sub"), Time: now},
+			expectedGrabs:    2,
+		},
+		{
+			inputCamName:     "cam1",
+			inputTime:        now.Add(4 * time.Second),
+			expectedSnapshot: &Snapshot{CamName: "cam1", Image: []byte("rtsp://cam1/sub"), Time: now, Cached: true},
+			expectedGrabs:    0,
+		},
+		{
+			inputCamName:     "cam1",
+			inputTime:        now.Add(5 * time.Second),
+			expectedSnapshot: &Snapshot{CamName: "cam1", Image: []byte("rtsp://cam1/sub"), Time: now.Add(5 * time.Second)},
+			expectedGrabs:    2,
+		},
+		{
+			inputCamName:     "cam2",
+			inputTime:        now,
+			expectedSnapshot: &Snapshot{CamName: "cam2", Image: []byte("rtsp://cam2/main"), Time: now},
+			expectedGrabs:    1,
+		},
+	}
+
+	for _, test := range tests {
+		grabs.Store(0)
+		inputTime := test.inputTime
+		timeNow = func() time.Time { return inputTime }
+
+		snapshot, err := snapshots.Get(context.Background(), test.inputCamName)
+		require.Equal(t, test.expectedGrabs, grabs.Load())
+		if test.expectedErr != "" {
+			require.EqualError(t, err, test.expectedErr)
+			continue
+		}
+		require.Nil(t, err)
+		require.Equal(t, test.expectedSnapshot, snapshot)
+	}
+}
+
+func TestSnapshotsGetIngest(t *testing.T) {
+	defer func() {
+		grabSnapshot = ffmpegSnapshot
+		ingestStream = ffmpegIngest
+	}()
+	ingestStream = func(ctx context.Context, source, playlist string, inputArgs map[string]string, _, _ int, _ time.Duration) error {
+		require.Equal(t, "rtsp://cam5/main", source)
+		require.Equal(t, map[string]string{"rtsp_transport": "tcp"}, inputArgs)
+		if err := os.WriteFile(playlist, []byte("#EXTM3U"), 0644); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	}
+	grabSnapshot = func(_ context.Context, stream string, inputArgs map[string]string, _ string, _ int, _ time.Duration) ([]byte, error) {
+		require.Equal(t, "index.m3u8", filepath.Base(stream))
+		require.Equal(t, ingestInputArgs, inputArgs)
+		return []byte(stream), nil
+	}
+
+	ingest := &Ingest{Dir: t.TempDir(), ReadyTimeout: 1}
+	defer ingest.Close()
+	snapshots := &Snapshots{
+		InputArgs:   map[string]string{"rtsp_transport": "tcp"},
+		Streams:     map[string][]string{"cam5": {"rtsp://cam5/main"}},
+		Ingest:      ingest,
+		Concurrency: 1,
+		Timeout:     10,
+	}
+
+	// Snapshot shares connection of recording.
+	playlist, release, err := ingest.Acquire("rtsp://cam5/main", map[string]string{"rtsp_transport": "tcp"})
+	require.Nil(t, err)
+	defer release()
+	snapshot, err := snapshots.Get(context.Background(), "cam5")
+	require.Nil(t, err)
+	require.Equal(t, playlist, string(snapshot.Image))
+	require.Equal(t, IngestStats{Consumers: 1, Connections: 1}, Ingests()["rtsp://cam5/main"])
+}
+
+func TestSnapshotsGetConcurrency(t *testing.T) {
+	defer func() {
+		grabSnapshot = ffmpegSnapshot
+	}()
+
+	var grabs atomic.Int64
+	release := make(chan struct{})
+	grabSnapshot = func(context.Context, string, map[string]string, string, int, time.Duration) ([]byte, error) {
+		grabs.Add(1)
+		<-release
+		return []byte("image"), nil
+	}
+
+	snapshots := &Snapshots{Streams: map[string][]string{"cam1": {"rtsp://cam1/main"}}, Cache: 5, Concurrency: 1}
+
+	// Requests waiting for running grab get its frame.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snapshot, err := snapshots.Get(context.Background(), "cam1")
+			require.Nil(t, err)
+			require.Equal(t, []byte("image"), snapshot.Image)
+		}()
+	}
+	require.Eventually(t, func() bool { return grabs.Load() == 1 }, time.Second, 10*time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int64(1), grabs.Load())
+
+	// Request waiting for free slot gives up with its context.
+	snapshots.Cache = 0
+	camera := snapshots.camera("cam1")
+	camera.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := snapshots.Get(ctx, "cam1")
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestSnapshotsSave(t *testing.T) {
+	dir := t.TempDir()
+	snapshots := &Snapshots{
+		OutputDir: dir,
+		Prefix:    "snapshot",
+		Naming:    &Naming{Snapshot: DefaultSnapshotTemplate, Location: time.UTC},
+	}
+
+	filePath, err := snapshots.Save(&Snapshot{
+		CamName: "cam1",
+		Image:   []byte("image"),
+		Time:    time.Date(2023, time.January, 20, 1, 2, 3, 0, time.UTC),
+	})
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "snapshot", "20-01-2023", "01:02:03.000-cam1.jpg"), filePath)
+	image, err := os.ReadFile(filePath)
+	require.Nil(t, err)
+	require.Equal(t, []byte("image"), image)
+}
@@ -0,0 +1,191 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"recorder/internal/job"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var (
+	ffmpegThumbnailTimeout = 30 * time.Second
+)
+
+// Thumbnailable is implemented by results with video which should get thumbnail.
+type Thumbnailable interface {
+	ThumbnailTask() *Thumbnail
+}
+
+// Thumbnail creates poster image (and optionally evenly spaced frames) for video.
+// Images are stored next to the video.
+type Thumbnail struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	Artifact      string
+	SkipUpload    bool
+	Unmasked      bool
+	EventID       string
+	StreamName    string
+}
+
+// ThumbnailResult is published for every created image.
+type ThumbnailResult struct {
+	JobID         string
+	Prefix        string
+	CamName       string
+	StartTime     time.Time
+	RecordingDate string
+	FileName      string
+	FilePath      string
+	Artifact      string
+	SkipUpload    bool
+	Unmasked      bool
+	EventID       string
+	StreamName    string
+}
+
+// UploadTask returns task which uploads image, with the same policy as video.
+func (r *ThumbnailResult) UploadTask() *Upload {
+	if r.SkipUpload {
+		return nil
+	}
+	return &Upload{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      r.Artifact,
+		Unmasked:      r.Unmasked,
+	}
+}
+
+// ThumbnailTask returns task which creates thumbnail for recorded burst.
+func (r *SingleRecordResult) ThumbnailTask() *Thumbnail {
+	return &Thumbnail{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactBursts,
+		Unmasked:      r.Unmasked,
+	}
+}
+
+// ThumbnailTask returns task which creates thumbnail for converted recording.
+func (r *ConvertResult) ThumbnailTask() *Thumbnail {
+	return &Thumbnail{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      ArtifactConverted,
+		SkipUpload:    r.SkipUpload,
+	}
+}
+
+func (r *Thumbnail) Do(ctx context.Context, chResult chan *ThumbnailResult) error {
+	config, err := ConfigFromContext[ThumbnailConfig](ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	probeResult, err := probe(r.FilePath)
+	if err != nil {
+		log.Printf("unable to probe %s: %v", r.FilePath, err)
+		return err
+	}
+
+	// /data/prefix/20-02-2023/07:36:36.178-cam1-001-003
+	basePath := strings.TrimSuffix(r.FilePath, filepath.Ext(r.FilePath))
+	imagesPath := []string{basePath + ".jpg"}
+	positions := []float64{posterPosition(config.Offset, probeResult.Duration())}
+	for i, position := range framePositions(config.Frames, probeResult.Duration()) {
+		imagesPath = append(imagesPath, fmt.Sprintf("%s-%02d.jpg", basePath, i+1))
+		positions = append(positions, position)
+	}
+
+	for i, imagePath := range imagesPath {
+		if err := ffmpegThumbnail(r.FilePath, imagePath, positions[i], config.Width); err != nil {
+			log.Printf("unable to create thumbnail %s: %v", imagePath, err)
+			countFFmpegError("thumbnail", err)
+			job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{
+				Type:       "thumbnail",
+				FilePath:   imagePath,
+				Status:     StatusFailed,
+				Error:      err.Error(),
+				ErrorClass: errorClass(err),
+				Stream:     r.StreamName,
+			})
+			return err
+		}
+		job.FromContext(ctx).AddArtifact(r.JobID, &job.Artifact{Type: "thumbnail", FilePath: imagePath})
+		chResult <- &ThumbnailResult{
+			JobID:         r.JobID,
+			EventID:       r.EventID,
+			StreamName:    r.StreamName,
+			Prefix:        r.Prefix,
+			CamName:       r.CamName,
+			StartTime:     r.StartTime,
+			RecordingDate: r.RecordingDate,
+			FileName:      filepath.Base(imagePath),
+			FilePath:      imagePath,
+			Artifact:      r.Artifact,
+			SkipUpload:    r.SkipUpload,
+			Unmasked:      r.Unmasked,
+		}
+	}
+	log.Printf("created %d thumbnails for %s (took:%.2fs)", len(imagesPath), r.FileName, time.Since(now).Seconds())
+
+	return nil
+}
+
+// posterPosition returns poster position in seconds, it can't exceed middle of the video.
+func posterPosition(offset, duration float64) float64 {
+	return min(offset, duration/2)
+}
+
+// framePositions returns positions of n evenly spaced frames in seconds.
+func framePositions(n int, duration float64) []float64 {
+	var positions []float64
+	for i := 0; i < n; i++ {
+		positions = append(positions, duration*(float64(i)+0.5)/float64(n))
+	}
+	return positions
+}
+
+func ffmpegThumbnail(inputFile, outputFile string, position float64, width int) error {
+	outputKwArgs := ffmpeg.KwArgs{"frames:v": 1, "q:v": 3}
+	if width > 0 {
+		outputKwArgs["vf"] = fmt.Sprintf("scale=%d:-2", width)
+	}
+
+	return runFFmpeg(ffmpeg.Input(inputFile, ffmpeg.KwArgs{"ss": fmt.Sprintf("%.3f", position)}).Output(outputFile, outputKwArgs).OverWriteOutput(),
+		ffmpegThumbnailTimeout, 0, nil)
+}
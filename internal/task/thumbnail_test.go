@@ -0,0 +1,158 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestThumbnailDo(t *testing.T) {
+	tests := []struct {
+		inputConfig     *ThumbnailConfig
+		inputThumbnail  *Thumbnail
+		mockFFMPEGProbe func(string, ...ffmpeg.KwArgs) (string, error)
+		expectedErr     error
+		expectedResults []*ThumbnailResult
+	}{
+		{
+			inputConfig: &ThumbnailConfig{Offset: 1, Width: 160},
+			inputThumbnail: &Thumbnail{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactBursts,
+			},
+			mockFFMPEGProbe: func(string, ...ffmpeg.KwArgs) (string, error) {
+				return "", fmt.Errorf("mock error")
+			},
+			expectedErr: fmt.Errorf("mock error"),
+		},
+		{
+			inputConfig: &ThumbnailConfig{Offset: 1, Width: 160},
+			inputThumbnail: &Thumbnail{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactBursts,
+			},
+			expectedResults: []*ThumbnailResult{
+				{
+					Prefix:        "prefix",
+					RecordingDate: "28-01-2023",
+					FileName:      "test_recording.jpg",
+					FilePath:      filepath.Join(outputPath, "test_recording.jpg"),
+					Artifact:      ArtifactBursts,
+				},
+			},
+		},
+		{
+			inputConfig: &ThumbnailConfig{Offset: 1, Frames: 2},
+			inputThumbnail: &Thumbnail{
+				Prefix:        "prefix",
+				RecordingDate: "28-01-2023",
+				FileName:      "test_recording.mp4",
+				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
+				Artifact:      ArtifactConverted,
+				SkipUpload:    true,
+			},
+			expectedResults: []*ThumbnailResult{
+				{
+					Prefix:        "prefix",
+					RecordingDate: "28-01-2023",
+					FileName:      "test_recording.jpg",
+					FilePath:      filepath.Join(outputPath, "test_recording.jpg"),
+					Artifact:      ArtifactConverted,
+					SkipUpload:    true,
+				},
+				{
+					Prefix:        "prefix",
+					RecordingDate: "28-01-2023",
+					FileName:      "test_recording-01.jpg",
+					FilePath:      filepath.Join(outputPath, "test_recording-01.jpg"),
+					Artifact:      ArtifactConverted,
+					SkipUpload:    true,
+				},
+				{
+					Prefix:        "prefix",
+					RecordingDate: "28-01-2023",
+					FileName:      "test_recording-02.jpg",
+					FilePath:      filepath.Join(outputPath, "test_recording-02.jpg"),
+					Artifact:      ArtifactConverted,
+					SkipUpload:    true,
+				},
+			},
+		},
+	}
+
+	os.RemoveAll(outputPath)
+	err := os.Mkdir(outputPath, os.ModePerm)
+	require.Nil(t, err)
+	defer os.RemoveAll(outputPath)
+
+	err = createTestVideo(filepath.Join(outputPath, "test_recording.mp4"))
+	require.Nil(t, err)
+
+	for _, test := range tests {
+		ffmpegProbe = ffmpeg.Probe
+		if test.mockFFMPEGProbe != nil {
+			ffmpegProbe = test.mockFFMPEGProbe
+			defer func() {
+				ffmpegProbe = ffmpeg.Probe
+			}()
+		}
+
+		chResult := make(chan *ThumbnailResult, 5)
+		ctx := WithConfig(context.Background(), test.inputConfig)
+
+		err := test.inputThumbnail.Do(ctx, chResult)
+		require.Equal(t, test.expectedErr, err)
+
+		require.Equal(t, len(test.expectedResults), len(chResult))
+		for _, expectedResult := range test.expectedResults {
+			result := <-chResult
+			require.Equal(t, expectedResult, result)
+			_, err := os.Stat(result.FilePath)
+			require.Nil(t, err)
+		}
+	}
+}
+
+func TestFramePositions(t *testing.T) {
+	tests := []struct {
+		inputFrames       int
+		inputDuration     float64
+		expectedPositions []float64
+	}{
+		{
+			inputFrames:   0,
+			inputDuration: 10,
+		},
+		{
+			inputFrames:       1,
+			inputDuration:     10,
+			expectedPositions: []float64{5},
+		},
+		{
+			inputFrames:       4,
+			inputDuration:     20,
+			expectedPositions: []float64{2.5, 7.5, 12.5, 17.5},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedPositions, framePositions(test.inputFrames, test.inputDuration))
+	}
+}
+
+func TestPosterPosition(t *testing.T) {
+	require.Equal(t, float64(1), posterPosition(1, 10))
+	require.Equal(t, float64(0.5), posterPosition(1, 1))
+	require.Equal(t, float64(0), posterPosition(1, 0))
+}
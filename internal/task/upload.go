@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -20,34 +21,87 @@ var (
 	ioCopy = io.Copy
 )
 
+const (
+	// ArtifactBursts describes recorded bursts.
+	ArtifactBursts = "bursts"
+	// ArtifactConverted describes converted recordings.
+	ArtifactConverted = "converted"
+)
+
 type Upload struct {
+	JobID         string
 	Prefix        string
+	CamName       string
+	StartTime     time.Time
 	RecordingDate string
 	FileName      string
 	FilePath      string
+	Artifact      string
+	Unmasked      bool
 	NoError       int
 	LastError     time.Time
+	EventID       string
+	StreamName    string
 }
 
+// Uploadable is implemented by results which can be uploaded to remote server.
+type Uploadable interface {
+	UploadTask() *Upload
+}
+
+// UploadResult is published only when upload fails, it is used to retry upload.
 type UploadResult struct {
+	JobID         string
 	Prefix        string
+	CamName       string
+	StartTime     time.Time
 	RecordingDate string
 	FileName      string
 	FilePath      string
+	Artifact      string
+	Unmasked      bool
 	NoError       int
 	LastError     time.Time
+	EventID       string
+	StreamName    string
 }
 
-func (r *Upload) retry(ctx context.Context, chResult chan interface{}, onlyRetry bool) {
+// UploadTask returns task which retries failed upload.
+func (r *UploadResult) UploadTask() *Upload {
+	return &Upload{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
+		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
+		RecordingDate: r.RecordingDate,
+		FileName:      r.FileName,
+		FilePath:      r.FilePath,
+		Artifact:      r.Artifact,
+		Unmasked:      r.Unmasked,
+		NoError:       r.NoError,
+		LastError:     r.LastError,
+	}
+}
+
+func (r *Upload) retry(config *UploadConfig, chResult chan *UploadResult, onlyRetry bool) {
 	result := &UploadResult{
+		JobID:         r.JobID,
+		EventID:       r.EventID,
+		StreamName:    r.StreamName,
 		Prefix:        r.Prefix,
+		CamName:       r.CamName,
+		StartTime:     r.StartTime,
 		RecordingDate: r.RecordingDate,
 		FileName:      r.FileName,
 		FilePath:      r.FilePath,
+		Artifact:      r.Artifact,
+		Unmasked:      r.Unmasked,
 		NoError:       r.NoError,
 		LastError:     r.LastError,
 	}
-	if !onlyRetry && r.NoError < ctx.Value("maxError").(int)-1 {
+	if !onlyRetry && r.NoError < config.MaxError-1 {
 		result.NoError++
 		result.LastError = timeNow()
 	}
@@ -55,41 +109,55 @@ func (r *Upload) retry(ctx context.Context, chResult chan interface{}, onlyRetry
 	chResult <- result
 }
 
-func (r *Upload) Do(ctx context.Context, chResult chan interface{}) error {
+func (r *Upload) Do(ctx context.Context, chResult chan *UploadResult) error {
+	config, err := ConfigFromContext[UploadConfig](ctx)
+	if err != nil {
+		return err
+	}
+
 	if time.Since(r.LastError) < time.Duration(r.NoError)*time.Duration(errorBackoffSecond)*time.Second {
 		time.Sleep(2 * time.Second)
-		r.retry(ctx, chResult, true)
+		r.retry(config, chResult, true)
 		return nil
 	}
 
-	sshKey, err := readSSHAuthKey(ctx.Value("sshKey").(string))
+	sshKey, err := readSSHAuthKey(config.SSHKey)
 	if err != nil {
 		log.Printf("unable to read ssh private key: %v", err)
-		r.retry(ctx, chResult, false)
+		r.retry(config, chResult, false)
 		return err
 	}
 
 	sshConfig := &ssh.ClientConfig{
-		User: ctx.Value("sshUser").(string),
+		User: config.SSHUser,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(sshKey),
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Duration(ctx.Value("timeout").(int)) * time.Second,
+		Timeout:         time.Duration(config.Timeout) * time.Second,
 	}
-	sshClient, err := ssh.Dial("tcp", ctx.Value("sshServer").(string), sshConfig)
+	sshClient, err := ssh.Dial("tcp", config.SSHServer, sshConfig)
 	if err != nil {
 		log.Printf("unable to connect to ssh server: %v", err)
-		r.retry(ctx, chResult, false)
+		r.retry(config, chResult, false)
 		return err
 	}
 	defer sshClient.Close()
 
 	now := timeNow()
-	dirPath := filepath.Join(sftpRootDirectory, r.Prefix, r.RecordingDate)
-	if err := sftpUpload(sshClient, r.FilePath, dirPath, r.FileName); err != nil {
+	// data/prefix/20-02-2023/07:36:36.178-cam1-001-003.mp4
+	remotePath := filepath.Join(sftpRootDirectory, config.Naming.Path(config.Naming.Remote, &NameVars{
+		Prefix:  r.Prefix,
+		CamName: r.CamName,
+		Start:   r.StartTime,
+		Ext:     strings.TrimPrefix(filepath.Ext(r.FileName), "."),
+		File:    r.FileName,
+		Stream:  r.StreamName,
+		Event:   r.EventID,
+	}))
+	if err := sftpUpload(sshClient, r.FilePath, filepath.Dir(remotePath), filepath.Base(remotePath)); err != nil {
 		log.Printf("unable to upload %s: %v", r.FileName, err)
-		r.retry(ctx, chResult, false)
+		r.retry(config, chResult, false)
 		return err
 	}
 	log.Printf("uploaded %s (errors:%d; took:%.2fs)", r.FileName, r.NoError, time.Since(now).Seconds())
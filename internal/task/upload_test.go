@@ -38,15 +38,14 @@ func TestUploadRetry(t *testing.T) {
 
 	tests := []struct {
 		inputUpload    *Upload
-		inputCtxFunc   func() context.Context
+		inputConfig    *UploadConfig
 		inputOnlyRetry bool
 		expectedResult *UploadResult
 	}{
 		{
-			inputCtxFunc: func() context.Context {
-				ctx := context.Background()
-				ctx = context.WithValue(ctx, "maxError", 30)
-				return ctx
+			inputConfig: &UploadConfig{
+				MaxError: 30,
+				Naming:   &Naming{Remote: DefaultRemoteTemplate},
 			},
 			inputUpload: &Upload{
 				Prefix:        "prefix",
@@ -67,10 +66,9 @@ func TestUploadRetry(t *testing.T) {
 			},
 		},
 		{
-			inputCtxFunc: func() context.Context {
-				ctx := context.Background()
-				ctx = context.WithValue(ctx, "maxError", 30)
-				return ctx
+			inputConfig: &UploadConfig{
+				MaxError: 30,
+				Naming:   &Naming{Remote: DefaultRemoteTemplate},
 			},
 			inputUpload: &Upload{
 				Prefix:        "prefix",
@@ -91,10 +89,9 @@ func TestUploadRetry(t *testing.T) {
 			},
 		},
 		{
-			inputCtxFunc: func() context.Context {
-				ctx := context.Background()
-				ctx = context.WithValue(ctx, "maxError", 30)
-				return ctx
+			inputConfig: &UploadConfig{
+				MaxError: 30,
+				Naming:   &Naming{Remote: DefaultRemoteTemplate},
 			},
 			inputUpload: &Upload{
 				Prefix:        "prefix",
@@ -115,10 +112,9 @@ func TestUploadRetry(t *testing.T) {
 			},
 		},
 		{
-			inputCtxFunc: func() context.Context {
-				ctx := context.Background()
-				ctx = context.WithValue(ctx, "maxError", 30)
-				return ctx
+			inputConfig: &UploadConfig{
+				MaxError: 30,
+				Naming:   &Naming{Remote: DefaultRemoteTemplate},
 			},
 			inputUpload: &Upload{
 				Prefix:        "prefix",
@@ -140,12 +136,10 @@ func TestUploadRetry(t *testing.T) {
 		},
 	}
 
-	resultCh := make(chan interface{}, 3)
+	resultCh := make(chan *UploadResult, 3)
 
 	for _, test := range tests {
-		ctx := test.inputCtxFunc()
-
-		test.inputUpload.retry(ctx, resultCh, test.inputOnlyRetry)
+		test.inputUpload.retry(test.inputConfig, resultCh, test.inputOnlyRetry)
 
 		require.Equal(t, 1, len(resultCh))
 		result := <-resultCh
@@ -165,23 +159,25 @@ func TestUploadDo(t *testing.T) {
 
 	tests := []struct {
 		inputCtxFunc     func() context.Context
-		inputChResult    chan interface{}
+		inputChResult    chan *UploadResult
 		inputUpload      *Upload
 		inputSFTPHandler *TestSftpHandler
-		expectedResults  []interface{}
+		expectedResults  []*UploadResult
 		expectedErr      error
 	}{
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "sshKey", "key")
-				ctx = context.WithValue(ctx, "sshUser", "recorder")
-				ctx = context.WithValue(ctx, "sshServer", sshServerAddr)
-				ctx = context.WithValue(ctx, "maxError", 30)
-				ctx = context.WithValue(ctx, "timeout", 5)
-				return ctx
+				return WithConfig(ctx, &UploadConfig{
+					SSHKey:    "key",
+					SSHUser:   "recorder",
+					SSHServer: sshServerAddr,
+					MaxError:  30,
+					Timeout:   5,
+					Naming:    &Naming{Remote: DefaultRemoteTemplate},
+				})
 			},
-			inputChResult: make(chan interface{}, 3),
+			inputChResult: make(chan *UploadResult, 3),
 			inputUpload: &Upload{
 				Prefix:        "prefix",
 				RecordingDate: "28-01-2023",
@@ -191,7 +187,7 @@ func TestUploadDo(t *testing.T) {
 				LastError:     now,
 			},
 			inputSFTPHandler: &TestSftpHandler{},
-			expectedResults: []interface{}{
+			expectedResults: []*UploadResult{
 				&UploadResult{
 					Prefix:        "prefix",
 					RecordingDate: "28-01-2023",
@@ -205,14 +201,16 @@ func TestUploadDo(t *testing.T) {
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "sshKey", "key")
-				ctx = context.WithValue(ctx, "sshUser", "recorder")
-				ctx = context.WithValue(ctx, "sshServer", sshServerAddr)
-				ctx = context.WithValue(ctx, "maxError", 30)
-				ctx = context.WithValue(ctx, "timeout", 5)
-				return ctx
+				return WithConfig(ctx, &UploadConfig{
+					SSHKey:    "key",
+					SSHUser:   "recorder",
+					SSHServer: sshServerAddr,
+					MaxError:  30,
+					Timeout:   5,
+					Naming:    &Naming{Remote: DefaultRemoteTemplate},
+				})
 			},
-			inputChResult: make(chan interface{}, 3),
+			inputChResult: make(chan *UploadResult, 3),
 			inputUpload: &Upload{
 				Prefix:        "prefix",
 				RecordingDate: "28-01-2023",
@@ -220,7 +218,7 @@ func TestUploadDo(t *testing.T) {
 				FilePath:      filepath.Join(outputPath, "test_recording.mp4"),
 			},
 			inputSFTPHandler: &TestSftpHandler{},
-			expectedResults: []interface{}{
+			expectedResults: []*UploadResult{
 				&UploadResult{
 					Prefix:        "prefix",
 					RecordingDate: "28-01-2023",
@@ -235,14 +233,16 @@ func TestUploadDo(t *testing.T) {
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "sshKey", filepath.Join(outputPath, "id_rsa"))
-				ctx = context.WithValue(ctx, "sshUser", "recorder")
-				ctx = context.WithValue(ctx, "sshServer", "127.0.0.1:2223")
-				ctx = context.WithValue(ctx, "maxError", 30)
-				ctx = context.WithValue(ctx, "timeout", 5)
-				return ctx
+				return WithConfig(ctx, &UploadConfig{
+					SSHKey:    filepath.Join(outputPath, "id_rsa"),
+					SSHUser:   "recorder",
+					SSHServer: "127.0.0.1:2223",
+					MaxError:  30,
+					Timeout:   5,
+					Naming:    &Naming{Remote: DefaultRemoteTemplate},
+				})
 			},
-			inputChResult: make(chan interface{}, 3),
+			inputChResult: make(chan *UploadResult, 3),
 			inputUpload: &Upload{
 				Prefix:        "prefix",
 				RecordingDate: "28-01-2023",
@@ -251,7 +251,7 @@ func TestUploadDo(t *testing.T) {
 				NoError:       10,
 			},
 			inputSFTPHandler: &TestSftpHandler{},
-			expectedResults: []interface{}{
+			expectedResults: []*UploadResult{
 				&UploadResult{
 					Prefix:        "prefix",
 					RecordingDate: "28-01-2023",
@@ -266,14 +266,16 @@ func TestUploadDo(t *testing.T) {
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "sshKey", filepath.Join(outputPath, "id_rsa"))
-				ctx = context.WithValue(ctx, "sshUser", "recorder")
-				ctx = context.WithValue(ctx, "sshServer", sshServerAddr)
-				ctx = context.WithValue(ctx, "maxError", 30)
-				ctx = context.WithValue(ctx, "timeout", 5)
-				return ctx
+				return WithConfig(ctx, &UploadConfig{
+					SSHKey:    filepath.Join(outputPath, "id_rsa"),
+					SSHUser:   "recorder",
+					SSHServer: sshServerAddr,
+					MaxError:  30,
+					Timeout:   5,
+					Naming:    &Naming{Remote: DefaultRemoteTemplate},
+				})
 			},
-			inputChResult: make(chan interface{}, 3),
+			inputChResult: make(chan *UploadResult, 3),
 			inputUpload: &Upload{
 				Prefix:        "prefix",
 				RecordingDate: "28-01-2023",
@@ -282,7 +284,7 @@ func TestUploadDo(t *testing.T) {
 				NoError:       11,
 			},
 			inputSFTPHandler: nil,
-			expectedResults: []interface{}{
+			expectedResults: []*UploadResult{
 				&UploadResult{
 					Prefix:        "prefix",
 					RecordingDate: "28-01-2023",
@@ -297,14 +299,16 @@ func TestUploadDo(t *testing.T) {
 		{
 			inputCtxFunc: func() context.Context {
 				ctx := context.Background()
-				ctx = context.WithValue(ctx, "sshKey", filepath.Join(outputPath, "id_rsa"))
-				ctx = context.WithValue(ctx, "sshUser", "recorder")
-				ctx = context.WithValue(ctx, "sshServer", sshServerAddr)
-				ctx = context.WithValue(ctx, "maxError", 30)
-				ctx = context.WithValue(ctx, "timeout", 5)
-				return ctx
+				return WithConfig(ctx, &UploadConfig{
+					SSHKey:    filepath.Join(outputPath, "id_rsa"),
+					SSHUser:   "recorder",
+					SSHServer: sshServerAddr,
+					MaxError:  30,
+					Timeout:   5,
+					Naming:    &Naming{Remote: DefaultRemoteTemplate},
+				})
 			},
-			inputChResult: make(chan interface{}, 3),
+			inputChResult: make(chan *UploadResult, 3),
 			inputUpload: &Upload{
 				Prefix:        "prefix",
 				RecordingDate: "28-01-2023",
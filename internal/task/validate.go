@@ -0,0 +1,64 @@
+package task
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+)
+
+const (
+	// StatusValid is reported when burst passed validation and finalize is disabled.
+	StatusValid = "valid"
+	// StatusInvalid is reported when burst failed validation, recording is removed.
+	StatusInvalid = "invalid"
+)
+
+// Validation describes checks of every recorded burst.
+type Validation struct {
+	Tolerance float64  // Allowed difference between recorded and requested length, in seconds.
+	Codecs    []string // Expected video codecs, any codec is accepted when empty.
+	MinBytes  int64
+	Retries   int // How many times invalid burst is recorded again.
+}
+
+// ValidationError is returned when recording doesn't pass validation.
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid recording: " + e.Reason
+}
+
+// Check probes filePath and verifies that it contains expected video of given length.
+func (v *Validation) Check(filePath string, length int64) error {
+	result, err := probe(filePath)
+	if err != nil {
+		return &ValidationError{Reason: fmt.Sprintf("unable to probe: %v", err)}
+	}
+
+	size, _ := strconv.ParseInt(result.Format.Size, 10, 64)
+	if size < v.MinBytes {
+		return &ValidationError{Reason: fmt.Sprintf("size %d bytes, expected at least %d", size, v.MinBytes)}
+	}
+
+	codec := ""
+	for _, stream := range result.Streams {
+		if stream.CodecType == "video" {
+			codec = stream.CodecName
+			break
+		}
+	}
+	if codec == "" {
+		return &ValidationError{Reason: "no video stream"}
+	}
+	if len(v.Codecs) > 0 && !slices.Contains(v.Codecs, codec) {
+		return &ValidationError{Reason: fmt.Sprintf("video codec %s, expected one of %v", codec, v.Codecs)}
+	}
+
+	if duration := result.Duration(); math.Abs(duration-float64(length)) > v.Tolerance {
+		return &ValidationError{Reason: fmt.Sprintf("duration %.2fs, expected %ds", duration, length)}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package task
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestValidationCheck(t *testing.T) {
+	validation := &Validation{
+		Tolerance: 2,
+		Codecs:    []string{"h264"},
+		MinBytes:  1024,
+	}
+
+	tests := []struct {
+		inputValidation *Validation
+		mockProbeOutput string
+		mockProbeErr    error
+		expectedErr     error
+	}{
+		{
+			inputValidation: validation,
+			mockProbeOutput: `{"format": {"duration": "9.200000", "size": "204800"}, "streams": [{"codec_type": "audio", "codec_name": "aac"}, {"codec_type": "video", "codec_name": "h264"}]}`,
+		},
+		{
+			inputValidation: validation,
+			mockProbeErr:    errors.New("exit status 1"),
+			expectedErr:     &ValidationError{Reason: "unable to probe: exit status 1"},
+		},
+		{
+			inputValidation: validation,
+			mockProbeOutput: `{"format": {"duration": "0.000000", "size": "0"}, "streams": []}`,
+			expectedErr:     &ValidationError{Reason: "size 0 bytes, expected at least 1024"},
+		},
+		{
+			inputValidation: validation,
+			mockProbeOutput: `{"format": {"duration": "10.000000", "size": "204800"}, "streams": [{"codec_type": "audio", "codec_name": "aac"}]}`,
+			expectedErr:     &ValidationError{Reason: "no video stream"},
+		},
+		{
+			inputValidation: validation,
+			mockProbeOutput: `{"format": {"duration": "10.000000", "size": "204800"}, "streams": [{"codec_type": "video", "codec_name": "hevc"}]}`,
+			expectedErr:     &ValidationError{Reason: "video codec hevc, expected one of [h264]"},
+		},
+		{
+			inputValidation: validation,
+			mockProbeOutput: `{"format": {"duration": "0.100000", "size": "204800"}, "streams": [{"codec_type": "video", "codec_name": "h264"}]}`,
+			expectedErr:     &ValidationError{Reason: "duration 0.10s, expected 10s"},
+		},
+		{
+			inputValidation: &Validation{},
+			mockProbeOutput: `{"format": {"duration": "10.000000", "size": "204800"}, "streams": [{"codec_type": "video", "codec_name": "hevc"}]}`,
+		},
+	}
+
+	defer func() {
+		ffmpegProbe = ffmpeg.Probe
+	}()
+
+	for _, test := range tests {
+		ffmpegProbe = func(string, ...ffmpeg.KwArgs) (string, error) {
+			return test.mockProbeOutput, test.mockProbeErr
+		}
+
+		err := test.inputValidation.Check("file.mp4", 10)
+		if test.expectedErr == nil {
+			require.Nil(t, err)
+			continue
+		}
+		require.Equal(t, test.expectedErr, err)
+	}
+}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notifiable is implemented by results which should be delivered to webhooks.
+type Notifiable interface {
+	WebhookTask() *Webhook
+}
+
+// Webhook delivers event to all configured webhook URLs as JSON.
+// EventID and Stream are set for recordings of named streams.
+type Webhook struct {
+	Event   string    `json:"event"`
+	JobID   string    `json:"job_id,omitempty"`
+	EventID string    `json:"event_id,omitempty"`
+	Stream  string    `json:"stream,omitempty"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data"`
+}
+
+// WebhookTask returns itself, so events can be sent directly to webhook stage.
+func (r *Webhook) WebhookTask() *Webhook {
+	return r
+}
+
+func (r *Webhook) Do(ctx context.Context, chResult chan struct{}) error {
+	config, err := ConfigFromContext[WebhookConfig](ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: time.Duration(config.Timeout) * time.Second}
+	var failedURLs []string
+	for _, url := range config.URLs {
+		if err := postWebhook(client, url, body); err != nil {
+			log.Printf("unable to deliver %s webhook to %s: %v", r.Event, url, err)
+			failedURLs = append(failedURLs, url)
+		}
+	}
+
+	if len(failedURLs) > 0 {
+		return fmt.Errorf("unable to deliver %s webhook to: %s", r.Event, strings.Join(failedURLs, ", "))
+	}
+	return nil
+}
+
+func postWebhook(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
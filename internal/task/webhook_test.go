@@ -0,0 +1,72 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDo(t *testing.T) {
+	var received []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		event := make(map[string]interface{})
+		json.Unmarshal(body, &event)
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		inputConfig      *WebhookConfig
+		expectedErr      error
+		expectedReceived int
+	}{
+		{
+			inputConfig: &WebhookConfig{Timeout: 1},
+		},
+		{
+			inputConfig:      &WebhookConfig{URLs: []string{server.URL + "/a", server.URL + "/b"}, Timeout: 1},
+			expectedReceived: 2,
+		},
+		{
+			inputConfig:      &WebhookConfig{URLs: []string{server.URL + "/failing", server.URL + "/a"}, Timeout: 1},
+			expectedErr:      fmt.Errorf("unable to deliver test webhook to: %s/failing", server.URL),
+			expectedReceived: 1,
+		},
+	}
+
+	for _, test := range tests {
+		received = nil
+		tWebhook := &Webhook{
+			Event: "test",
+			JobID: "job",
+			Time:  time.Date(2023, 1, 28, 23, 40, 27, 0, time.UTC),
+			Data:  map[string]string{"key": "value"},
+		}
+
+		ctx := WithConfig(context.Background(), test.inputConfig)
+		err := tWebhook.Do(ctx, make(chan struct{}))
+		require.Equal(t, test.expectedErr, err)
+
+		require.Equal(t, test.expectedReceived, len(received))
+		for _, event := range received {
+			require.Equal(t, map[string]interface{}{
+				"event":  "test",
+				"job_id": "job",
+				"time":   "2023-01-28T23:40:27Z",
+				"data":   map[string]interface{}{"key": "value"},
+			}, event)
+		}
+	}
+}
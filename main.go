@@ -5,123 +5,104 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"recorder/internal/api"
+	"recorder/internal/job"
 	"recorder/internal/metric"
-	"recorder/internal/pool"
+	"recorder/internal/pipeline"
 	"recorder/internal/task"
 )
 
 // main will start recorder.
+// "recorder probe <url|camera>" probes streams without recording.
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Llongfile)
-	log.Printf("starting recorder")
 
 	config, err := getConfig()
 	if err != nil {
 		log.Panicf("unable to read config: %v", err)
 	}
 
-	workingPools := make(map[string]*pool.Pool)
-
-	ctxRecord := context.Background()
-	ctxRecord = context.WithValue(ctxRecord, "outputDir", config.GetString("record.dir"))
-	ctxRecord = context.WithValue(ctxRecord, "ffmpegInputArgs", config.GetStringMapString("record.input_args"))
-	ctxRecord = context.WithValue(ctxRecord, "ffmpegOutputArgs", config.GetStringMapString("record.output_args"))
-
-	ctxUpload := context.Background()
-	ctxUpload = context.WithValue(ctxUpload, "sshUser", config.GetString("ssh.user"))
-	ctxUpload = context.WithValue(ctxUpload, "sshKey", config.GetString("ssh.key"))
-	ctxUpload = context.WithValue(ctxUpload, "sshServer", config.GetString("ssh.server"))
-	ctxUpload = context.WithValue(ctxUpload, "timeout", config.GetInt("upload.timeout"))
-	ctxUpload = context.WithValue(ctxUpload, "maxError", config.GetInt("upload.max_errors"))
-
-	ctxConvert := context.Background()
-	ctxConvert = context.WithValue(ctxConvert, "outputDir", config.GetString("convert.dir"))
-	ctxConvert = context.WithValue(ctxConvert, "ffmpegInputArgs", config.GetStringMapString("convert.input_args"))
-	ctxConvert = context.WithValue(ctxConvert, "ffmpegOutputArgs", config.GetStringMapString("convert.output_args"))
-
-	for poolName, poolOptions := range map[string]*pool.Options{
-		"record": {
-			NoWorkers:  config.GetInt("record.workers"),
-			PoolSize:   100,
-			ResultSize: 100,
-			Ctx:        ctxRecord,
-		},
-		"upload": {
-			NoWorkers:  config.GetInt("upload.workers"),
-			PoolSize:   150,
-			ResultSize: 150,
-			Ctx:        ctxUpload,
-		},
-		"convert": {
-			NoWorkers:  config.GetInt("convert.workers"),
-			PoolSize:   30,
-			ResultSize: 30,
-			Ctx:        ctxConvert,
-		},
-	} {
-		workingPools[poolName] = pool.New(poolOptions)
+	if len(os.Args) > 1 && os.Args[1] == "probe" {
+		os.Exit(probeCommand(config, os.Args[2:]))
+	}
+	log.Printf("starting recorder")
+
+	// Pipeline context is canceled on shutdown, stages release shared resources with it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := job.NewRegistry(1000)
+
+	recordingPipeline, err := pipeline.New(&pipeline.Options{
+		Config:     config,
+		ResultSize: 100,
+		Ctx:        job.WithRegistry(ctx, jobs),
+	})
+	if err != nil {
+		log.Panicf("unable to create pipeline: %v", err)
+	}
+
+	recordStage, ok := recordingPipeline.Stage("record")
+	if !ok {
+		log.Panicf("pipeline is missing record stage")
+	}
+
+	probeConfig, err := pipeline.NewProbeConfig("record", config)
+	if err != nil {
+		log.Panicf("unable to read probe config: %v", err)
+	}
+
+	snapshots, err := pipeline.NewSnapshots("record", config)
+	if err != nil {
+		log.Panicf("unable to read snapshot config: %v", err)
+	}
+
+	monitor, err := pipeline.NewMonitor("record", config)
+	if err != nil {
+		log.Panicf("unable to read monitor config: %v", err)
+	}
+	if monitor != nil {
+		if webhookStage, ok := recordingPipeline.Stage("webhook"); ok {
+			monitor.Notify = func(w *task.Webhook) {
+				if err := webhookStage.Accept(w); err != nil {
+					log.Printf("unable to send %s webhook: %v", w.Event, err)
+				}
+			}
+		}
+		go monitor.Run(ctx)
 	}
 
 	metric.Initialize(&metric.Options{
-		WorkingPools: workingPools,
+		WorkingPools: recordingPipeline.Stats(),
+		Jobs:         jobs,
+		Monitor:      monitor,
 	})
 
 	httpRouter := api.NewRouter(&api.Options{
 		RecordingPath: config.GetString("record.dir"),
-		WorkingPools:  workingPools,
+		WorkingPools:  recordingPipeline.Stats(),
+		RecordStage:   recordStage,
 		AuthUsers:     config.GetStringMapString("api.user"),
+		Jobs:          jobs,
+		Probe:         probeConfig,
+		Snapshots:     snapshots,
+		Monitor:       monitor,
 	})
 
-	go dispatcher(workingPools)
-	http.ListenAndServe(fmt.Sprintf(":%d", api.HTTPPort), httpRouter)
-}
+	go recordingPipeline.Route()
 
-// dispatcher handles results from different working pools.
-func dispatcher(workingPools map[string]*pool.Pool) {
-	for {
-		select {
-		// Record working pool triggers recording flow (record -> upload -> convert).
-		case recordResult := <-workingPools["record"].ResultChan():
-			switch result := recordResult.(type) {
-			// Single recording was done, lets upload it to remote sftp server.
-			case *task.SingleRecordResult:
-				tUpload := &task.Upload{
-					Prefix:        result.Prefix,
-					RecordingDate: result.RecordingDate,
-					FileName:      result.FileName,
-					FilePath:      result.FilePath,
-				}
-				if workingPools["upload"].Running() {
-					workingPools["upload"].Execute(tUpload.Do)
-				}
-			// All recordings are done, lets start convert action.
-			case *task.MultipleRecordResult:
-				tConvert := &task.Convert{
-					Prefix:         result.Prefix,
-					RecordingDate:  result.RecordingDate,
-					FileNamePrefix: result.FileNamePrefix,
-					FilesPath:      result.FilesPath,
-					TotalLength:    result.TotalLength,
-				}
-				if workingPools["convert"].Running() {
-					workingPools["convert"].Execute(tConvert.Do)
-				}
-			}
-		// Upload task generates result only on failure.
-		// This is used to retry uploads.
-		case uploadResult := <-workingPools["upload"].ResultChan():
-			result := uploadResult.(*task.UploadResult)
-			tUpload := &task.Upload{
-				Prefix:        result.Prefix,
-				RecordingDate: result.RecordingDate,
-				FileName:      result.FileName,
-				FilePath:      result.FilePath,
-				NoError:       result.NoError,
-				LastError:     result.LastError,
-			}
-			workingPools["upload"].Execute(tUpload.Do)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", api.HTTPPort), Handler: httpRouter}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Panicf("unable to serve http: %v", err)
 		}
-	}
+	}()
+
+	<-ctx.Done()
+	log.Printf("stopping recorder")
+	server.Shutdown(context.Background())
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"recorder/internal/pipeline"
+
+	"github.com/spf13/viper"
+)
+
+// probeCommand probes stream URL, or every stream configured for camera, and prints results as JSON.
+// It returns exit code, which is non-zero when any stream can't be probed.
+func probeCommand(config *viper.Viper, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: recorder probe <url|camera>")
+		return 2
+	}
+	probeConfig, err := pipeline.NewProbeConfig("record", config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to read probe config: %v\n", err)
+		return 1
+	}
+
+	stream, camName := args[0], ""
+	if !strings.Contains(stream, "://") {
+		stream, camName = "", args[0]
+	}
+	results, err := probeConfig.Probe(stream, camName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(results)
+	for _, result := range results {
+		if !result.OK {
+			return 1
+		}
+	}
+	return 0
+}